@@ -39,6 +39,7 @@ type Drone struct {
 	kubeConn   string
 	dockerConn string
 	orgSecrets string
+	signingKey string
 
 	downgrade   bool
 	beforeAfter bool
@@ -64,6 +65,7 @@ func (c *Drone) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.kubeName, "kube-namespace", "", "kubernets namespace")
 	f.StringVar(&c.dockerConn, "docker-connector", "", "dockerhub connector")
 	f.StringVar(&c.orgSecrets, "org-secrets", "", "organization secrets, comma separated")
+	f.StringVar(&c.signingKey, "signing-key", "", "drone signing key used to verify the pipeline signature")
 }
 
 func (c *Drone) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -93,6 +95,7 @@ func (c *Drone) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) su
 		drone.WithDockerhub(c.dockerConn),
 		drone.WithKubernetes(c.kubeName, c.kubeConn),
 		drone.WithOrgSecrets(orgSecrets...),
+		drone.WithSigningKey(c.signingKey),
 	)
 	after, err := converter.ConvertBytes(before)
 	if err != nil {
@@ -16,10 +16,14 @@ package command
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/hunain-avyka/Go-drone/convert/github"
 	"github.com/hunain-avyka/Go-drone/convert/harness/downgrader"
@@ -37,6 +41,14 @@ type Github struct {
 	kubeConn   string
 	dockerConn string
 
+	orgSecrets     string
+	accountSecrets string
+	root           string
+	workflowCache  string
+	runners        string
+	environments   string
+	output         string
+
 	downgrade   bool
 	beforeAfter bool
 }
@@ -45,6 +57,7 @@ func (*Github) Name() string     { return "github" }
 func (*Github) Synopsis() string { return "converts a github pipeline" }
 func (*Github) Usage() string {
 	return `github [-downgrade] <path to .github/workflows/main.yml>
+github [-downgrade] -output <dir> <path to .github/workflows>
 `
 }
 
@@ -60,6 +73,13 @@ func (c *Github) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.kubeConn, "kube-connector", "", "kubernetes connector")
 	f.StringVar(&c.kubeName, "kube-namespace", "", "kubernets namespace")
 	f.StringVar(&c.dockerConn, "docker-connector", "", "dockerhub connector")
+	f.StringVar(&c.orgSecrets, "org-secrets", "", "organization secrets, comma separated")
+	f.StringVar(&c.accountSecrets, "account-secrets", "", "account secrets, comma separated")
+	f.StringVar(&c.root, "root", "", "repository root used to load local reusable workflows, defaults to the workflow repository")
+	f.StringVar(&c.workflowCache, "workflow-cache", "", "directory used to load remote reusable workflows")
+	f.StringVar(&c.runners, "runners", "", "self-hosted runner labels mapped to delegate selectors or kubernetes, comma separated label=selector pairs")
+	f.StringVar(&c.environments, "environments", "", "environments that require approval, comma separated name=group:group pairs")
+	f.StringVar(&c.output, "output", "", "output directory of the pipelines, if the path is a workflow directory")
 }
 
 func (c *Github) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -71,6 +91,63 @@ func (c *Github) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) s
 		path = ".github/workflows/main.yml"
 	}
 
+	var orgSecrets, accountSecrets []string
+	if c.orgSecrets != "" {
+		orgSecrets = strings.Split(c.orgSecrets, ",")
+	}
+	if c.accountSecrets != "" {
+		accountSecrets = strings.Split(c.accountSecrets, ",")
+	}
+
+	runners := map[string]string{}
+	for _, pair := range strings.Split(c.runners, ",") {
+		if parts := strings.SplitN(pair, "=", 2); len(parts) == 2 {
+			runners[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	environments := map[string]*github.Environment{}
+	for _, pair := range strings.Split(c.environments, ",") {
+		if parts := strings.SplitN(pair, "=", 2); len(parts) == 2 {
+			environments[strings.TrimSpace(parts[0])] = &github.Environment{
+				Approvers: strings.Split(strings.TrimSpace(parts[1]), ":"),
+			}
+		}
+	}
+
+	// if the user does not specify the repository root,
+	// assume the repository that contains the workflow.
+	root := c.root
+	if root == "" {
+		if i := strings.Index(filepath.ToSlash(filepath.Clean(path))+"/", ".github/workflows/"); i != -1 {
+			root = path[:i]
+		}
+		if root == "" {
+			root = "."
+		}
+	}
+
+	converter := github.New(
+		github.WithDockerhub(c.dockerConn),
+		github.WithKubernetes(c.kubeName, c.kubeConn),
+		github.WithOrgSecrets(orgSecrets...),
+		github.WithAccountSecrets(accountSecrets...),
+		github.WithRoot(root),
+		github.WithWorkflowCache(c.workflowCache),
+		github.WithRunners(runners),
+		github.WithEnvironments(environments),
+	)
+
+	// convert every workflow if the path is a workflow
+	// directory.
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		if err := c.convertDir(converter, path); err != nil {
+			log.Println(err)
+			return subcommands.ExitFailure
+		}
+		return subcommands.ExitSuccess
+	}
+
 	// open the github yaml
 	before, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -80,10 +157,6 @@ func (c *Github) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) s
 
 	// convert the workflow from the github
 	// format to the harness yaml format.
-	converter := github.New(
-		github.WithDockerhub(c.dockerConn),
-		github.WithKubernetes(c.kubeName, c.kubeConn),
-	)
 	after, err := converter.ConvertBytes(before)
 	if err != nil {
 		log.Println(err)
@@ -94,15 +167,7 @@ func (c *Github) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) s
 	// to the v0 harness yaml format.
 	if c.downgrade {
 		// downgrade to the v0 yaml
-		d := downgrader.New(
-			downgrader.WithCodebase(c.repoName, c.repoConn),
-			downgrader.WithDockerhub(c.dockerConn),
-			downgrader.WithKubernetes(c.kubeName, c.kubeConn),
-			downgrader.WithName(c.name),
-			downgrader.WithOrganization(c.org),
-			downgrader.WithProject(c.proj),
-		)
-		after, err = d.Downgrade(after)
+		after, err = c.downgrader(c.name, "").Downgrade(after)
 		if err != nil {
 			log.Println(err)
 			return subcommands.ExitFailure
@@ -119,3 +184,51 @@ func (c *Github) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) s
 
 	return subcommands.ExitSuccess
 }
+
+// downgrader returns a downgrader of the pipeline with the
+// name and identifier.
+func (c *Github) downgrader(name, identifier string) *downgrader.Downgrader {
+	return downgrader.New(
+		downgrader.WithCodebase(c.repoName, c.repoConn),
+		downgrader.WithDockerhub(c.dockerConn),
+		downgrader.WithKubernetes(c.kubeName, c.kubeConn),
+		downgrader.WithName(name),
+		downgrader.WithIdentifier(identifier),
+		downgrader.WithOrganization(c.org),
+		downgrader.WithProject(c.proj),
+	)
+}
+
+// convertDir converts the workflows of the directory and
+// writes a pipeline per workflow, the stage templates and
+// the conversion summary to the output directory.
+func (c *Github) convertDir(converter *github.Converter, dir string) error {
+	if c.output == "" {
+		return errors.New("the output directory is required to convert a workflow directory")
+	}
+	result, err := converter.ConvertDir(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(c.output, "templates"), 0755); err != nil {
+		return err
+	}
+	for _, workflow := range result.Workflows {
+		out := workflow.Pipeline
+		if c.downgrade {
+			out, err = c.downgrader(workflow.Name, workflow.Identifier).Downgrade(out)
+			if err != nil {
+				return fmt.Errorf("%s: %s", workflow.Path, err)
+			}
+		}
+		if err := ioutil.WriteFile(filepath.Join(c.output, workflow.Identifier+".yaml"), out, 0644); err != nil {
+			return err
+		}
+	}
+	for _, template := range result.Templates {
+		if err := ioutil.WriteFile(filepath.Join(c.output, "templates", template.Identifier+".yaml"), template.Template, 0644); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(c.output, "summary.md"), result.Summary, 0644)
+}
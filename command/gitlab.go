@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/hunain-avyka/Go-drone/convert/gitlab"
 	"github.com/hunain-avyka/Go-drone/convert/harness/downgrader"
@@ -36,6 +37,9 @@ type Gitlab struct {
 	kubeName   string
 	kubeConn   string
 	dockerConn string
+	root       string
+	projects   string
+	templates  string
 
 	downgrade   bool
 	beforeAfter bool
@@ -44,7 +48,7 @@ type Gitlab struct {
 func (*Gitlab) Name() string     { return "gitlab" }
 func (*Gitlab) Synopsis() string { return "converts a gitlab pipeline" }
 func (*Gitlab) Usage() string {
-	return `gitlab [-downgrade] [.gitlab.yml]
+	return `gitlab [-downgrade] [-root dir] [-projects dir] [-templates dir] [.gitlab.yml]
 `
 }
 
@@ -60,6 +64,9 @@ func (c *Gitlab) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.kubeConn, "kube-connector", "", "kubernetes connector")
 	f.StringVar(&c.kubeName, "kube-namespace", "", "kubernets namespace")
 	f.StringVar(&c.dockerConn, "docker-connector", "", "dockerhub connector")
+	f.StringVar(&c.root, "root", "", "repository root used to resolve local includes, defaults to the pipeline directory")
+	f.StringVar(&c.projects, "projects", "", "directory of project mirrors used to resolve project includes")
+	f.StringVar(&c.templates, "templates", "", "directory of gitlab templates used to resolve template includes that are not bundled, such as the language, Security and Jobs templates")
 }
 
 func (c *Gitlab) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -78,11 +85,22 @@ func (c *Gitlab) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) s
 		return subcommands.ExitFailure
 	}
 
+	// local includes are resolved relative to the
+	// pipeline directory, unless the user specifies
+	// the repository root.
+	root := c.root
+	if root == "" {
+		root = filepath.Dir(path)
+	}
+
 	// convert the pipeline yaml from the gitlab
 	// format to the harness yaml format.
 	converter := gitlab.New(
 		gitlab.WithDockerhub(c.dockerConn),
 		gitlab.WithKubernetes(c.kubeName, c.kubeConn),
+		gitlab.WithRoot(root),
+		gitlab.WithProjects(c.projects),
+		gitlab.WithTemplates(c.templates),
 	)
 	after, err := converter.ConvertBytes(before)
 	if err != nil {
@@ -0,0 +1,142 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	v1 "github.com/hunain-avyka/Go-drone/convert/drone/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+
+	v2 "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// convertContainer returns the step container. Steps in
+// host-native pipelines execute on the host and have no
+// container.
+//
+// The docker settings (devices, dns, extra hosts, network
+// and swap) are supported by the container runtimes, but
+// not by the kubernetes runtime, where they are reported.
+func convertContainer(src *v1.Step, hostNative, kube bool, r *report.Report) *containerV1 {
+	if hostNative {
+		if src.Image != "" {
+			r.Addf("step %q: image %q ignored, the step executes on the host", src.Name, src.Image)
+		}
+		for _, name := range containerSettings(src) {
+			r.Addf("step %q: %s is not supported, the step executes on the host", src.Name, name)
+		}
+		return nil
+	}
+
+	dst := &containerV1{
+		ContainerSpec: &v2.ContainerSpec{
+			Image:     src.Image,
+			Connector: src.Connector,
+		},
+		Mount:     convertMounts(src.Volumes),
+		Resources: convertMemLimit(src.MemLimit),
+	}
+
+	// shared memory is provided by a memory-backed volume
+	// mounted at /dev/shm, which is supported by all
+	// runtimes.
+	if src.ShmSize != 0 {
+		dst.Mount = append(dst.Mount, &v2.Mount{
+			Name: shmVolumeName(src),
+			Path: "/dev/shm",
+		})
+	}
+
+	if kube {
+		for _, name := range containerSettings(src) {
+			if name == "shm_size" || name == "mem_limit" {
+				continue
+			}
+			r.Addf("step %q: %s is not supported by the kubernetes runtime", src.Name, name)
+		}
+		return dst
+	}
+
+	dst.Devices = convertDevices(src.Devices)
+	dst.Dns = src.DNS
+	dst.DnsSearch = src.DNSSearch
+	dst.ExtraHosts = src.ExtraHosts
+	dst.Network = src.Network
+	dst.MemSwapLimit = v2.MemStringorInt(src.MemSwapLimit)
+	return dst
+}
+
+// containerSettings returns the names of the docker
+// settings configured for the step.
+func containerSettings(src *v1.Step) []string {
+	var names []string
+	if len(src.Devices) != 0 {
+		names = append(names, "devices")
+	}
+	if len(src.DNS) != 0 {
+		names = append(names, "dns")
+	}
+	if len(src.DNSSearch) != 0 {
+		names = append(names, "dns_search")
+	}
+	if len(src.ExtraHosts) != 0 {
+		names = append(names, "extra_hosts")
+	}
+	if src.MemLimit != 0 {
+		names = append(names, "mem_limit")
+	}
+	if src.MemSwapLimit != 0 {
+		names = append(names, "memswap_limit")
+	}
+	if src.Network != "" {
+		names = append(names, "network_mode")
+	}
+	if src.ShmSize != 0 {
+		names = append(names, "shm_size")
+	}
+	return names
+}
+
+func convertDevices(src []*v1.VolumeDevice) []*deviceV1 {
+	var dst []*deviceV1
+	for _, v := range src {
+		if v == nil || v.Name == "" || v.DevicePath == "" {
+			continue
+		}
+		dst = append(dst, &deviceV1{
+			Name: v.Name,
+			Path: v.DevicePath,
+		})
+	}
+	return dst
+}
+
+// convertMemLimit converts the step memory limit to a
+// container resource limit.
+func convertMemLimit(src v1.BytesSize) *v2.Resources {
+	if src == 0 {
+		return nil
+	}
+	return &v2.Resources{
+		Limits: &v2.Resource{
+			Memory: v2.MemStringorInt(src),
+		},
+	}
+}
+
+// shmVolumeName returns the name of the memory-backed
+// volume that provides the step shared memory.
+func shmVolumeName(src *v1.Step) string {
+	return "shm_" + sanitizeString(src.Name)
+}
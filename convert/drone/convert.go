@@ -17,22 +17,31 @@ package drone
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	v1 "github.com/hunain-avyka/Go-drone/convert/drone/yaml"
 	v2 "github.com/hunain-avyka/go-spec/dist/go"
 
 	"github.com/ghodss/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
 	"github.com/hunain-avyka/Go-drone/internal/store"
 )
 
+// ErrSignature is returned when the pipeline signature
+// cannot be verified using the signing key.
+var ErrSignature = errors.New("drone: invalid pipeline signature")
+
 // conversion context
 type context struct {
+	raw      []byte
 	pipeline []*v1.Pipeline
+	report   *report.Report
 }
 
 // Converter converts a Drone pipeline to a Harness
@@ -44,24 +53,30 @@ type Converter struct {
 	dockerhubConn string
 	identifiers   *store.Identifiers
 	orgSecrets    []string
+	signingKey    string
 }
 
 var variableMap = map[string]string{
-	"DRONE_BRANCH":             "<+codebase.branch>",
-	"DRONE_BUILD_NUMBER":       "<+pipeline.sequenceId>",
-	"DRONE_COMMIT_AUTHOR":      "<+codebase.gitUserId>",
-	"DRONE_COMMIT_BRANCH":      "<+codebase.branch>",
-	"DRONE_COMMIT_SHA":         "<+codebase.commitSha>",
-	"DRONE_PULL_REQUEST":       "<+codebase.prNumber>",
-	"DRONE_PULL_REQUEST_TITLE": "<+codebase.prTitle>",
-	"DRONE_REMOTE_URL":         "<+codebase.repoUrl>",
-	"DRONE_REPO_NAME":          "<+<+codebase.repoUrl>.substring(<+codebase.repoUrl>.lastIndexOf('/') + 1)>",
-	"CI_BUILD_NUMBER":          "<+pipeline.sequenceId>",
-	"CI_COMMIT_AUTHOR":         "<+codebase.gitUserId>",
-	"CI_COMMIT_BRANCH":         "<+codebase.branch>",
-	"CI_COMMIT_SHA":            "<+codebase.commitSha>",
-	"CI_REMOTE_URL":            "<+codebase.repoUrl>",
-	"CI_REPO_NAME":             "<+<+codebase.repoUrl>.substring(<+codebase.repoUrl>.lastIndexOf('/') + 1)>",
+	"DRONE_BRANCH":              "<+codebase.branch>",
+	"DRONE_BUILD_NUMBER":        "<+pipeline.sequenceId>",
+	"DRONE_COMMIT_AUTHOR":       "<+codebase.gitUserId>",
+	"DRONE_COMMIT_AUTHOR_EMAIL": "<+codebase.gitUserEmail>",
+	"DRONE_COMMIT_BRANCH":       "<+codebase.branch>",
+	"DRONE_COMMIT_REF":          "<+codebase.commitRef>",
+	"DRONE_COMMIT_SHA":          "<+codebase.commitSha>",
+	"DRONE_PULL_REQUEST":        "<+codebase.prNumber>",
+	"DRONE_PULL_REQUEST_TITLE":  "<+codebase.prTitle>",
+	"DRONE_REMOTE_URL":          "<+codebase.repoUrl>",
+	"DRONE_REPO_NAME":           "<+<+codebase.repoUrl>.substring(<+codebase.repoUrl>.lastIndexOf('/') + 1)>",
+	"DRONE_SOURCE_BRANCH":       "<+codebase.sourceBranch>",
+	"DRONE_TAG":                 "<+codebase.tag>",
+	"DRONE_TARGET_BRANCH":       "<+codebase.targetBranch>",
+	"CI_BUILD_NUMBER":           "<+pipeline.sequenceId>",
+	"CI_COMMIT_AUTHOR":          "<+codebase.gitUserId>",
+	"CI_COMMIT_BRANCH":          "<+codebase.branch>",
+	"CI_COMMIT_SHA":             "<+codebase.commitSha>",
+	"CI_REMOTE_URL":             "<+codebase.repoUrl>",
+	"CI_REPO_NAME":              "<+<+codebase.repoUrl>.substring(<+codebase.repoUrl>.lastIndexOf('/') + 1)>",
 }
 
 // New creates a new Converter that converts a Drone
@@ -95,12 +110,18 @@ func New(options ...Option) *Converter {
 
 // Convert downgrades a v1 pipeline.
 func (d *Converter) Convert(r io.Reader) ([]byte, error) {
-	src, err := v1.Parse(r)
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	src, err := v1.ParseBytes(raw)
 	if err != nil {
 		return nil, err
 	}
 	return d.convert(&context{
+		raw:      raw,
 		pipeline: src,
+		report:   report.New(),
 	})
 }
 
@@ -131,19 +152,21 @@ func (d *Converter) ConvertFile(p string) ([]byte, error) {
 // converts converts a Drone pipeline to a Harness pipeline.
 func (d *Converter) convert(ctx *context) ([]byte, error) {
 
-	//
-	// TODO convert env substitution to expression
-	//
-
-	//
-	// TODO convert from_secret to expression
-	//
+	// index the external secrets before converting the
+	// pipelines, since secret documents can be declared
+	// after the pipelines that reference them.
+	secrets := newSecretStore(d.orgSecrets)
+	for _, from := range ctx.pipeline {
+		if from != nil && from.Kind == v1.KindSecret {
+			secrets.register(from, ctx.report)
+		}
+	}
 
 	// create the pipeline spec
-	pipeline := &v2.PipelineV1{}
+	pipeline := &pipelineV1{}
 
 	// create the harness pipeline resource
-	config := &v2.ConfigV1{
+	config := &configV1{
 		Pipeline: pipeline,
 	}
 
@@ -153,17 +176,31 @@ func (d *Converter) convert(ctx *context) ([]byte, error) {
 		}
 
 		switch from.Kind {
-		case v1.KindSecret: // TODO
-		case v1.KindSignature: // TODO
+		case v1.KindSecret:
+			// secrets are indexed above.
+		case v1.KindSignature:
+			if d.signingKey == "" {
+				ctx.report.Addf("signature document ignored, the pipeline signature was not verified")
+				continue
+			}
+			if !verify(ctx.raw, d.signingKey, from.Hmac) {
+				return nil, ErrSignature
+			}
 		case v1.KindPipeline:
 			// TODO pipeline.name removed from spec
 			// pipeline.Name = from.Name
-			runtime := determineRuntime(from)
-			pipeline.Stages = append(pipeline.Stages, &v2.StageV1{
-				Name:    from.Name,
-				Clone:   convertCloneV1(&from.Clone),
-				Runtime: runtime,
-				Steps:   convertSteps(from, d.orgSecrets),
+			pipeline.Stages = append(pipeline.Stages, &stageV1{
+				StageV1: &v2.StageV1{
+					Name: from.Name,
+				},
+				Clone:       convertClone(from.Clone),
+				Concurrency: convertConcurrency(from.Concurrency),
+				Steps:       d.convertSteps(from, secrets, ctx.report),
+				Volumes:     convertVolumes(from),
+				Runtime:     d.convertRuntime(from, ctx.report),
+				Platform:    convertPlatform(from, ctx.report),
+				Delegate:    convertNode(from.Node),
+				When:        convertTrigger(from, ctx.report),
 			})
 		}
 	}
@@ -182,14 +219,68 @@ func (d *Converter) convert(ctx *context) ([]byte, error) {
 	// Replace all occurrences of /drone/src with /harness
 	out = bytes.ReplaceAll(out, []byte("/drone/src"), []byte("/harness"))
 
+	// prepend the conversion notes, if any, as a yaml
+	// comment block.
+	if notes := ctx.report.Comment(); notes != nil {
+		out = append(notes, out...)
+	}
+
 	return out, nil
 }
 
-func determineRuntime(from *v1.Pipeline) string {
+// convertRuntime returns the stage runtime. Kubernetes
+// pipelines, and container pipelines when the kubernetes
+// runtime is enabled, are converted to a kubernetes runtime.
+func (d *Converter) convertRuntime(from *v1.Pipeline, r *report.Report) interface{} {
+	if d.isKubernetes(from) {
+		return convertKubernetes(from, d.kubeNamespace, d.kubeConnector, r)
+	}
+	return determineRuntime(from, r)
+}
+
+// isKubernetes returns true if the pipeline is converted
+// to a kubernetes runtime.
+func (d *Converter) isKubernetes(from *v1.Pipeline) bool {
+	return from.Type == "kubernetes" || (d.kubeEnabled && !isHostNative(from))
+}
+
+// determineRuntime returns the runtime for the pipeline
+// type. Container pipelines run in harness cloud, unless
+// routed to specific runners using node labels, in which
+// case they run on the delegate host. Host-native pipelines
+// run on the delegate host or a harness cloud vm.
+func determineRuntime(from *v1.Pipeline, r *report.Report) string {
 	if from.Runtime != "" {
 		return from.Runtime
 	}
-	return "machine"
+	switch from.Type {
+	case "", "docker":
+		if len(from.Node) != 0 {
+			return "machine"
+		}
+		return "cloud"
+	case "exec":
+		return "machine"
+	case "ssh":
+		r.Addf("pipeline %q: ssh pipelines execute on a remote server, which is not supported. the steps execute on the delegate host", from.Name)
+		return "machine"
+	case "digitalocean", "macstadium":
+		return "cloud"
+	default:
+		r.Addf("pipeline %q: unknown pipeline type %q", from.Name, from.Type)
+		return "machine"
+	}
+}
+
+// isHostNative returns true if the pipeline steps execute
+// directly on the host, without containers.
+func isHostNative(from *v1.Pipeline) bool {
+	switch from.Type {
+	case "exec", "ssh", "digitalocean", "macstadium":
+		return true
+	default:
+		return false
+	}
 }
 
 func convertRegistry(src []*v1.Pipeline) *v2.Registry {
@@ -225,39 +316,47 @@ func convertRegistry(src []*v1.Pipeline) *v2.Registry {
 	return dst
 }
 
-func convertSteps(src *v1.Pipeline, orgSecrets []string) []*v2.StepV1 {
-	var dst []*v2.StepV1
+func (d *Converter) convertSteps(src *v1.Pipeline, secrets *secretStore, r *report.Report) []*stepV1 {
+	var dst []*stepV1
+	hostNative := isHostNative(src)
+	kube := d.isKubernetes(src)
 	for _, v := range src.Steps {
 		if v != nil {
 			switch {
 			case v.Detach:
 				continue
 			case isPlugin(v):
-				stepV1 := &v2.StepV1{
+				if step := d.convertNativePlugin(v, secrets, r); step != nil {
+					step.Failure = convertFailure(v, r)
+					dst = append(dst, step)
+					continue
+				}
+				step := &v2.StepV1{
 					Name: v.Name,
 				}
-				stepV1.RunSpec = v2.RunSpec{
-					Container: &v2.ContainerSpec{
-						Image:     v.Image,
-						Connector: v.Connector,
-					},
-					With: convertSettings(v.Settings, orgSecrets),
-					Env:  convertVariables(v.Environment, orgSecrets),
+				step.RunSpec = v2.RunSpec{
+					With: convertPluginSettings(v, secrets, r),
+					Env:  convertVariables(v.Environment, secrets, r),
 				}
-				dst = append(dst, stepV1)
+				dst = append(dst, &stepV1{
+					StepV1:    step,
+					Container: convertContainer(v, hostNative, kube, r),
+					Failure:   convertFailure(v, r),
+				})
 			default:
-				stepV1 := &v2.StepV1{
-					Name: v.Name,
-					Run: &v2.RunSpec{
-						Container: &v2.ContainerSpec{
-							Image:     v.Image,
-							Connector: v.Connector,
+				dst = append(dst, &stepV1{
+					StepV1: &v2.StepV1{
+						Name: v.Name,
+					},
+					Run: &runSpecV1{
+						RunSpec: &v2.RunSpec{
+							Env:    convertVariables(v.Environment, secrets, r),
+							Script: convertScript(v.Commands, r),
 						},
-						Env:    convertVariables(v.Environment, orgSecrets),
-						Script: joinCommands(v.Commands),
+						Container: convertContainer(v, hostNative, kube, r),
 					},
-				}
-				dst = append(dst, convertRun(stepV1, orgSecrets))
+					Failure: convertFailure(v, r),
+				})
 			}
 		}
 	}
@@ -265,68 +364,6 @@ func convertSteps(src *v1.Pipeline, orgSecrets []string) []*v2.StepV1 {
 	return dst
 }
 
-func joinCommands(commands []string) string {
-	return strings.Join(commands, "\n")
-}
-
-func convertPlugin(src *v1.Step, orgSecrets []string) *v2.Step {
-	return &v2.Step{
-		Name: src.Name,
-		Type: "plugin",
-		When: convertCond(src.When),
-		Spec: &v2.StepPlugin{
-			Image:      src.Image,
-			Mount:      convertMounts(src.Volumes),
-			Privileged: src.Privileged,
-			Pull:       convertPull(src.Pull),
-			User:       src.User,
-			Envs:       convertVariables(src.Environment, orgSecrets),
-			With:       convertSettings(src.Settings, orgSecrets),
-			Resources:  convertResourceLimits(&src.Resource),
-			// Volumes       // FIX
-		},
-	}
-}
-
-func convertBackground(src *v1.Step, orgSecrets []string) *v2.Step {
-	return &v2.Step{
-		Name: src.Name,
-		Type: "background",
-		When: convertCond(src.When),
-		Spec: &v2.StepBackground{
-			Image:      src.Image,
-			Mount:      convertMounts(src.Volumes),
-			Privileged: src.Privileged,
-			Pull:       convertPull(src.Pull),
-			Shell:      convertShell(src.Shell),
-			User:       src.User,
-			Entrypoint: convertEntrypoint(src.Entrypoint),
-			Args:       convertArgs(src.Entrypoint, src.Command),
-			Run:        convertScript(src.Commands),
-			Envs:       convertVariables(src.Environment, orgSecrets),
-			Resources:  convertResourceLimits(&src.Resource),
-			// Volumes       // FIX
-		},
-	}
-}
-
-func convertRun(src *v2.StepV1, orgSecrets []string) *v2.StepV1 {
-	runSpec := &v2.RunSpec{
-		With: src.Run.With,
-		Container: &v2.ContainerSpec{
-			Image:     src.Run.Container.Image,
-			Connector: src.Run.Container.Connector,
-		},
-		Env:    src.Run.Env,
-		Script: src.Run.Script,
-	}
-
-	return &v2.StepV1{
-		Name: src.Name,
-		Run:  runSpec,
-	}
-}
-
 func convertResourceLimits(src *v1.Resources) *v2.Resources {
 	if src.Limits.CPU == 0 && src.Limits.Memory == 0 {
 		return nil
@@ -359,24 +396,14 @@ func convertEntrypoint(src []string) string {
 	}
 }
 
-func convertVariables(src map[string]*v1.Variable, orgSecrets []string) map[string]string {
+func convertVariables(src map[string]*v1.Variable, secrets *secretStore, r *report.Report) map[string]string {
 	dst := map[string]string{}
-
-	orgSecretsMap := make(map[string]bool, len(orgSecrets))
-	for _, secret := range orgSecrets {
-		orgSecretsMap[secret] = true
-	}
-
 	for k, v := range src {
 		switch {
 		case v.Value != "":
-			dst[sanitizeString(k)] = replaceVars(v.Value)
+			dst[sanitizeString(k)] = replaceVars(v.Value, r)
 		case v.Secret != "":
-			secretID := sanitizeString(v.Secret)
-			if _, exists := orgSecretsMap[secretID]; exists {
-				secretID = "org." + secretID
-			}
-			dst[k] = fmt.Sprintf("<+secrets.getValue(%q)>", secretID) // TODO figure out secret syntax
+			dst[k] = secrets.expr(v.Secret)
 		}
 	}
 	return dst
@@ -389,9 +416,12 @@ func sanitizeString(input string) string {
 	return sanitized
 }
 
-func convertVolumes(src []*v1.Volume) []*v2.Volume {
+// convertVolumes converts the pipeline volumes, including
+// the memory-backed volumes that provide the shared memory
+// for steps that configure shm_size.
+func convertVolumes(src *v1.Pipeline) []*v2.Volume {
 	var dst []*v2.Volume
-	for _, v := range src {
+	for _, v := range src.Volumes {
 		if v == nil || v.Name == "" {
 			continue
 		}
@@ -400,8 +430,9 @@ func convertVolumes(src []*v1.Volume) []*v2.Volume {
 			dst = append(dst, &v2.Volume{
 				Name: v.Name,
 				Type: "temp",
-				Spec: &v2.VolumeTemp{
-					// TODO convert medium and limit
+				Spec: &volumeTempV1{
+					Medium: v.EmptyDir.Medium,
+					Limit:  v2.MemStringorInt(v.EmptyDir.SizeLimit),
 				},
 			})
 		case v.HostPath != nil:
@@ -414,6 +445,19 @@ func convertVolumes(src []*v1.Volume) []*v2.Volume {
 			})
 		}
 	}
+	for _, v := range src.Steps {
+		if v == nil || v.ShmSize == 0 || isHostNative(src) {
+			continue
+		}
+		dst = append(dst, &v2.Volume{
+			Name: shmVolumeName(v),
+			Type: "temp",
+			Spec: &volumeTempV1{
+				Medium: "memory",
+				Limit:  v2.MemStringorInt(v.ShmSize),
+			},
+		})
+	}
 	if len(dst) == 0 {
 		return nil
 	}
@@ -437,33 +481,23 @@ func convertMounts(src []*v1.VolumeMount) []*v2.Mount {
 	return dst
 }
 
-func convertSettings(src map[string]*v1.Parameter, orgSecrets []string) map[string]interface{} {
+func convertSettings(src map[string]*v1.Parameter, secrets *secretStore, r *report.Report) map[string]interface{} {
 	dst := map[string]interface{}{}
-
-	orgSecretsMap := make(map[string]bool, len(orgSecrets))
-	for _, secret := range orgSecrets {
-		orgSecretsMap[secret] = true
-	}
-
 	for k, v := range src {
 		switch {
 		case v.Secret != "":
-			secretID := sanitizeString(v.Secret)
-			if _, exists := orgSecretsMap[secretID]; exists {
-				secretID = "org." + secretID
-			}
-			dst[k] = fmt.Sprintf("<+secrets.getValue(%q)>", secretID)
+			dst[k] = secrets.expr(v.Secret)
 		case v.Value != nil:
-			dst[k] = convertInterface(v.Value)
+			dst[k] = convertInterface(v.Value, r)
 		}
 	}
 	return dst
 }
 
-func convertInterface(i interface{}) interface{} {
+func convertInterface(i interface{}, r *report.Report) interface{} {
 	switch v := i.(type) {
 	case string:
-		return replaceVars(v)
+		return replaceVars(v, r)
 	case map[interface{}]interface{}:
 		newMap := make(map[string]interface{})
 		for key, value := range v {
@@ -471,131 +505,40 @@ func convertInterface(i interface{}) interface{} {
 			if !ok {
 				continue
 			}
-			newMap[keyStr] = convertInterface(value)
+			newMap[keyStr] = convertInterface(value, r)
 		}
 		return newMap
 	case []interface{}:
 		for i, value := range v {
-			v[i] = convertInterface(value)
+			v[i] = convertInterface(value, r)
 		}
 	}
 	return i
 }
 
-func replaceVars(val string) string {
-	vars := strings.Split(val, " ") // required for combine vars
-
-	for i, v := range vars {
-		if containsReplacement(v) {
-			vars[i] = replaceCharacters(v)
-		} else if containsSubstring(v) {
-			vars[i] = processSubstring(v)
-		} else {
-			// simple variable substitution
-			vars[i] = replaceSimpleVar(v)
-		}
+// replaceVars converts the drone substitution expressions
+// in the string to harness expressions. Expressions that
+// cannot be converted are left as shell variables and
+// added to the report.
+func replaceVars(val string, r *report.Report) string {
+	out, unconverted := substitute(val)
+	for _, v := range unconverted {
+		r.Addf("substitution %q cannot be converted to a harness expression and was left as a shell variable", v)
 	}
-
-	return strings.Join(vars, " ")
-}
-
-func replaceSimpleVar(val string) string {
-	var re = regexp.MustCompile(`\$\$?({)?(\w+)(})?`)
-
-	return re.ReplaceAllStringFunc(val, func(match string) string {
-		varName := strings.Trim(match, "${}$")
-		if harnessVar, ok := variableMap[varName]; ok {
-			return harnessVar
-		}
-		return match
-	})
-}
-
-// Check if variable contains a replacement operation
-func containsReplacement(v string) bool {
-	var re = regexp.MustCompile(`\$\{(\w+)(/|//)([^/]+)/([^}]+)\}`)
-	return re.MatchString(v)
-}
-
-// Perform the replacement operation
-func replaceCharacters(match string) string {
-	// Initialize the regular expression to match "${...}"
-	var re = regexp.MustCompile(`\$\{([^}/]+)(/|//)([^/]+)/([^}]+)\}`)
-
-	return re.ReplaceAllStringFunc(match, func(m string) string {
-		groups := re.FindStringSubmatch(m)
-
-		if len(groups) < 5 {
-			return m
-		}
-
-		varName := groups[1]
-		separator := groups[2]
-		oldChar := strings.ReplaceAll(groups[3], `\\`, `\`) // Replace escaped backslash
-		newChar := strings.ReplaceAll(groups[4], `\/`, `/`) // Replace escaped forward slash
-
-		if strings.HasPrefix(newChar, "/") && len(newChar) > 1 {
-			newChar = strings.TrimPrefix(newChar, "/")
-		}
-
-		if oldChar == "\\" {
-			oldChar = "/"
-		}
-
-		if harnessVar, ok := variableMap[varName]; ok {
-			if separator == "//" {
-				return "<+" + strings.Trim(harnessVar, "<+>") + ".replace('" + oldChar + "', '" + newChar + "')>"
-			} else {
-				return "<+" + strings.Trim(harnessVar, "<+>") + ".replaceFirst('" + oldChar + "', '" + newChar + "')>"
-			}
-		}
-
-		return m
-	})
+	return out
 }
 
-// Check if variable contains a substring operation
-func containsSubstring(v string) bool {
-	var re = regexp.MustCompile(`\$\$?({)?(\w+)((:\d+)?(:\d+)?)?(})?`)
-	return re.MatchString(v)
-}
-
-// Perform the substring operation
-func processSubstring(val string) string {
-	var re = regexp.MustCompile(`\$\$?({)?(\w+)((:\d+)?(:\d+)?)?(})?`)
-
-	return re.ReplaceAllStringFunc(val, func(match string) string {
-		// Remove special characters from match and split on ":"
-		parts := strings.Split(strings.Trim(match, "${}$"), ":")
-
-		varName := parts[0]
-		if harnessVar, ok := variableMap[varName]; ok {
-			// If there are substring operations
-			if len(parts) > 1 {
-				offset := parts[1]
-				length := ""
-				if len(parts) > 2 {
-					length = parts[2]
-				}
-				// Modify the harnessVar to add the substring operation
-				return "<+" + strings.Trim(harnessVar, "<+>") + ".substring(" + offset + "," + length + ")>"
-			}
-			return harnessVar
-		}
-		return match
-	})
-}
-
-func convertScript(src []string) string {
+func convertScript(src []string, r *report.Report) string {
 	if len(src) == 0 {
 		return ""
 	}
 
+	dst := make([]string, len(src))
 	for i, cmd := range src {
-		src[i] = replaceVars(cmd)
+		dst[i] = replaceVars(cmd, r)
 	}
 
-	return strings.Join(src, "\n")
+	return strings.Join(dst, "\n")
 }
 
 func convertArgs(src1, src2 []string) []string {
@@ -632,18 +575,60 @@ func convertShell(src string) string {
 	}
 }
 
-func convertCloneV1(from *v1.Clone) *v2.CloneStageV1 {
-	// If from is nil, set Disabled to true
-	if from == nil {
-		return &v2.CloneStageV1{
+// convertClone converts the clone settings. Cloning is
+// disabled unless the pipeline configures the clone
+// settings, which is the default of the converted stages.
+func convertClone(src v1.Clone) *cloneV1 {
+	if src.Disable || (src.Depth == 0 && src.Retries == 0 && !src.SkipVerify && !src.Trace) {
+		return &cloneV1{
 			Disabled: true,
 		}
 	}
-	return &v2.CloneStageV1{
-		Disabled: from.Disable || true,
+	return &cloneV1{
+		Depth:    src.Depth,
+		Retries:  src.Retries,
+		Insecure: src.SkipVerify,
+		Trace:    src.Trace,
 	}
 }
 
+// convertConcurrency converts the pipeline concurrency limit
+// to a stage concurrency limit, which queues executions that
+// exceed the limit.
+func convertConcurrency(src v1.Concurrency) *concurrencyV1 {
+	if src.Limit <= 0 {
+		return nil
+	}
+	return &concurrencyV1{
+		Limit: src.Limit,
+	}
+}
+
+// convertFailure converts the step failure setting. Drone
+// only supports ignoring the step failure.
+func convertFailure(src *v1.Step, r *report.Report) *v2.FailureList {
+	switch src.Failure {
+	case "":
+		return nil
+	case "ignore":
+		return &v2.FailureList{
+			Items: []*v2.Failure{
+				{
+					Errors: []string{"all"},
+					Action: &v2.FailureAction{
+						Type: "ignore",
+					},
+				},
+			},
+		}
+	default:
+		r.Addf("step %q: unknown failure setting %q", src.Name, src.Failure)
+		return nil
+	}
+}
+
+// convertNode converts the drone node labels, used to route
+// pipelines to specific runners, to delegate selectors.
 func convertNode(src map[string]string) []string {
 	if len(src) == 0 {
 		return nil
@@ -653,28 +638,52 @@ func convertNode(src map[string]string) []string {
 		dst = append(
 			dst, k+":"+v)
 	}
+	sort.Strings(dst)
 	return dst
 }
 
-func convertPlatform(src v1.Platform) *v2.Platform {
-	if src.Arch == "" && src.OS == "" {
+// convertPlatform converts the drone platform to the harness
+// platform. Host-native pipelines are converted to a linux
+// amd64 platform by default, since the host platform is not
+// otherwise known.
+func convertPlatform(src *v1.Pipeline, r *report.Report) *v2.Platform {
+	if src.Platform.Arch == "" && src.Platform.OS == "" && !isHostNative(src) {
 		return nil
 	}
 	dst := new(v2.Platform)
-	switch src.OS {
+	switch src.Platform.OS {
 	case "windows", "win", "win32":
 		dst.Os = v2.OSWindows.String()
 	case "darwin", "macos", "mac":
-		dst.Os = v2.OSDarwin.String()
+		dst.Os = v2.OSMacos.String()
+	case "", "linux":
+		dst.Os = v2.OSLinux.String()
 	default:
+		r.Addf("pipeline %q: unsupported platform os %q, defaulting to linux", src.Name, src.Platform.OS)
 		dst.Os = v2.OSLinux.String()
 	}
-	switch src.Arch {
-	case "arm", "arm64":
+	if src.Type == "macstadium" {
+		dst.Os = v2.OSMacos.String()
+	}
+	switch src.Platform.Arch {
+	case "arm64", "aarch64":
 		dst.Arch = v2.ArchArm64.String()
+	case "arm":
+		// 32-bit arm variants are not supported by harness
+		// and are converted to arm64.
+		if v := src.Platform.Variant; v != "" && v != "v8" {
+			r.Addf("pipeline %q: unsupported platform variant arm/%s, defaulting to arm64", src.Name, v)
+		}
+		dst.Arch = v2.ArchArm64.String()
+	case "", "amd64", "x86_64":
+		dst.Arch = v2.ArchAmd64.String()
 	default:
+		r.Addf("pipeline %q: unsupported platform arch %q, defaulting to amd64", src.Name, src.Platform.Arch)
 		dst.Arch = v2.ArchAmd64.String()
 	}
+	if src.Platform.Version != "" {
+		r.Addf("pipeline %q: platform version %q is not supported", src.Name, src.Platform.Version)
+	}
 	return dst
 }
 
@@ -15,10 +15,16 @@
 package drone
 
 import (
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	v1 "github.com/hunain-avyka/Go-drone/convert/drone/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+	v2 "github.com/hunain-avyka/go-spec/dist/go"
+
 	"github.com/google/go-cmp/cmp"
 	"gopkg.in/yaml.v3"
 )
@@ -29,6 +35,13 @@ func TestConvert(t *testing.T) {
 		t.Error(err)
 		return
 	}
+	// the failure, concurrency and clone options.
+	options, err := filepath.Glob("testdata/options/*.yaml")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	tests = append(tests, options...)
 
 	for _, test := range tests {
 		t.Run(test, func(t *testing.T) {
@@ -173,10 +186,586 @@ func TestReplaceVars(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			output := replaceVars(tt.input)
+			output := replaceVars(tt.input, report.New())
+			if output != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		unconverted []string
+	}{
+		{
+			input:    "${DRONE_TAG=latest}",
+			expected: "<+codebase.tag ?? 'latest'>",
+		},
+		{
+			input:    "${DRONE_TAG:-latest}",
+			expected: "<+codebase.tag ?: 'latest'>",
+		},
+		{
+			input:    "${DRONE_TAG:-${DRONE_COMMIT_SHA:0:8}}",
+			expected: "<+codebase.tag ?: codebase.commitSha.replaceFirst('(?s)^(.{0,8}).*$', '$1')>",
+		},
+		{
+			input:    "${DRONE_TAG##v}",
+			expected: "<+codebase.tag.replaceFirst('^v', '')>",
+		},
+		{
+			input:    "${DRONE_TAG#v*.}",
+			expected: "<+codebase.tag.replaceFirst('^v.*?\\\\.', '')>",
+		},
+		{
+			input:    "${DRONE_BRANCH%%/*}",
+			expected: "<+codebase.branch.replaceFirst('^(.*?)/.*$', '$1')>",
+		},
+		{
+			input:    "${DRONE_BRANCH%/*}",
+			expected: "<+codebase.branch.replaceFirst('^(.*)/.*?$', '$1')>",
+		},
+		{
+			input:    "${DRONE_BRANCH/\\//-}",
+			expected: "<+codebase.branch.replaceFirst('/', '-')>",
+		},
+		{
+			input:    "${DRONE_BRANCH//\\//-}",
+			expected: "<+codebase.branch.replace('/', '-')>",
+		},
+		{
+			input:    "${DRONE_BRANCH/#feature\\//}",
+			expected: "<+codebase.branch.replaceFirst('^feature/', '')>",
+		},
+		{
+			input:    "${DRONE_COMMIT_SHA:0:8}",
+			expected: "<+codebase.commitSha.replaceFirst('(?s)^(.{0,8}).*$', '$1')>",
+		},
+		{
+			input:    "${DRONE_COMMIT_SHA:2:4}",
+			expected: "<+codebase.commitSha.replaceFirst('(?s)^.{0,2}(.{0,4}).*$', '$1')>",
+		},
+		{
+			input:    "${DRONE_COMMIT_SHA: -4}",
+			expected: "<+codebase.commitSha.replaceFirst('(?s)^(?:.*(.{4})|.*)$', '$1')>",
+		},
+		{
+			input:    "${DRONE_COMMIT_SHA:2:-4}",
+			expected: "<+codebase.commitSha.replaceFirst('(?s)^(?:.{2}(.*).{4}|.*)$', '$1')>",
+		},
+		{
+			input:    "${DRONE_COMMIT_SHA: -8:4}",
+			expected: "<+codebase.commitSha.replaceFirst('(?s)^(?:.*?(?=.{8}$)(.{0,4}).*|.*)$', '$1')>",
+		},
+		{
+			input:    "${DRONE_BRANCH^}",
+			expected: "<+codebase.branch.replaceFirst('(?s)^(.).*$', '$1').toUpperCase()><+codebase.branch.replaceFirst('(?s)^.', '')>",
+		},
+		{
+			input:    "${DRONE_BRANCH^^}",
+			expected: "<+codebase.branch.toUpperCase()>",
+		},
+		{
+			input:    "${DRONE_BRANCH,,}",
+			expected: "<+codebase.branch.toLowerCase()>",
+		},
+		{
+			input:    "${#DRONE_BRANCH}",
+			expected: "<+codebase.branch.length()>",
+		},
+		{
+			input:    "v1.${DRONE_BUILD_NUMBER}-${DRONE_COMMIT_SHA:0:7}",
+			expected: "v1.<+pipeline.sequenceId>-<+codebase.commitSha.replaceFirst('(?s)^(.{0,7}).*$', '$1')>",
+		},
+		{
+			input:    "echo $$HOME $${PATH} $$1 $$(date)",
+			expected: "echo $HOME ${PATH} $1 $(date)",
+		},
+		{
+			input:    "${HOME%%/*}",
+			expected: "${HOME%%/*}",
+		},
+		{
+			input:       "${DRONE_BUILD_EVENT,,}",
+			expected:    "${DRONE_BUILD_EVENT,,}",
+			unconverted: []string{"${DRONE_BUILD_EVENT,,}"},
+		},
+		{
+			input:       "${DRONE_TAG:-v${DRONE_BUILD_NUMBER}}",
+			expected:    "${DRONE_TAG:-v${DRONE_BUILD_NUMBER}}",
+			unconverted: []string{"${DRONE_TAG:-v${DRONE_BUILD_NUMBER}}"},
+		},
+		{
+			input:       "${DRONE_COMMIT_SHA:x}",
+			expected:    "${DRONE_COMMIT_SHA:x}",
+			unconverted: []string{"${DRONE_COMMIT_SHA:x}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			output, unconverted := substitute(tt.input)
 			if output != tt.expected {
 				t.Errorf("Expected %q, got %q", tt.expected, output)
 			}
+			if diff := cmp.Diff(tt.unconverted, unconverted); diff != "" {
+				t.Errorf("Unexpected unconverted expressions")
+				t.Log(diff)
+			}
+		})
+	}
+}
+
+func TestConvertTrigger(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger v1.Conditions
+		eval    string
+		status  string
+		notes   int
+	}{
+		{
+			name:    "empty",
+			trigger: v1.Conditions{},
+		},
+		{
+			name: "branch include",
+			trigger: v1.Conditions{
+				Branch: v1.Condition{Include: []string{"main", "feature/*"}},
+			},
+			eval: `(<+codebase.branch> == "main" || <+codebase.branch> =~ "^feature/[^/]*$")`,
+		},
+		{
+			name: "branch exclude",
+			trigger: v1.Conditions{
+				Branch: v1.Condition{Exclude: []string{"main", "dev-*"}},
+			},
+			eval: `<+codebase.branch> != "main" && !(<+codebase.branch> =~ "^dev-[^/]*$")`,
+		},
+		{
+			name: "event include",
+			trigger: v1.Conditions{
+				Event: v1.Condition{Include: []string{"tag"}},
+			},
+			eval: `<+trigger.payload.ref> =^ "refs/tags/"`,
+		},
+		{
+			name: "event push",
+			trigger: v1.Conditions{
+				Event: v1.Condition{Include: []string{"push", "cron"}},
+			},
+			eval:  `<+trigger.event> == "PUSH" && !(<+trigger.payload.ref> =^ "refs/tags/")`,
+			notes: 1,
+		},
+		{
+			name: "event push exclude",
+			trigger: v1.Conditions{
+				Event: v1.Condition{Exclude: []string{"push"}},
+			},
+			eval: `(<+trigger.event> != "PUSH" || <+trigger.payload.ref> =^ "refs/tags/")`,
+		},
+		{
+			name: "event exclude",
+			trigger: v1.Conditions{
+				Event: v1.Condition{Exclude: []string{"pull_request"}},
+			},
+			eval: `<+trigger.event> != "PR"`,
+		},
+		{
+			name: "status",
+			trigger: v1.Conditions{
+				Status: v1.Condition{Include: []string{"success", "failure"}},
+			},
+			status: "all",
+		},
+		{
+			name: "status exclude",
+			trigger: v1.Conditions{
+				Status: v1.Condition{Exclude: []string{"success"}},
+			},
+			status: "failure",
+		},
+		{
+			name: "trigger only",
+			trigger: v1.Conditions{
+				Cron:   v1.Condition{Include: []string{"nightly"}},
+				Target: v1.Condition{Include: []string{"production"}},
+				Event:  v1.Condition{Include: []string{"promote"}},
+			},
+			eval:  "false",
+			notes: 4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := report.New()
+			got := convertTrigger(&v1.Pipeline{Name: "default", Trigger: test.trigger}, r)
+
+			var eval, status string
+			if got != nil {
+				eval = got.Eval
+				if len(got.Cond) != 0 {
+					status = got.Cond[0]["status"].Eq
+				}
+			}
+			if eval != test.eval {
+				t.Errorf("Want eval %q, got %q", test.eval, eval)
+			}
+			if status != test.status {
+				t.Errorf("Want status %q, got %q", test.status, status)
+			}
+			if got, want := len(r.Notes()), test.notes; got != want {
+				t.Errorf("Want %d notes, got %d", want, got)
+			}
 		})
 	}
 }
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := map[string]string{
+		"feature/*":      `^feature/[^/]*$`,
+		"refs/tags/**":   `^refs/tags/.*$`,
+		"v1.?":           `^v1\.[^/]$`,
+		"release-[0-9]*": `^release-[0-9][^/]*$`,
+		"[!a]*":          `^[^a][^/]*$`,
+	}
+	for pattern, want := range tests {
+		if got := globToRegexp(pattern); got != want {
+			t.Errorf("Want pattern %q converted to %q, got %q", pattern, want, got)
+		}
+	}
+}
+
+func TestConvertSignature(t *testing.T) {
+	// the signature document is excluded when calculating
+	// the signature, so the hmac value can be left blank.
+	template := "---\nkind: pipeline\nname: default\n\nsteps:\n- name: test\n  image: golang\n  commands:\n  - go test\n\n---\nkind: signature\nhmac: %s\n\n...\n"
+	signature := sign([]byte(fmt.Sprintf(template, "")), "correct-horse-battery-staple")
+	signed := fmt.Sprintf(template, signature)
+
+	if _, err := New(WithSigningKey("correct-horse-battery-staple")).ConvertString(signed); err != nil {
+		t.Errorf("Want signature verified, got error %s", err)
+	}
+	if _, err := New(WithSigningKey("incorrect")).ConvertString(signed); err != ErrSignature {
+		t.Errorf("Want signature error, got %v", err)
+	}
+
+	// the signature is ignored, with a note, when no
+	// signing key is provided.
+	out, err := New().ConvertString(signed)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.HasPrefix(string(out), "# conversion notes:\n# - signature document ignored") {
+		t.Errorf("Want signature note, got %s", out)
+	}
+}
+
+func TestVerifyDroneSignature(t *testing.T) {
+	// the fixture and key are from the drone yaml signer
+	// tests, and the signature was calculated by drone.
+	data, err := ioutil.ReadFile("testdata/signature/signed.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "589396227fff5a93ba934965e8735f88"
+	if got, want := sign(data, key), "389cf92a7472870783a9a5ea77b4abe58a4bb67ba58e1e7293e943aee314aedc"; got != want {
+		t.Errorf("Want signature %q, got %q", want, got)
+	}
+	if !verify(data, key, "389cf92a7472870783a9a5ea77b4abe58a4bb67ba58e1e7293e943aee314aedc") {
+		t.Errorf("Want drone signature verified")
+	}
+	if verify(data, "c953bd41ad0f75848a78ccd54d3861fa", "389cf92a7472870783a9a5ea77b4abe58a4bb67ba58e1e7293e943aee314aedc") {
+		t.Errorf("Want drone signature rejected with the wrong key")
+	}
+}
+
+func TestExternalSecretID(t *testing.T) {
+	tests := []struct {
+		path, name, want string
+	}{
+		{"secret/data/docker", "username", "secret_data_docker_username"},
+		{"/prod/db-credentials", "password", "prod_db_credentials_password"},
+		{"docker", "", "docker"},
+		{"1password/docker", "token", "_1password_docker_token"},
+	}
+	for _, test := range tests {
+		if got := externalSecretID(test.path, test.name); got != test.want {
+			t.Errorf("Want secret identifier %q, got %q", test.want, got)
+		}
+	}
+}
+
+func TestConvertKubernetes(t *testing.T) {
+	d := New(WithKubernetes("ci", "account.kubernetes"))
+
+	// the WithKubernetes defaults are used when the
+	// pipeline does not specify a namespace.
+	src := &v1.Pipeline{Name: "default", Type: "docker"}
+	runtime, ok := d.convertRuntime(src, report.New()).(*v2.Runtime)
+	if !ok {
+		t.Errorf("Want kubernetes runtime")
+		return
+	}
+	want := &v2.Runtime{
+		Type: "kubernetes",
+		Spec: &runtimeKubeV1{
+			Connector: "account.kubernetes",
+			Namespace: "ci",
+		},
+	}
+	if diff := cmp.Diff(want, runtime); diff != "" {
+		t.Errorf("Unexpected kubernetes runtime")
+		t.Log(diff)
+	}
+
+	// the pipeline namespace and node name take
+	// precedence over the defaults.
+	src = &v1.Pipeline{
+		Name:     "default",
+		Type:     "kubernetes",
+		NodeName: "node-1",
+		Metadata: v1.Metadata{Namespace: "builds"},
+		Resource: v1.Resources{
+			Requests: v1.ResourceLimits{CPU: 250, Memory: 1024},
+		},
+	}
+	r := report.New()
+	runtime = convertKubernetes(src, "ci", "", r)
+	want = &v2.Runtime{
+		Type: "kubernetes",
+		Spec: &runtimeKubeV1{
+			Namespace:    "builds",
+			NodeSelector: map[string]string{"kubernetes.io/hostname": "node-1"},
+			Resources: &resourcesV1{
+				Requests: &resourceV1{Cpu: "250m", Memory: 1024},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, runtime); diff != "" {
+		t.Errorf("Unexpected kubernetes runtime")
+		t.Log(diff)
+	}
+	if got, want := len(r.Notes()), 1; got != want {
+		t.Errorf("Want %d connector note, got %d", want, got)
+	}
+}
+
+func TestConvertPlatform(t *testing.T) {
+	tests := []struct {
+		pipeline v1.Pipeline
+		want     *v2.Platform
+		notes    int
+	}{
+		{
+			pipeline: v1.Pipeline{Type: "docker"},
+			want:     nil,
+		},
+		{
+			pipeline: v1.Pipeline{Type: "exec"},
+			want:     &v2.Platform{Os: "linux", Arch: "amd64"},
+		},
+		{
+			pipeline: v1.Pipeline{Platform: v1.Platform{OS: "linux", Arch: "arm64"}},
+			want:     &v2.Platform{Os: "linux", Arch: "arm64"},
+		},
+		{
+			pipeline: v1.Pipeline{Platform: v1.Platform{OS: "darwin", Arch: "amd64"}},
+			want:     &v2.Platform{Os: "macos", Arch: "amd64"},
+		},
+		{
+			pipeline: v1.Pipeline{Type: "macstadium"},
+			want:     &v2.Platform{Os: "macos", Arch: "amd64"},
+		},
+		{
+			pipeline: v1.Pipeline{Platform: v1.Platform{OS: "windows", Arch: "amd64", Version: "1809"}},
+			want:     &v2.Platform{Os: "windows", Arch: "amd64"},
+			notes:    1,
+		},
+		{
+			pipeline: v1.Pipeline{Platform: v1.Platform{OS: "linux", Arch: "arm", Variant: "v8"}},
+			want:     &v2.Platform{Os: "linux", Arch: "arm64"},
+		},
+		{
+			pipeline: v1.Pipeline{Platform: v1.Platform{OS: "linux", Arch: "arm", Variant: "v7"}},
+			want:     &v2.Platform{Os: "linux", Arch: "arm64"},
+			notes:    1,
+		},
+		{
+			pipeline: v1.Pipeline{Platform: v1.Platform{OS: "freebsd", Arch: "386"}},
+			want:     &v2.Platform{Os: "linux", Arch: "amd64"},
+			notes:    2,
+		},
+	}
+	for _, test := range tests {
+		r := report.New()
+		got := convertPlatform(&test.pipeline, r)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Unexpected platform for %+v", test.pipeline.Platform)
+			t.Log(diff)
+		}
+		if got, want := len(r.Notes()), test.notes; got != want {
+			t.Errorf("Want %d notes for %+v, got %d", want, test.pipeline.Platform, got)
+		}
+	}
+}
+
+func TestDetermineRuntime(t *testing.T) {
+	tests := []struct {
+		pipeline v1.Pipeline
+		want     string
+		notes    int
+	}{
+		{pipeline: v1.Pipeline{}, want: "cloud"},
+		{pipeline: v1.Pipeline{Type: "docker"}, want: "cloud"},
+		{pipeline: v1.Pipeline{Type: "docker", Node: map[string]string{"pool": "gpu"}}, want: "machine"},
+		{pipeline: v1.Pipeline{Type: "exec"}, want: "machine"},
+		{pipeline: v1.Pipeline{Type: "ssh"}, want: "machine", notes: 1},
+		{pipeline: v1.Pipeline{Type: "digitalocean"}, want: "cloud"},
+		{pipeline: v1.Pipeline{Type: "docker", Runtime: "vm"}, want: "vm"},
+	}
+	for _, test := range tests {
+		r := report.New()
+		if got := determineRuntime(&test.pipeline, r); got != test.want {
+			t.Errorf("Want runtime %q for type %q, got %q", test.want, test.pipeline.Type, got)
+		}
+		if got, want := len(r.Notes()), test.notes; got != want {
+			t.Errorf("Want %d notes for type %q, got %d", want, test.pipeline.Type, got)
+		}
+	}
+}
+
+func TestPluginName(t *testing.T) {
+	tests := []struct {
+		image, want string
+	}{
+		{"plugins/docker", "plugins/docker"},
+		{"plugins/docker:20", "plugins/docker"},
+		{"docker.io/plugins/s3-cache:1.4", "plugins/s3-cache"},
+		{"localhost:5000/plugins/docker", "localhost:5000/plugins/docker"},
+	}
+	for _, test := range tests {
+		if got := pluginName(test.image); got != test.want {
+			t.Errorf("Want plugin name %q, got %q", test.want, got)
+		}
+	}
+}
+
+func TestConvertNativePlugin_Kept(t *testing.T) {
+	for _, image := range []string{"plugins/slack", "plugins/github-release:1", "plugins/manifest", "plugins/downstream"} {
+		if got := New().convertNativePlugin(&v1.Step{Name: "plugin", Image: image}, nil, report.New()); got != nil {
+			t.Errorf("Want plugin step kept for %s", image)
+		}
+	}
+}
+
+func TestConvertNativePlugin_Environment(t *testing.T) {
+	step := &v1.Step{
+		Name:        "upload",
+		Image:       "plugins/s3",
+		Settings:    map[string]*v1.Parameter{"bucket": {Value: "my-bucket"}},
+		Environment: map[string]*v1.Variable{"AWS_REGION": {Value: "us-east-1"}},
+	}
+	r := report.New()
+	if got := New().convertNativePlugin(step, nil, r); got == nil {
+		t.Fatalf("Want native step")
+	}
+	if got, want := r.Notes()[0], `step "upload": environment variables AWS_REGION are not supported by the native s3Upload step`; got != want {
+		t.Errorf("Want note %q, got %q", want, got)
+	}
+}
+
+func TestConvertPluginSettings(t *testing.T) {
+	step := &v1.Step{
+		Name:  "notify",
+		Image: "plugins/slack:1",
+		Settings: map[string]*v1.Parameter{
+			"webhook": {Value: "https://hooks.slack.com/services/T00/B00/XXX"},
+			"channel": {Value: "builds"},
+			"color":   {Value: "good"},
+		},
+	}
+	r := report.New()
+	want := map[string]interface{}{
+		"webhook": "https://hooks.slack.com/services/T00/B00/XXX",
+		"channel": "builds",
+	}
+	if diff := cmp.Diff(want, convertPluginSettings(step, nil, r)); diff != "" {
+		t.Errorf("Unexpected plugin settings")
+		t.Log(diff)
+	}
+	// the notification note, the removed color setting
+	// and the webhook credential.
+	if got := len(r.Notes()); got != 3 {
+		t.Errorf("Want 3 notes, got %d", got)
+	}
+}
+
+func TestConvertS3CachePlugin(t *testing.T) {
+	tests := []struct {
+		with map[string]interface{}
+		want string
+	}{
+		{with: map[string]interface{}{"rebuild": true}, want: "saveCacheS3"},
+		{with: map[string]interface{}{"rebuild": "true"}, want: "saveCacheS3"},
+		{with: map[string]interface{}{"restore": "true"}, want: "restoreCacheS3"},
+		{with: map[string]interface{}{"restore": "false"}, want: ""},
+		{with: map[string]interface{}{"flush": true}, want: ""},
+	}
+	for _, test := range tests {
+		var got string
+		if with := convertS3CachePlugin(test.with); with != nil {
+			got, _ = with["uses"].(string)
+		}
+		if got != test.want {
+			t.Errorf("Want step %q for %v, got %q", test.want, test.with, got)
+		}
+	}
+}
+
+func TestConvertPluginConnector(t *testing.T) {
+	step := &v1.Step{Name: "publish", Image: "plugins/docker"}
+	plugin := nativePlugins["plugins/docker"]
+
+	// the docker connector is used for docker hub.
+	d := New(WithDockerhub("account.docker"))
+	r := report.New()
+	if got, want := d.convertPluginConnector(step, plugin, map[string]interface{}{}, r), "account.docker"; got != want {
+		t.Errorf("Want connector %q, got %q", want, got)
+	}
+	if got := len(r.Notes()); got != 0 {
+		t.Errorf("Want no notes, got %d", got)
+	}
+
+	// the connector is a runtime input for other registries.
+	r = report.New()
+	if got, want := d.convertPluginConnector(step, plugin, map[string]interface{}{"registry": "quay.io"}, r), "<+input>"; got != want {
+		t.Errorf("Want connector %q, got %q", want, got)
+	}
+	if got := len(r.Notes()); got != 1 {
+		t.Errorf("Want connector note, got %d notes", got)
+	}
+}
+
+func TestConvertClone(t *testing.T) {
+	tests := []struct {
+		clone v1.Clone
+		want  *cloneV1
+	}{
+		{clone: v1.Clone{}, want: &cloneV1{Disabled: true}},
+		{clone: v1.Clone{Disable: true, Depth: 50}, want: &cloneV1{Disabled: true}},
+		{clone: v1.Clone{Depth: 50}, want: &cloneV1{Depth: 50}},
+		{clone: v1.Clone{Retries: 3, SkipVerify: true}, want: &cloneV1{Retries: 3, Insecure: true}},
+	}
+	for _, test := range tests {
+		if diff := cmp.Diff(test.want, convertClone(test.clone)); diff != "" {
+			t.Errorf("Unexpected clone settings for %+v", test.clone)
+			t.Log(diff)
+		}
+	}
+}
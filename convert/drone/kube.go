@@ -0,0 +1,152 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	"fmt"
+
+	v1 "github.com/hunain-avyka/Go-drone/convert/drone/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+
+	v2 "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// convertKubernetes converts the kubernetes runner settings
+// of the drone pipeline to a harness kubernetes runtime. The
+// namespace and connector are the defaults configured with
+// the WithKubernetes option.
+func convertKubernetes(src *v1.Pipeline, namespace, connector string, r *report.Report) *v2.Runtime {
+	// the pipeline namespace takes precedence over the
+	// default namespace.
+	if src.Metadata.Namespace != "" {
+		namespace = src.Metadata.Namespace
+	}
+	if connector == "" {
+		r.Addf("pipeline %q: kubernetes runtime requires a harness kubernetes connector", src.Name)
+	}
+
+	spec := &runtimeKubeV1{
+		Connector:      connector,
+		Namespace:      namespace,
+		ServiceAccount: src.ServiceAccount,
+		NodeSelector:   convertNodeSelector(src.NodeSelector, src.NodeName),
+		Tolerations:    convertTolerations(src.Tolerations),
+		Labels:         src.Metadata.Labels,
+		Annotations:    src.Metadata.Annotations,
+		HostAliases:    convertHostAliases(src.HostAliases),
+		DnsConfig:      convertDnsConfig(src.DnsConfig),
+		Resources:      convertPodResources(src.Resource),
+	}
+	return &v2.Runtime{
+		Type: "kubernetes",
+		Spec: spec,
+	}
+}
+
+// convertNodeSelector returns the node selector. Harness
+// cannot schedule the pod to a named node, so the node name
+// is converted to a hostname selector.
+func convertNodeSelector(src map[string]string, nodeName string) map[string]string {
+	if len(src) == 0 && nodeName == "" {
+		return nil
+	}
+	dst := map[string]string{}
+	for k, v := range src {
+		dst[k] = v
+	}
+	if nodeName != "" {
+		dst["kubernetes.io/hostname"] = nodeName
+	}
+	return dst
+}
+
+func convertTolerations(src []v1.Toleration) []*tolerationV1 {
+	var dst []*tolerationV1
+	for _, v := range src {
+		dst = append(dst, &tolerationV1{
+			Effect:            v.Effect,
+			Key:               v.Key,
+			Operator:          v.Operator,
+			TolerationSeconds: v.TolerationSeconds,
+			Value:             v.Value,
+		})
+	}
+	return dst
+}
+
+func convertHostAliases(src []v1.HostAlias) []*hostAliasV1 {
+	var dst []*hostAliasV1
+	for _, v := range src {
+		if v.IP == "" || len(v.Hostnames) == 0 {
+			continue
+		}
+		dst = append(dst, &hostAliasV1{
+			IP:        v.IP,
+			Hostnames: v.Hostnames,
+		})
+	}
+	return dst
+}
+
+func convertDnsConfig(src v1.DnsConfig) *dnsConfigV1 {
+	if len(src.Nameservers) == 0 && len(src.Searches) == 0 && len(src.Options) == 0 {
+		return nil
+	}
+	dst := &dnsConfigV1{
+		Nameservers: src.Nameservers,
+		Searches:    src.Searches,
+	}
+	for _, v := range src.Options {
+		dst.Options = append(dst.Options, &dnsOptionV1{
+			Name:  v.Name,
+			Value: v.Value,
+		})
+	}
+	return dst
+}
+
+// convertPodResources converts the pod resource requests
+// and limits. Drone expresses cpu in millicpu and memory in
+// bytes.
+func convertPodResources(src v1.Resources) *resourcesV1 {
+	limits := convertResource(src.Limits)
+	requests := convertResource(src.Requests)
+	if limits == nil && requests == nil {
+		return nil
+	}
+	return &resourcesV1{
+		Limits:   limits,
+		Requests: requests,
+	}
+}
+
+func convertResource(src v1.ResourceLimits) *resourceV1 {
+	if src.CPU == 0 && src.Memory == 0 {
+		return nil
+	}
+	dst := &resourceV1{
+		Memory: v2.MemStringorInt(src.Memory),
+	}
+	// the cpu is converted to a millicpu quantity, so
+	// fractional cores are not rounded up.
+	switch {
+	case src.CPU == 0:
+	case src.CPU%1000 == 0:
+		dst.Cpu = fmt.Sprint(src.CPU / 1000)
+	default:
+		dst.Cpu = fmt.Sprintf("%dm", src.CPU)
+	}
+	return dst
+}
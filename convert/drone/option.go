@@ -40,3 +40,12 @@ func WithOrgSecrets(secrets ...string) Option {
 		d.orgSecrets = secrets
 	}
 }
+
+// WithSigningKey returns an option to set the key used to
+// verify the pipeline signature. If the key is empty, the
+// signature document is ignored.
+func WithSigningKey(key string) Option {
+	return func(d *Converter) {
+		d.signingKey = key
+	}
+}
@@ -20,6 +20,7 @@ func TestOptions(t *testing.T) {
 	p := New(
 		WithDockerhub("account.docker"),
 		WithKubernetes("namespace", "connector.kubernetes"),
+		WithSigningKey("correct-horse-battery-staple"),
 	)
 
 	if got, want := p.kubeConnector, "connector.kubernetes"; got != want {
@@ -34,6 +35,9 @@ func TestOptions(t *testing.T) {
 	if got, want := p.dockerhubConn, "account.docker"; got != want {
 		t.Errorf("Want docker connector %q, got %q", want, got)
 	}
+	if got, want := p.signingKey, "correct-horse-battery-staple"; got != want {
+		t.Errorf("Want signing key %q, got %q", want, got)
+	}
 }
 
 func TestOptions_Defaults(t *testing.T) {
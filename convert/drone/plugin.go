@@ -0,0 +1,494 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "github.com/hunain-avyka/Go-drone/convert/drone/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+
+	v2 "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// nativePlugin defines the conversion of a well-known drone
+// plugin to a native harness step.
+type nativePlugin struct {
+	// uses is the native harness step.
+	uses string
+
+	// connector is the type of harness connector that
+	// replaces the plugin credentials.
+	connector string
+
+	// settings lists the plugin settings supported by
+	// the native step.
+	settings []string
+
+	// convert converts the plugin settings to the native
+	// step inputs. It returns nil if the settings cannot
+	// be converted, in which case the plugin step is used.
+	convert func(with map[string]interface{}) map[string]interface{}
+}
+
+// nativePlugins maps well-known drone plugin images to
+// native harness steps.
+var nativePlugins = map[string]*nativePlugin{
+	"plugins/docker": {
+		uses:      "buildAndPushDockerRegistry",
+		connector: "docker",
+		settings:  []string{"repo", "registry", "tags", "dockerfile", "context", "target", "build_args", "custom_labels"},
+		convert:   convertDockerPlugin,
+	},
+	"plugins/kaniko": {
+		uses:      "buildAndPushDockerRegistry",
+		connector: "docker",
+		settings:  []string{"repo", "registry", "tags", "dockerfile", "context", "target", "build_args", "custom_labels"},
+		convert:   convertDockerPlugin,
+	},
+	"plugins/ecr": {
+		uses:      "buildAndPushECR",
+		connector: "aws",
+		settings:  []string{"repo", "registry", "region", "tags", "dockerfile", "context", "target", "build_args"},
+		convert:   convertECRPlugin,
+	},
+	"plugins/gcr": {
+		uses:      "buildAndPushGCR",
+		connector: "gcp",
+		settings:  []string{"repo", "registry", "tags", "dockerfile", "context", "target", "build_args"},
+		convert:   convertGCRPlugin,
+	},
+	"plugins/s3": {
+		uses:      "s3Upload",
+		connector: "aws",
+		settings:  []string{"bucket", "region", "endpoint", "source", "target"},
+		convert:   convertS3Plugin,
+	},
+	"plugins/s3-cache": {
+		connector: "aws",
+		settings:  []string{"root", "path", "region", "endpoint", "mount", "rebuild", "restore"},
+		convert:   convertS3CachePlugin,
+	},
+	"plugins/gcs": {
+		uses:      "gcsUpload",
+		connector: "gcp",
+		settings:  []string{"source", "target"},
+		convert:   convertGCSPlugin,
+	},
+}
+
+// pluginStep defines the conversion of a well-known drone
+// plugin that harness executes as a plugin step.
+type pluginStep struct {
+	// settings lists the plugin settings supported by
+	// harness.
+	settings []string
+
+	// secrets lists the plugin settings that must be
+	// sourced from a secret.
+	secrets []string
+
+	// note describes the manual changes required after
+	// conversion, if any.
+	note string
+}
+
+// pluginSteps maps well-known drone plugin images without a
+// native harness equivalent to plugin steps.
+var pluginSteps = map[string]*pluginStep{
+	"plugins/downstream": {
+		settings: []string{"server", "token", "repositories", "fork", "wait", "timeout", "last_successful", "params", "params_from_env", "deploy"},
+		secrets:  []string{"token"},
+		note:     "downstream triggers builds on the drone server, use a harness pipeline chain or trigger instead",
+	},
+	"plugins/github-release": {
+		settings: []string{"api_key", "files", "file_exists", "checksum", "checksum_file", "checksum_flatten", "draft", "prerelease", "base_url", "upload_url", "title", "note", "overwrite"},
+		secrets:  []string{"api_key"},
+	},
+	"plugins/manifest": {
+		settings: []string{"username", "password", "spec", "target", "template", "platforms", "ignore_missing", "auto_tag", "auto_tag_suffix", "insecure"},
+		secrets:  []string{"password"},
+	},
+	"plugins/slack": {
+		settings: []string{"webhook", "channel", "recipient", "username", "template", "fallback", "icon_url", "icon_emoji", "image_url", "link_names"},
+		secrets:  []string{"webhook"},
+		note:     "slack notifications can also be configured as harness pipeline notification rules",
+	},
+}
+
+// credentialSettings lists the plugin settings that provide
+// credentials, which are replaced by a harness connector.
+var credentialSettings = []string{
+	"access_key",
+	"json_key",
+	"password",
+	"secret_key",
+	"token",
+	"username",
+}
+
+// convertNativePlugin converts the plugin step to a native
+// harness step. It returns nil if the plugin does not have a
+// native harness equivalent.
+func (d *Converter) convertNativePlugin(src *v1.Step, secrets *secretStore, r *report.Report) *stepV1 {
+	plugin, ok := nativePlugins[pluginName(src.Image)]
+	if !ok {
+		return nil
+	}
+
+	settings := convertSettings(src.Settings, secrets, r)
+	for _, k := range credentialSettings {
+		delete(settings, k)
+	}
+	with := plugin.convert(settings)
+	if with == nil {
+		return nil
+	}
+
+	uses := plugin.uses
+	if uses == "" {
+		// the cache plugin converts to a save or restore
+		// step depending on the settings.
+		uses, _ = with["uses"].(string)
+		delete(with, "uses")
+	}
+
+	for _, k := range sortedKeys(settings) {
+		if !contains(plugin.settings, k) {
+			r.Addf("step %q: setting %q is not supported by the native %s step", src.Name, k, uses)
+		}
+	}
+
+	// the native steps do not accept environment variables,
+	// which are typically used to configure the plugin.
+	if len(src.Environment) != 0 {
+		r.Addf("step %q: environment variables %s are not supported by the native %s step", src.Name, strings.Join(sortedVariables(src.Environment), ", "), uses)
+	}
+
+	with["connector"] = d.convertPluginConnector(src, plugin, settings, r)
+	return &stepV1{
+		StepV1: &v2.StepV1{
+			Name: src.Name,
+		},
+		Template: &templateV1{
+			Uses: uses,
+			With: with,
+		},
+	}
+}
+
+// convertPluginSettings converts the settings of a plugin
+// step. The settings of well-known plugins are limited to
+// the settings supported by harness, and credentials must be
+// sourced from secrets.
+func convertPluginSettings(src *v1.Step, secrets *secretStore, r *report.Report) map[string]interface{} {
+	settings := convertSettings(src.Settings, secrets, r)
+	plugin, ok := pluginSteps[pluginName(src.Image)]
+	if !ok {
+		return settings
+	}
+	if plugin.note != "" {
+		r.Addf("step %q: %s", src.Name, plugin.note)
+	}
+	for _, k := range sortedKeys(settings) {
+		switch {
+		case !contains(plugin.settings, k):
+			r.Addf("step %q: setting %q is not supported by the %s plugin and is removed", src.Name, k, pluginName(src.Image))
+			delete(settings, k)
+		case contains(plugin.secrets, k) && src.Settings[k].Secret == "":
+			r.Addf("step %q: setting %q contains a credential, store it as a harness secret", src.Name, k)
+		}
+	}
+	return settings
+}
+
+// convertPluginConnector returns the connector that replaces
+// the plugin credentials. The docker connector is used for
+// docker hub, if configured. Otherwise the connector is a
+// runtime input and a note is added to the report.
+func (d *Converter) convertPluginConnector(src *v1.Step, plugin *nativePlugin, settings map[string]interface{}, r *report.Report) string {
+	if plugin.connector == "docker" && d.dockerhubConn != "" && isDockerhub(settings) {
+		return d.dockerhubConn
+	}
+
+	var names []string
+	for _, k := range credentialSettings {
+		if p, ok := src.Settings[k]; ok && p.Secret != "" {
+			names = append(names, p.Secret)
+		}
+	}
+	if len(names) == 0 {
+		r.Addf("step %q: select a harness %s connector", src.Name, plugin.connector)
+	} else {
+		r.Addf("step %q: select a harness %s connector with the credentials from secrets %s", src.Name, plugin.connector, strings.Join(names, ", "))
+	}
+	return "<+input>"
+}
+
+func convertDockerPlugin(with map[string]interface{}) map[string]interface{} {
+	dst := map[string]interface{}{}
+	copySettings(dst, with, "repo", "dockerfile", "context", "target")
+	if tags := convertTags(with); tags != nil {
+		dst["tags"] = tags
+	}
+	if args := convertBuildArgs(with["build_args"]); args != nil {
+		dst["build_args"] = args
+	}
+	if labels := convertBuildArgs(with["custom_labels"]); labels != nil {
+		dst["labels"] = labels
+	}
+	// the registry is only required for registries other
+	// than docker hub, which are resolved by the connector.
+	if !isDockerhub(with) {
+		dst["registry"] = with["registry"]
+	}
+	return dst
+}
+
+func convertECRPlugin(with map[string]interface{}) map[string]interface{} {
+	dst := map[string]interface{}{}
+	copySettings(dst, with, "region", "dockerfile", "context", "target")
+
+	// the registry is formatted as <account>.dkr.ecr.<region>.amazonaws.com
+	// and may be included in the repository name.
+	registry, _ := with["registry"].(string)
+	repo, _ := with["repo"].(string)
+	if registry == "" {
+		if i := strings.Index(repo, "/"); i != -1 && strings.Contains(repo[:i], ".dkr.ecr.") {
+			registry = repo[:i]
+		}
+	}
+	repo = strings.TrimPrefix(repo, registry+"/")
+	if registry != "" {
+		dst["account"] = strings.Split(registry, ".")[0]
+	}
+	dst["image_name"] = repo
+
+	if tags := convertTags(with); tags != nil {
+		dst["tags"] = tags
+	}
+	if args := convertBuildArgs(with["build_args"]); args != nil {
+		dst["build_args"] = args
+	}
+	return dst
+}
+
+func convertGCRPlugin(with map[string]interface{}) map[string]interface{} {
+	dst := map[string]interface{}{}
+	copySettings(dst, with, "dockerfile", "context", "target")
+
+	// the repository is formatted as [registry/]project/image
+	// and the registry defaults to gcr.io.
+	registry, _ := with["registry"].(string)
+	if registry == "" {
+		registry = "gcr.io"
+	}
+	repo, _ := with["repo"].(string)
+	repo = strings.TrimPrefix(repo, registry+"/")
+	if i := strings.Index(repo, "/"); i != -1 {
+		dst["project_id"] = repo[:i]
+		repo = repo[i+1:]
+	}
+	dst["host"] = registry
+	dst["image_name"] = repo
+
+	if tags := convertTags(with); tags != nil {
+		dst["tags"] = tags
+	}
+	if args := convertBuildArgs(with["build_args"]); args != nil {
+		dst["build_args"] = args
+	}
+	return dst
+}
+
+func convertS3Plugin(with map[string]interface{}) map[string]interface{} {
+	dst := map[string]interface{}{}
+	copySettings(dst, with, "bucket", "region", "endpoint", "target")
+	if source, ok := with["source"]; ok {
+		dst["source_paths"] = []interface{}{source}
+	}
+	return dst
+}
+
+func convertS3CachePlugin(with map[string]interface{}) map[string]interface{} {
+	dst := map[string]interface{}{}
+	copySettings(dst, with, "region", "endpoint")
+	if root, ok := with["root"]; ok {
+		dst["bucket"] = root
+	}
+	if path, ok := with["path"]; ok {
+		dst["key"] = path
+	} else {
+		dst["key"] = "<+codebase.repoUrl>/<+codebase.branch>"
+	}
+	switch {
+	case isTrue(with["rebuild"]):
+		dst["uses"] = "saveCacheS3"
+		if mount, ok := with["mount"]; ok {
+			dst["source_paths"] = mount
+		}
+	case isTrue(with["restore"]):
+		dst["uses"] = "restoreCacheS3"
+	default:
+		// flushing the cache has no native equivalent.
+		return nil
+	}
+	return dst
+}
+
+func convertGCSPlugin(with map[string]interface{}) map[string]interface{} {
+	dst := map[string]interface{}{}
+	if source, ok := with["source"]; ok {
+		dst["source_paths"] = []interface{}{source}
+	}
+	// the target is formatted as bucket/path.
+	target, _ := with["target"].(string)
+	parts := strings.SplitN(strings.TrimPrefix(target, "/"), "/", 2)
+	dst["bucket"] = parts[0]
+	if len(parts) == 2 {
+		dst["target"] = parts[1]
+	}
+	return dst
+}
+
+// pluginName returns the plugin image name without the
+// docker hub registry and the tag.
+func pluginName(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	image = strings.TrimPrefix(image, "index.docker.io/")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// isDockerhub returns true if the plugin settings do not
+// specify a registry other than docker hub.
+func isDockerhub(with map[string]interface{}) bool {
+	registry, _ := with["registry"].(string)
+	switch registry {
+	case "", "docker.io", "index.docker.io", "https://index.docker.io/v1/":
+		return true
+	default:
+		return false
+	}
+}
+
+// copySettings copies the named settings, if set.
+func copySettings(dst, src map[string]interface{}, keys ...string) {
+	for _, k := range keys {
+		if v, ok := src[k]; ok {
+			dst[k] = v
+		}
+	}
+}
+
+// convertTags returns the image tags, which drone accepts
+// as a list or a comma-separated string.
+func convertTags(with map[string]interface{}) []interface{} {
+	var dst []interface{}
+	switch v := with["tags"].(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				dst = append(dst, s)
+			}
+		}
+	case []interface{}:
+		dst = v
+	case nil:
+		// drone tags the image as latest by default.
+		dst = []interface{}{"latest"}
+	default:
+		dst = []interface{}{fmt.Sprint(v)}
+	}
+	return dst
+}
+
+// convertBuildArgs converts the build arguments, which drone
+// accepts as a list of key=value pairs or a map.
+func convertBuildArgs(src interface{}) map[string]interface{} {
+	switch v := src.(type) {
+	case map[string]interface{}:
+		return v
+	case string:
+		return convertBuildArgs(strings.Split(v, ","))
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return convertBuildArgs(items)
+	case []interface{}:
+		dst := map[string]interface{}{}
+		for _, item := range v {
+			parts := strings.SplitN(fmt.Sprint(item), "=", 2)
+			if len(parts) == 2 {
+				dst[parts[0]] = parts[1]
+			}
+		}
+		if len(dst) == 0 {
+			return nil
+		}
+		return dst
+	}
+	return nil
+}
+
+// isTrue returns true if the setting is true, which drone
+// accepts as a boolean or a string.
+func isTrue(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(strings.TrimSpace(v))
+		return b
+	}
+	return false
+}
+
+// sortedVariables returns the variable names in sorted order.
+func sortedVariables(src map[string]*v1.Variable) []string {
+	var keys []string
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedKeys returns the map keys in sorted order.
+func sortedKeys(src map[string]interface{}) []string {
+	var keys []string
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// contains returns true if the slice contains the string.
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	v1 "github.com/hunain-avyka/Go-drone/convert/drone/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+)
+
+// secretStore resolves drone secret names to harness
+// secret identifiers.
+type secretStore struct {
+	org      map[string]bool
+	external map[string]string
+}
+
+// newSecretStore returns a secret store. Secrets in the
+// org list resolve to organization scoped secrets.
+func newSecretStore(org []string) *secretStore {
+	s := &secretStore{
+		org:      map[string]bool{},
+		external: map[string]string{},
+	}
+	for _, name := range org {
+		s.org[name] = true
+	}
+	return s
+}
+
+// register registers a drone secret document that pulls
+// the secret from an external secret manager (vault, aws
+// secrets manager or kubernetes) and adds the harness
+// secret that needs to be created to the report.
+func (s *secretStore) register(src *v1.Pipeline, r *report.Report) {
+	if src.Name == "" {
+		return
+	}
+	if src.Data.Path == "" {
+		r.Addf("secret %q: missing external secret path, ignored", src.Name)
+		return
+	}
+	id := externalSecretID(src.Data.Path, src.Data.Name)
+	s.external[src.Name] = id
+	r.Addf("secret %q: create harness secret %q referencing external secret path %q key %q",
+		src.Name, id, src.Data.Path, src.Data.Name)
+}
+
+// expr returns the harness expression for the named drone
+// secret.
+func (s *secretStore) expr(name string) string {
+	id, ok := s.external[name]
+	if !ok {
+		id = sanitizeString(name)
+	}
+	if s.org[id] || s.org[name] {
+		id = "org." + id
+	}
+	return fmt.Sprintf("<+secrets.getValue(%q)>", id)
+}
+
+// externalSecretID returns the harness secret identifier
+// derived from the external secret path and name. For
+// example, secret/data/docker and username resolve to
+// secret_data_docker_username.
+func externalSecretID(path, name string) string {
+	id := strings.Trim(path, "/")
+	if name != "" {
+		id = id + "_" + name
+	}
+	id = sanitizeString(id)
+	// harness identifiers cannot start with a digit.
+	if id != "" && id[0] >= '0' && id[0] <= '9' {
+		id = "_" + id
+	}
+	return id
+}
+
+// sign calculates the hmac signature of the raw drone yaml
+// using the provided key. The signature is calculated over
+// the raw documents, without the separators, and signature
+// documents are excluded, consistent with the drone signer.
+func sign(data []byte, key string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	for _, doc := range splitDocuments(data) {
+		if !isSignatureDocument(doc) {
+			h.Write(doc)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verify returns true if the hmac signature matches the
+// signature calculated from the raw drone yaml.
+func verify(data []byte, key, signature string) bool {
+	return hmac.Equal(
+		[]byte(sign(data, key)),
+		[]byte(strings.ToLower(signature)),
+	)
+}
+
+// splitDocuments splits the raw yaml into documents, using
+// the same separator and terminator rules as the drone raw
+// parser. A separator starts a new document, and the lines
+// of each document are terminated by a newline.
+func splitDocuments(data []byte) [][]byte {
+	var docs [][]byte
+	var doc *[]byte
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		separator := strings.HasPrefix(line, "---")
+		if separator {
+			doc = nil
+		}
+		if doc == nil {
+			docs = append(docs, nil)
+			doc = &docs[len(docs)-1]
+		}
+		if separator {
+			continue
+		}
+		if strings.HasPrefix(line, "...") {
+			break
+		}
+		*doc = append(*doc, line...)
+		*doc = append(*doc, '\n')
+	}
+	return docs
+}
+
+// isSignatureDocument returns true if the raw document is
+// a signature document.
+func isSignatureDocument(doc []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(doc))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if strings.HasPrefix(line, "kind:") {
+			kind := strings.TrimSpace(strings.TrimPrefix(line, "kind:"))
+			return strings.Trim(kind, `"'`) == v1.KindSignature
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	v2 "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// the go-spec v1 definitions only cover the subset of the
+// harness v1 yaml that the converter originally emitted.
+// the below types embed the go-spec definitions and extend
+// them with the additional fields the converter populates.
+// fields declared here take precedence over the embedded
+// fields with the same name when marshaled.
+
+type (
+	// configV1 defines the harness v1 yaml resource.
+	configV1 struct {
+		Pipeline *pipelineV1 `json:"pipeline,omitempty"`
+	}
+
+	// pipelineV1 defines the harness v1 pipeline.
+	pipelineV1 struct {
+		*v2.PipelineV1
+		Stages []*stageV1 `json:"stages,omitempty"`
+	}
+
+	// stageV1 defines the harness v1 stage.
+	stageV1 struct {
+		*v2.StageV1
+		Clone       *cloneV1       `json:"clone,omitempty"`
+		Concurrency *concurrencyV1 `json:"concurrency,omitempty"`
+		Steps       []*stepV1      `json:"steps,omitempty"`
+		Volumes     []*v2.Volume   `json:"volumes,omitempty"`
+		Runtime     interface{}    `json:"runtime,omitempty"`
+		Platform    *v2.Platform   `json:"platform,omitempty"`
+		Delegate    []string       `json:"delegate,omitempty"`
+		When        *v2.When       `json:"when,omitempty"`
+	}
+
+	// stepV1 defines the harness v1 step.
+	stepV1 struct {
+		*v2.StepV1
+		Run       *runSpecV1      `json:"run,omitempty"`
+		Container *containerV1    `json:"container,omitempty"`
+		Template  *templateV1     `json:"template,omitempty"`
+		Failure   *v2.FailureList `json:"failure,omitempty"`
+	}
+
+	// cloneV1 defines the harness v1 clone settings.
+	cloneV1 struct {
+		Disabled bool `json:"disabled,omitempty"`
+		Depth    int  `json:"depth,omitempty"`
+		Retries  int  `json:"retries,omitempty"`
+		Insecure bool `json:"insecure,omitempty"`
+		Trace    bool `json:"trace,omitempty"`
+	}
+
+	// concurrencyV1 limits the number of concurrent stage
+	// executions. Executions that exceed the limit are
+	// queued.
+	concurrencyV1 struct {
+		Limit int `json:"limit,omitempty"`
+	}
+
+	// runSpecV1 defines the harness v1 run step.
+	runSpecV1 struct {
+		*v2.RunSpec
+		Container *containerV1 `json:"container,omitempty"`
+	}
+
+	// containerV1 defines the harness v1 step container.
+	containerV1 struct {
+		*v2.ContainerSpec
+		Mount        []*v2.Mount       `json:"mount,omitempty"`
+		Resources    *v2.Resources     `json:"resources,omitempty"`
+		Devices      []*deviceV1       `json:"devices,omitempty"`
+		Dns          []string          `json:"dns,omitempty"`
+		DnsSearch    []string          `json:"dns_search,omitempty"`
+		ExtraHosts   []string          `json:"extra_hosts,omitempty"`
+		Network      string            `json:"network,omitempty"`
+		MemSwapLimit v2.MemStringorInt `json:"memswap_limit,omitempty"`
+	}
+
+	// deviceV1 defines a device mounted into the step
+	// container from a host volume.
+	deviceV1 struct {
+		Name string `json:"name,omitempty"`
+		Path string `json:"path,omitempty"`
+	}
+
+	// volumeTempV1 defines a temporary volume, which is
+	// memory-backed if the medium is memory.
+	volumeTempV1 struct {
+		Medium string            `json:"medium,omitempty"`
+		Limit  v2.MemStringorInt `json:"limit,omitempty"`
+	}
+
+	// templateV1 defines a native harness step, configured
+	// using inputs.
+	templateV1 struct {
+		Uses string                 `json:"uses,omitempty"`
+		With map[string]interface{} `json:"with,omitempty"`
+	}
+
+	// runtimeKubeV1 defines the harness kubernetes
+	// runtime.
+	runtimeKubeV1 struct {
+		Connector      string            `json:"connector,omitempty"`
+		Namespace      string            `json:"namespace,omitempty"`
+		ServiceAccount string            `json:"service_account,omitempty"`
+		NodeSelector   map[string]string `json:"node_selector,omitempty"`
+		Tolerations    []*tolerationV1   `json:"tolerations,omitempty"`
+		Labels         map[string]string `json:"labels,omitempty"`
+		Annotations    map[string]string `json:"annotations,omitempty"`
+		HostAliases    []*hostAliasV1    `json:"host_aliases,omitempty"`
+		DnsConfig      *dnsConfigV1      `json:"dns_config,omitempty"`
+		Resources      *resourcesV1      `json:"resources,omitempty"`
+	}
+
+	// resourcesV1 defines the kubernetes pod resource
+	// limits and requests.
+	resourcesV1 struct {
+		Limits   *resourceV1 `json:"limits,omitempty"`
+		Requests *resourceV1 `json:"requests,omitempty"`
+	}
+
+	// resourceV1 defines a kubernetes pod resource. The
+	// cpu is a kubernetes quantity, so fractional cores
+	// can be expressed in millicpu.
+	resourceV1 struct {
+		Cpu    string            `json:"cpu,omitempty"`
+		Memory v2.MemStringorInt `json:"memory,omitempty"`
+	}
+
+	// tolerationV1 defines a kubernetes pod toleration.
+	tolerationV1 struct {
+		Effect            string `json:"effect,omitempty"`
+		Key               string `json:"key,omitempty"`
+		Operator          string `json:"operator,omitempty"`
+		TolerationSeconds *int   `json:"toleration_seconds,omitempty"`
+		Value             string `json:"value,omitempty"`
+	}
+
+	// hostAliasV1 defines a kubernetes pod host alias.
+	hostAliasV1 struct {
+		IP        string   `json:"ip,omitempty"`
+		Hostnames []string `json:"hostnames,omitempty"`
+	}
+
+	// dnsConfigV1 defines the kubernetes pod dns
+	// configuration.
+	dnsConfigV1 struct {
+		Nameservers []string       `json:"nameservers,omitempty"`
+		Searches    []string       `json:"searches,omitempty"`
+		Options     []*dnsOptionV1 `json:"options,omitempty"`
+	}
+
+	// dnsOptionV1 defines a kubernetes pod dns option.
+	dnsOptionV1 struct {
+		Name  string  `json:"name,omitempty"`
+		Value *string `json:"value,omitempty"`
+	}
+)
@@ -0,0 +1,452 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// substitute parses the drone (bash-style) substitution
+// expressions in s and converts the expressions that
+// reference mapped drone variables to harness expressions.
+//
+// Supported syntax:
+//
+//	$VAR ${VAR} $$VAR $${VAR}
+//	${VAR=default} ${VAR:=default} ${VAR:-default}
+//	${VAR#prefix} ${VAR##prefix} ${VAR%suffix} ${VAR%%suffix}
+//	${VAR/old/new} ${VAR//old/new} ${VAR/#old/new} ${VAR/%old/new}
+//	${VAR:offset} ${VAR:offset:length}
+//	${VAR^} ${VAR^^} ${VAR,} ${VAR,,} ${#VAR}
+//
+// Expressions that cannot be converted are left as shell
+// variables and returned so they can be reported.
+func substitute(s string) (string, []string) {
+	var out strings.Builder
+	var unconverted []string
+
+	for i := 0; i < len(s); {
+		if s[i] != '$' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		// $$ escapes the dollar sign, deferring evaluation
+		// to the shell. the escaped variable is still
+		// converted if it maps to a harness expression.
+		if s[i+1] == '$' {
+			i++
+			if i+1 == len(s) {
+				out.WriteByte('$')
+				i++
+				continue
+			}
+		}
+
+		var name, op string
+		var end int
+		switch c := s[i+1]; {
+		case c == '{':
+			close := matchBrace(s, i+1)
+			if close == -1 {
+				out.WriteByte('$')
+				i++
+				continue
+			}
+			name, op = splitParam(s[i+2 : close])
+			end = close + 1
+		case isNameStart(c):
+			end = i + 2
+			for end < len(s) && isNameChar(s[end]) {
+				end++
+			}
+			name = s[i+1 : end]
+		default:
+			// not a variable reference, for example $1
+			// or $(command).
+			out.WriteByte('$')
+			i++
+			continue
+		}
+
+		// the original expression, with the escape removed,
+		// is left as a shell variable when the expression
+		// cannot be converted.
+		original := s[i:end]
+
+		if expr, ok := expandParam(name, op); ok {
+			out.WriteString(expr)
+		} else {
+			out.WriteString(original)
+			if isDroneVar(name) {
+				unconverted = append(unconverted, original)
+			}
+		}
+		i = end
+	}
+	return out.String(), unconverted
+}
+
+// expandParam converts the parameter expansion of the named
+// variable to a harness expression. The boolean is false if
+// the variable or operation cannot be converted.
+func expandParam(name, op string) (string, bool) {
+	// ${#VAR} returns the length of the variable.
+	if strings.HasPrefix(name, "#") {
+		expr, ok := variableMap[name[1:]]
+		if !ok || op != "" {
+			return "", false
+		}
+		return wrap(expr, ".length()"), true
+	}
+
+	expr, ok := variableMap[name]
+	if !ok {
+		return "", false
+	}
+
+	switch {
+	case op == "":
+		return expr, true
+	case op == "^^":
+		return wrap(expr, ".toUpperCase()"), true
+	case op == ",,":
+		return wrap(expr, ".toLowerCase()"), true
+	case op == "^":
+		return wrap(expr, firstChar+".toUpperCase()") + wrap(expr, otherChars), true
+	case op == ",":
+		return wrap(expr, firstChar+".toLowerCase()") + wrap(expr, otherChars), true
+	case strings.HasPrefix(op, ":-"), strings.HasPrefix(op, ":="):
+		return expandDefault(expr, op[2:], "?:")
+	case strings.HasPrefix(op, "="):
+		return expandDefault(expr, op[1:], "??")
+	case strings.HasPrefix(op, "##"):
+		return wrap(expr, fmt.Sprintf(".replaceFirst(%s, '')", quote("^"+globPattern(op[2:], true)))), true
+	case strings.HasPrefix(op, "#"):
+		return wrap(expr, fmt.Sprintf(".replaceFirst(%s, '')", quote("^"+globPattern(op[1:], false)))), true
+	case strings.HasPrefix(op, "%%"):
+		return wrap(expr, fmt.Sprintf(".replaceFirst(%s, '$1')", quote("^(.*?)"+globPattern(op[2:], true)+"$"))), true
+	case strings.HasPrefix(op, "%"):
+		return wrap(expr, fmt.Sprintf(".replaceFirst(%s, '$1')", quote("^(.*)"+globPattern(op[1:], false)+"$"))), true
+	case strings.HasPrefix(op, "/"):
+		return expandReplace(expr, op[1:])
+	case strings.HasPrefix(op, ":"):
+		return expandSubstring(expr, op[1:])
+	}
+	return "", false
+}
+
+// expandDefault converts the default value expansion using
+// the jexl elvis (?:) or null coalescing (??) operator.
+func expandDefault(expr, value, operator string) (string, bool) {
+	value, unconverted := substitute(value)
+	if len(unconverted) != 0 {
+		return "", false
+	}
+	if isExpr(value) {
+		return wrap(expr, " "+operator+" "+operand(value)), true
+	}
+	if strings.Contains(value, "<+") {
+		// the default value mixes text and expressions,
+		// which cannot be represented as a jexl operand.
+		return "", false
+	}
+	return wrap(expr, " "+operator+" "+quote(value)), true
+}
+
+// expandReplace converts the pattern replacement expansion.
+// The op is the expansion with the leading slash removed.
+func expandReplace(expr, op string) (string, bool) {
+	all, prefix, suffix := false, false, false
+	switch {
+	case strings.HasPrefix(op, "/"):
+		all, op = true, op[1:]
+	case strings.HasPrefix(op, "#"):
+		prefix, op = true, op[1:]
+	case strings.HasPrefix(op, "%"):
+		suffix, op = true, op[1:]
+	}
+
+	pattern, replacement := splitUnescaped(op, '/')
+	pattern = unescape(pattern)
+	replacement = unescape(replacement)
+	if pattern == "" {
+		return "", false
+	}
+
+	// a plain string replacement of all occurrences does
+	// not require a regular expression.
+	if all && !isGlob(pattern) {
+		return wrap(expr, fmt.Sprintf(".replace(%s, %s)", quote(pattern), quote(replacement))), true
+	}
+
+	re := globPattern(pattern, true)
+	switch {
+	case prefix:
+		re = "^" + re
+	case suffix:
+		re = re + "$"
+	}
+	method := "replaceFirst"
+	if all {
+		method = "replaceAll"
+	}
+	return wrap(expr, fmt.Sprintf(".%s(%s, %s)", method, quote(re), quote(quoteReplacement(replacement)))), true
+}
+
+// firstChar and otherChars split the first character from
+// the other characters of the string. Regular expressions
+// are used instead of substring, which fails if the string
+// is empty.
+const (
+	firstChar  = ".replaceFirst('(?s)^(.).*$', '$1')"
+	otherChars = ".replaceFirst('(?s)^.', '')"
+)
+
+// expandSubstring converts the substring expansion. The op
+// is the expansion with the leading colon removed. The
+// substring is matched with a regular expression, since the
+// jexl substring method fails if the string is shorter than
+// the offset and length, where the shell returns a shorter
+// or empty string.
+func expandSubstring(expr, op string) (string, bool) {
+	parts := strings.SplitN(op, ":", 2)
+	offset, err := parseOffset(parts[0])
+	if err != nil {
+		return "", false
+	}
+	length, hasLength := 0, len(parts) == 2
+	if hasLength {
+		if length, err = parseOffset(parts[1]); err != nil {
+			return "", false
+		}
+	}
+
+	// negative offsets are relative to the end of the
+	// string, and negative lengths are an offset from the
+	// end of the string. the alternative matches strings
+	// that are too short, which expand to an empty string.
+	var re string
+	switch {
+	case offset == 0 && !hasLength:
+		return expr, true
+	case offset >= 0 && !hasLength:
+		re = fmt.Sprintf("(?s)^.{0,%d}(.*)$", offset)
+	case offset == 0 && length >= 0:
+		re = fmt.Sprintf("(?s)^(.{0,%d}).*$", length)
+	case offset >= 0 && length >= 0:
+		re = fmt.Sprintf("(?s)^.{0,%d}(.{0,%d}).*$", offset, length)
+	case offset >= 0:
+		re = fmt.Sprintf("(?s)^(?:.{%d}(.*).{%d}|.*)$", offset, -length)
+	case !hasLength:
+		re = fmt.Sprintf("(?s)^(?:.*(.{%d})|.*)$", -offset)
+	case length >= 0:
+		re = fmt.Sprintf("(?s)^(?:.*?(?=.{%d}$)(.{0,%d}).*|.*)$", -offset, length)
+	default:
+		re = fmt.Sprintf("(?s)^(?:.*?(?=.{%d}$)(.*).{%d}|.*)$", -offset, -length)
+	}
+	return wrap(expr, fmt.Sprintf(".replaceFirst(%s, '$1')", quote(re))), true
+}
+
+// parseOffset parses a substring offset or length, which
+// may be negative, for example ${VAR: -3} or ${VAR:(-3)}.
+func parseOffset(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+	return strconv.Atoi(strings.TrimSpace(s))
+}
+
+// splitParam splits the braced parameter expansion into the
+// variable name and the operation.
+func splitParam(s string) (string, string) {
+	i := 0
+	if strings.HasPrefix(s, "#") && len(s) > 1 {
+		i = 1
+	}
+	for i < len(s) && isNameChar(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// matchBrace returns the index of the closing brace that
+// matches the opening brace at index i, or -1.
+func matchBrace(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// splitUnescaped splits the string at the first separator
+// that is not escaped with a backslash.
+func splitUnescaped(s string, sep byte) (string, string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// unescape removes backslash escapes from the string.
+func unescape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// globPattern converts a shell pattern to an unanchored
+// regular expression. Unlike path globs, the asterisk
+// matches any character, including the path separator.
+// If greedy is false the asterisk matches the shortest
+// possible string.
+func globPattern(pattern string, greedy bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if greedy {
+				sb.WriteString(".*")
+			} else {
+				sb.WriteString(".*?")
+			}
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end == -1 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+// quoteReplacement escapes the characters that have special
+// meaning in a java regular expression replacement string.
+func quoteReplacement(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `$`, `\$`)
+}
+
+// quote returns the string as a single quoted jexl string
+// literal.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+// wrap returns the harness expression with the jexl suffix
+// applied to the expression operand.
+func wrap(expr, suffix string) string {
+	return "<+" + operand(expr) + suffix + ">"
+}
+
+// operand returns the expression in a form that can be used
+// as an operand in a jexl expression. A simple expression,
+// such as <+codebase.branch>, is unwrapped to codebase.branch.
+// Compound expressions are nested as-is.
+func operand(expr string) string {
+	if isSimpleExpr(expr) {
+		return expr[2 : len(expr)-1]
+	}
+	return expr
+}
+
+// isSimpleExpr returns true if the string is a single,
+// non-nested harness expression.
+func isSimpleExpr(s string) bool {
+	return strings.HasPrefix(s, "<+") &&
+		strings.HasSuffix(s, ">") &&
+		strings.Count(s, "<+") == 1 &&
+		strings.Count(s, ">") == 1
+}
+
+// isExpr returns true if the string is a single harness
+// expression, which may be nested.
+func isExpr(s string) bool {
+	if !strings.HasPrefix(s, "<+") || !strings.HasSuffix(s, ">") {
+		return false
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "<+"):
+			depth++
+			i++
+		case s[i] == '>':
+			depth--
+			if depth == 0 && i != len(s)-1 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// isDroneVar returns true if the variable is a drone build
+// variable, which is not available as a harness expression
+// unless it is mapped.
+func isDroneVar(name string) bool {
+	name = strings.TrimPrefix(name, "#")
+	return strings.HasPrefix(name, "DRONE_") || strings.HasPrefix(name, "CI_")
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,258 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drone
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "github.com/hunain-avyka/Go-drone/convert/drone/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+	v2 "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// eventMap maps drone events to the equivalent harness
+// trigger expressions, which test for inclusion and
+// exclusion respectively. Harness reports tag pushes as
+// push events, which drone reports as tag events.
+var eventMap = map[string]struct {
+	include, exclude string
+}{
+	"push": {
+		`<+trigger.event> == "PUSH" && !(<+trigger.payload.ref> =^ "refs/tags/")`,
+		`(<+trigger.event> != "PUSH" || <+trigger.payload.ref> =^ "refs/tags/")`,
+	},
+	"pull_request": {
+		`<+trigger.event> == "PR"`,
+		`<+trigger.event> != "PR"`,
+	},
+	"tag": {
+		`<+trigger.payload.ref> =^ "refs/tags/"`,
+		`<+trigger.payload.ref> !^ "refs/tags/"`,
+	},
+}
+
+// convertTrigger converts the drone pipeline trigger to
+// the harness stage when clause. Conditions that can only
+// be expressed using a harness trigger are added to the
+// conversion report.
+func convertTrigger(src *v1.Pipeline, r *report.Report) *v2.When {
+	trigger := src.Trigger
+
+	var exprs []string
+	if expr := convertTriggerEvent(src.Name, trigger.Event, r); expr != "" {
+		exprs = append(exprs, expr)
+	}
+	if expr := convertTriggerCond("<+codebase.branch>", trigger.Branch); expr != "" {
+		exprs = append(exprs, expr)
+	}
+	if expr := convertTriggerCond("<+trigger.payload.ref>", trigger.Ref); expr != "" {
+		exprs = append(exprs, expr)
+	}
+	if expr := convertTriggerCond("<+trigger.payload.repository.full_name>", trigger.Repo); expr != "" {
+		exprs = append(exprs, expr)
+	}
+	if expr := convertTriggerCond("<+trigger.payload.action>", trigger.Action); expr != "" {
+		exprs = append(exprs, expr)
+	}
+
+	// the below conditions cannot be evaluated at runtime
+	// and must be configured in the harness trigger.
+	if !isCondEmpty(trigger.Cron) {
+		r.Addf("stage %q: trigger cron %s requires a harness cron trigger", src.Name, describeCond(trigger.Cron))
+	}
+	if !isCondEmpty(trigger.Target) {
+		r.Addf("stage %q: trigger target %s requires a harness trigger or input for the promotion target", src.Name, describeCond(trigger.Target))
+	}
+	if !isCondEmpty(trigger.Paths) {
+		r.Addf("stage %q: trigger paths %s requires a harness trigger with file path conditions", src.Name, describeCond(trigger.Paths))
+	}
+	if !isCondEmpty(trigger.Instance) {
+		r.Addf("stage %q: trigger instance %s is not supported and was ignored", src.Name, describeCond(trigger.Instance))
+	}
+
+	dst := new(v2.When)
+	if len(exprs) != 0 {
+		dst.Eval = strings.Join(exprs, " && ")
+	}
+	if status := convertTriggerStatus(trigger.Status); status != "" {
+		dst.Cond = []map[string]*v2.Expr{
+			{"status": {Eq: status}},
+		}
+	}
+	if dst.Eval == "" && len(dst.Cond) == 0 {
+		return nil
+	}
+	return dst
+}
+
+// convertTriggerEvent converts the drone event condition
+// to a jexl expression. Events without a runtime equivalent
+// are added to the conversion report. If none of the
+// included events has a runtime equivalent the expression
+// never matches, since the stage must not run for events
+// that drone would skip.
+func convertTriggerEvent(name string, src v1.Condition, r *report.Report) string {
+	var include, exclude []string
+	for _, event := range src.Include {
+		mapping, ok := eventMap[event]
+		if !ok {
+			r.Addf("stage %q: trigger event %q requires a harness trigger", name, event)
+			continue
+		}
+		include = append(include, mapping.include)
+	}
+	if len(src.Include) != 0 && len(include) == 0 {
+		r.Addf("stage %q: the stage is disabled, remove the false condition when the harness trigger is configured", name)
+		include = append(include, "false")
+	}
+	for _, event := range src.Exclude {
+		mapping, ok := eventMap[event]
+		if !ok {
+			r.Addf("stage %q: trigger event exclusion %q requires a harness trigger", name, event)
+			continue
+		}
+		exclude = append(exclude, mapping.exclude)
+	}
+	return joinCond(include, exclude)
+}
+
+// convertTriggerCond converts the drone condition to a jexl
+// expression that tests the variable against the include
+// and exclude patterns. A value is matched when it matches
+// any include pattern and none of the exclude patterns.
+func convertTriggerCond(variable string, src v1.Condition) string {
+	var include, exclude []string
+	for _, pattern := range src.Include {
+		include = append(include, matchExpr(variable, pattern, false))
+	}
+	for _, pattern := range src.Exclude {
+		exclude = append(exclude, matchExpr(variable, pattern, true))
+	}
+	return joinCond(include, exclude)
+}
+
+// convertTriggerStatus converts the drone status condition
+// to the harness pipeline status.
+func convertTriggerStatus(src v1.Condition) string {
+	success := src.Match("success")
+	failure := src.Match("failure")
+	switch {
+	case isCondEmpty(src):
+		return ""
+	case success && failure:
+		return "all"
+	case failure:
+		return "failure"
+	case success:
+		return "success"
+	default:
+		return ""
+	}
+}
+
+// matchExpr returns a jexl expression that matches the
+// variable against the glob pattern, or the inverse.
+func matchExpr(variable, pattern string, not bool) string {
+	if !isGlob(pattern) {
+		if not {
+			return fmt.Sprintf("%s != %q", variable, pattern)
+		}
+		return fmt.Sprintf("%s == %q", variable, pattern)
+	}
+	if not {
+		return fmt.Sprintf("!(%s =~ %q)", variable, globToRegexp(pattern))
+	}
+	return fmt.Sprintf("%s =~ %q", variable, globToRegexp(pattern))
+}
+
+// joinCond joins the include expressions using a logical
+// or, and the exclude expressions using a logical and.
+func joinCond(include, exclude []string) string {
+	var exprs []string
+	switch len(include) {
+	case 0:
+	case 1:
+		exprs = append(exprs, include[0])
+	default:
+		exprs = append(exprs, "("+strings.Join(include, " || ")+")")
+	}
+	exprs = append(exprs, exclude...)
+	return strings.Join(exprs, " && ")
+}
+
+// describeCond returns a human readable description of
+// the condition for the conversion report.
+func describeCond(src v1.Condition) string {
+	var parts []string
+	if len(src.Include) != 0 {
+		parts = append(parts, "include ["+strings.Join(src.Include, ", ")+"]")
+	}
+	if len(src.Exclude) != 0 {
+		parts = append(parts, "exclude ["+strings.Join(src.Exclude, ", ")+"]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// isGlob returns true if the pattern contains glob
+// metacharacters.
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// globToRegexp converts a glob pattern, as evaluated by
+// drone using filepath.Match, to an anchored regular
+// expression. A double asterisk matches across path
+// separators.
+func globToRegexp(pattern string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end == -1 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
@@ -25,7 +25,7 @@ type (
 		Node        map[string]string `json:"node,omitempty"`
 		Concurrency Concurrency       `json:"concurrency,omitempty"`
 		Platform    Platform          `json:"platform,omitempty"`
-		Data        Secret            `json:"secret,omitempty"`
+		Data        Secret            `json:"get,omitempty" yaml:"get"`
 		Clone       Clone             `json:"clone,omitempty"`
 		Trigger     Conditions        `json:"conditions,omitempty"`
 		Environment map[string]string `json:"environment,omitempty"`
@@ -43,7 +43,7 @@ type (
 		NodeSelector   map[string]string `json:"node_selector,omitempty"        yaml:"node_selector"`
 		ServiceAccount string            `json:"service_account_name,omitempty" yaml:"service_account_name"`
 		Tolerations    []Toleration      `json:"tolerations,omitempty"`
-		Resource       Resources         `json:"resource,omitempty"`
+		Resource       Resources         `json:"resources,omitempty" yaml:"resources"`
 	}
 
 	// Resources configures resource limits.
@@ -190,7 +190,7 @@ type (
 		Effect            string `json:"effect,omitempty"`
 		Key               string `json:"key,omitempty"`
 		Operator          string `json:"operator,omitempty"`
-		TolerationSeconds *int   `json:"toleration_seconds,omitempty"`
+		TolerationSeconds *int   `json:"toleration_seconds,omitempty" yaml:"toleration_seconds"`
 		Value             string `json:"value,omitempty"`
 	}
 )
@@ -0,0 +1,191 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// convertLocalAction converts a step that uses a local
+// action. Composite actions are inlined as a step group and
+// docker actions are converted to run steps. It returns
+// false if the action is a javascript action, or cannot be
+// loaded, and the step remains an action step.
+func (d *Converter) convertLocalAction(dst *harness.Step, step *github.Step, container *github.Container, path []string, ctx *context) bool {
+	action, err := d.loadAction(step.Uses, path)
+	if err != nil {
+		ctx.report.Addf("step %q: local action %q cannot be resolved: %s", stepName(step), step.Uses, err)
+		return false
+	}
+	if action.Runs == nil {
+		ctx.report.Addf("step %q: local action %q has no runs section", stepName(step), step.Uses)
+		return false
+	}
+
+	// the action inputs are evaluated in the scope of the
+	// step that uses the action.
+	saved := ctx.scope
+	ctx.scope = newActionScope(step, action, saved, ctx)
+	defer func() { ctx.scope = saved }()
+
+	if dst.Name == "" {
+		dst.Name = action.Name
+	}
+
+	switch using := action.Runs.Using; {
+	case using == "composite":
+		dst.Type = "group"
+		dst.Spec = &harness.StepGroup{
+			Steps: d.convertStepList(action.Runs.Steps, container, append(path, step.Uses), ctx),
+		}
+		return true
+	case using == "docker":
+		image := action.Runs.Image
+		if !strings.HasPrefix(image, "docker://") {
+			ctx.report.Addf("step %q: local action %q builds image %q, build and push the image and update the step image", stepName(step), step.Uses, image)
+		}
+		if action.Runs.PreEntrypoint != "" || action.Runs.PostEntrypoint != "" {
+			ctx.report.Addf("step %q: pre-entrypoint and post-entrypoint of local action %q are not supported", stepName(step), step.Uses)
+		}
+		spec := convertDockerAction(step, strings.TrimPrefix(image, "docker://"), action, ctx)
+		dst.Type = "script"
+		dst.Spec = spec
+		return true
+	case strings.HasPrefix(using, "node"):
+		return false
+	default:
+		ctx.report.Addf("step %q: local action %q uses unsupported runner %q", stepName(step), step.Uses, using)
+		return false
+	}
+}
+
+// loadAction loads the action metadata of a local action
+// from the repository root.
+func (d *Converter) loadAction(uses string, path []string) (*github.Action, error) {
+	for _, v := range path {
+		if v == uses {
+			return nil, fmt.Errorf("local action cycle %s", strings.Join(append(path, uses), " -> "))
+		}
+	}
+	if d.root == "" {
+		return nil, errors.New("repository root is not configured")
+	}
+	dir := filepath.Join(d.root, filepath.FromSlash(uses))
+	for _, name := range []string{"action.yml", "action.yaml"} {
+		file := filepath.Join(dir, name)
+		if _, err := os.Stat(file); err == nil {
+			return github.ParseActionFile(file)
+		}
+	}
+	return nil, errors.New("action.yml not found")
+}
+
+// newActionScope returns the scope of a local action used
+// by the step. The step with values are bound to the action
+// inputs, and inputs that are not passed by the step are
+// bound to the input defaults.
+func newActionScope(step *github.Step, action *github.Action, parent *callScope, ctx *context) *callScope {
+	scope := &callScope{
+		parent:  parent,
+		name:    stepName(step),
+		inputs:  map[string]*binding{},
+		secrets: map[string]*binding{},
+		inherit: true,
+	}
+	for key, input := range action.Inputs {
+		if input != nil && input.Default != "" {
+			scope.inputs[key] = &binding{
+				node:  parseBinding(input.Default, ctx),
+				scope: parent,
+			}
+		}
+	}
+	for key, value := range step.With {
+		scope.inputs[key] = &binding{
+			node:  parseBinding(fmt.Sprint(value), ctx),
+			scope: parent,
+		}
+	}
+	return scope
+}
+
+// convertDockerAction converts a docker action to a run
+// step that executes the action image. The action inputs
+// are passed as INPUT_<NAME> environment variables, which
+// is how docker actions receive their inputs.
+func convertDockerAction(step *github.Step, image string, action *github.Action, ctx *context) *harness.StepExec {
+	dst := &harness.StepExec{
+		Image: convertExprs(image, false, ctx),
+		Envs:  map[string]string{},
+	}
+
+	if action == nil {
+		// the args and entrypoint of docker:// steps are
+		// passed as step inputs.
+		for key, value := range step.With {
+			switch key {
+			case "args":
+				dst.Args = strings.Fields(convertExprs(fmt.Sprint(value), false, ctx))
+			case "entrypoint":
+				dst.Entrypoint = convertExprs(fmt.Sprint(value), false, ctx)
+			default:
+				dst.Envs[inputEnv(key)] = convertExprs(fmt.Sprint(value), false, ctx)
+			}
+		}
+	} else {
+		dst.Entrypoint = convertExprs(action.Runs.Entrypoint, false, ctx)
+		for _, arg := range action.Runs.Args {
+			dst.Args = append(dst.Args, convertExprs(arg, false, ctx))
+		}
+		for key, value := range action.Runs.Env {
+			dst.Envs[key] = convertExprs(value, false, ctx)
+		}
+		for key := range ctx.scope.inputs {
+			dst.Envs[inputEnv(key)] = convertExprs("${{ inputs."+key+" }}", false, ctx)
+		}
+	}
+
+	for key, value := range step.Env {
+		dst.Envs[key] = convertExprs(value, false, ctx)
+	}
+	if len(dst.Envs) == 0 {
+		dst.Envs = nil
+	}
+	return dst
+}
+
+// inputEnv returns the name of the environment variable
+// used to pass the input to a docker action.
+func inputEnv(name string) string {
+	return "INPUT_" + strings.ToUpper(strings.ReplaceAll(name, " ", "_"))
+}
+
+// stepName returns the step name used in conversion notes.
+func stepName(step *github.Step) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	if step.Uses != "" {
+		return step.Uses
+	}
+	return step.Run
+}
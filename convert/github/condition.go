@@ -0,0 +1,233 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// statusSet is the set of the job statuses in which a
+// status function is true.
+type statusSet uint8
+
+const (
+	statusSuccess statusSet = 1 << iota
+	statusFailure
+	statusCancelled
+
+	statusAny = statusSuccess | statusFailure | statusCancelled
+)
+
+// statusFuncs maps the status functions to the statuses in
+// which they are true.
+var statusFuncs = map[string]statusSet{
+	"always":    statusAny,
+	"success":   statusSuccess,
+	"failure":   statusFailure,
+	"cancelled": statusCancelled,
+}
+
+// convertIf converts a GitHub if condition to a harness
+// status and a jexl expression. The status functions of the
+// condition convert to the status, and the remaining
+// conditions convert to the expression. The status is empty
+// if the condition runs on success, which is the default.
+func convertIf(s string, ctx *context) (string, string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", ""
+	}
+	expr := s
+	if strings.HasPrefix(expr, "${{") && strings.HasSuffix(expr, "}}") &&
+		strings.Count(expr, "${{") == 1 {
+		expr = strings.TrimSpace(expr[3 : len(expr)-2])
+	}
+	node, err := parseExpr(expr)
+	if err != nil {
+		ctx.report.Addf("expression %q cannot be parsed: %s", expr, err)
+		return "", s
+	}
+
+	status, rest, ok := splitStatus(node)
+	if !ok {
+		ctx.report.Addf("expression %q: status functions combined with other conditions by || cannot be converted to a harness status", expr)
+		return "", convertCondition(s, ctx)
+	}
+
+	c := &exprConverter{ctx: ctx}
+	var conds []string
+	for _, node := range rest {
+		conds = append(conds, c.operand(node, precAnd))
+	}
+	eval := strings.Join(conds, " && ")
+	if c.err != "" {
+		ctx.report.Addf("expression %q cannot be converted to a harness expression: %s is not supported", expr, c.err)
+		eval = s
+	}
+
+	// harness does not run stages and steps after the
+	// pipeline is aborted, so the cancelled status is
+	// ignored.
+	switch status &^ statusCancelled {
+	case statusSuccess | statusFailure:
+		return "all", eval
+	case statusFailure:
+		return "failure", eval
+	case statusSuccess:
+		return "", eval
+	}
+	ctx.report.Addf("expression %q: conditions that are only true when the workflow is cancelled are not supported", expr)
+	return "", "false"
+}
+
+// splitStatus splits the conjunction of the condition into
+// the statuses of the status functions and the remaining
+// conditions. Conditions without status functions are true
+// on success. It returns false if status functions are
+// combined with other conditions other than by &&.
+func splitStatus(node exprNode) (statusSet, []exprNode, bool) {
+	status := statusAny
+	explicit := false
+	var rest []exprNode
+	for _, node := range conjuncts(node) {
+		if s, ok := statusOf(node); ok {
+			status &= s
+			explicit = true
+			continue
+		}
+		if hasStatusFunc(node) {
+			return 0, nil, false
+		}
+		rest = append(rest, node)
+	}
+	if !explicit {
+		status = statusSuccess
+	}
+	return status, rest, true
+}
+
+// conjuncts returns the operands of the top-level && of the
+// expression.
+func conjuncts(node exprNode) []exprNode {
+	if n, ok := node.(*binaryNode); ok && n.op == "&&" {
+		return append(conjuncts(n.x), conjuncts(n.y)...)
+	}
+	return []exprNode{node}
+}
+
+// statusOf returns the statuses in which the expression is
+// true, if the expression only consists of status functions.
+func statusOf(node exprNode) (statusSet, bool) {
+	switch n := node.(type) {
+	case *callNode:
+		s, ok := statusFuncs[strings.ToLower(n.name)]
+		return s, ok && len(n.args) == 0
+	case *unaryNode:
+		s, ok := statusOf(n.x)
+		return statusAny &^ s, ok
+	case *binaryNode:
+		x, ok := statusOf(n.x)
+		if !ok {
+			return 0, false
+		}
+		y, ok := statusOf(n.y)
+		if !ok {
+			return 0, false
+		}
+		switch n.op {
+		case "&&":
+			return x & y, true
+		case "||":
+			return x | y, true
+		}
+	}
+	return 0, false
+}
+
+// hasStatusFunc returns true if the expression calls a
+// status function.
+func hasStatusFunc(node exprNode) bool {
+	switch n := node.(type) {
+	case *callNode:
+		if _, ok := statusFuncs[strings.ToLower(n.name)]; ok {
+			return true
+		}
+		for _, arg := range n.args {
+			if hasStatusFunc(arg) {
+				return true
+			}
+		}
+	case *unaryNode:
+		return hasStatusFunc(n.x)
+	case *binaryNode:
+		return hasStatusFunc(n.x) || hasStatusFunc(n.y)
+	case *propertyNode:
+		return hasStatusFunc(n.x)
+	case *indexNode:
+		return hasStatusFunc(n.x) || hasStatusFunc(n.index)
+	}
+	return false
+}
+
+// statusWhen returns the when condition of the status and
+// expression.
+func statusWhen(status, eval string) *harness.When {
+	if status == "" && eval == "" {
+		return nil
+	}
+	when := &harness.When{Eval: eval}
+	if status != "" {
+		when.Cond = []map[string]*harness.Expr{
+			{"status": {Eq: status}},
+		}
+	}
+	return when
+}
+
+// convertStepIf converts the step if condition.
+func convertStepIf(src *github.Step, ctx *context) *harness.When {
+	return statusWhen(convertIf(src.If, ctx))
+}
+
+// convertJobIf converts the job if condition, including
+// the conditions of the jobs that call the reusable
+// workflow. Stages are skipped when a previous stage
+// fails, so the status only applies to jobs that need
+// other jobs.
+func convertJobIf(job *github.Job, ctx *context) *harness.When {
+	status, eval := convertIf(job.If, ctx)
+	if len(job.Needs) == 0 {
+		status = ""
+	}
+	var conds []string
+	if eval != "" {
+		conds = append(conds, eval)
+	}
+	// the conditions of the jobs that call a reusable
+	// workflow apply to the called jobs.
+	conds = append(conds, callConditions(ctx)...)
+	switch len(conds) {
+	case 0:
+		eval = ""
+	case 1:
+		eval = conds[0]
+	default:
+		eval = "(" + strings.Join(conds, ") && (") + ")"
+	}
+	return statusWhen(status, eval)
+}
@@ -26,25 +26,67 @@ import (
 	"time"
 
 	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	v0 "github.com/hunain-avyka/Go-drone/convert/harness/yaml"
 	harness "github.com/hunain-avyka/go-spec/dist/go"
 
 	"github.com/ghodss/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
 	"github.com/hunain-avyka/Go-drone/internal/store"
 )
 
 // conversion context
 type context struct {
 	pipeline *github.Pipeline
+	report   *report.Report
+	secrets  *secretStore
+
+	// scope is the reusable workflow scope of the job
+	// being converted, or nil if the job is defined in
+	// the converted workflow.
+	scope *callScope
+
+	// jobs and scopes store the expanded workflow jobs
+	// and their scopes, used to resolve job outputs.
+	jobs   map[string]*github.Job
+	scopes map[string]*callScope
+
+	// outputStage is the name of the stage in which the
+	// step outputs are resolved, or empty if the step
+	// outputs are resolved in the current stage.
+	outputStage string
+
+	// stage stores the state of the stage being
+	// converted.
+	stage *stageState
+
+	// inputs stores the pipeline inputs created for the
+	// configuration variables used in the workflow.
+	inputs map[string]*harness.Input
+
+	// workflows maps the workflow names to the pipeline
+	// identifiers, if the workflow is converted with the
+	// other workflows of the directory.
+	workflows map[string]string
+
+	// dockerhubConn is the docker hub connector used by
+	// the docker build and push steps.
+	dockerhubConn string
 }
 
 // Converter converts a GitHub pipeline to a Harness
 // v1 pipeline.
 type Converter struct {
-	kubeEnabled   bool
-	kubeNamespace string
-	kubeConnector string
-	dockerhubConn string
-	identifiers   *store.Identifiers
+	kubeEnabled    bool
+	kubeNamespace  string
+	kubeConnector  string
+	dockerhubConn  string
+	root           string
+	workflowCache  string
+	orgSecrets     []string
+	accountSecrets []string
+	runners        map[string]string
+	environments   map[string]*Environment
+	identifiers    *store.Identifiers
 
 	// // as we walk the yaml, we store a
 	// // a snapshot of the current node and
@@ -89,7 +131,10 @@ func (d *Converter) Convert(r io.Reader) ([]byte, error) {
 		return nil, err
 	}
 	return d.convert(&context{
-		pipeline: src,
+		pipeline:      src,
+		report:        report.New(),
+		secrets:       newSecretStore(d.orgSecrets, d.accountSecrets),
+		dockerhubConn: d.dockerhubConn,
 	})
 }
 
@@ -119,6 +164,16 @@ func (d *Converter) ConvertFile(p string) ([]byte, error) {
 
 // converts a GitHub pipeline to Harness pipeline.
 func (d *Converter) convert(ctx *context) ([]byte, error) {
+	config, triggers, err := d.convertPipeline(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return marshalPipeline(config, triggers, ctx)
+}
+
+// convertPipeline converts a GitHub pipeline to a Harness
+// pipeline resource and triggers.
+func (d *Converter) convertPipeline(ctx *context) (*harness.Config, []*v0.TriggerConfig, error) {
 
 	// create the harness pipeline spec
 	pipeline := &harness.Pipeline{
@@ -137,148 +192,134 @@ func (d *Converter) convert(ctx *context) ([]byte, error) {
 
 	if ctx.pipeline.Env != nil {
 		pipeline.Options = &harness.Default{
-			Envs: ctx.pipeline.Env,
+			Envs: convertEnv(ctx.pipeline.Env, ctx),
 		}
 	}
 
-	//pipeline.When = convertOn(from.On) //GAP
+	// convert the workflow_dispatch and workflow_call
+	// inputs to pipeline inputs.
+	convertInputs(ctx.pipeline, ctx)
 
-	if ctx.pipeline.Jobs != nil {
-		for name, job := range ctx.pipeline.Jobs {
-			// skip nil jobs to avoid nil-pointer
-			if job == nil {
-				continue
-			}
+	jobs, scopes := d.expandJobs(ctx.pipeline.Jobs, nil, nil, ctx)
+	ctx.jobs, ctx.scopes = jobs, scopes
+	groups, err := sortJobs(jobs, ctx.report)
+	if err != nil {
+		return nil, nil, err
+	}
 
-			var cloneStage *harness.CloneStage
-			for _, step := range job.Steps {
-				cloneStage = convertClone(step)
-				if cloneStage != nil {
-					break
-				}
-			}
+	// the workflow concurrency group converts to a stage
+	// that queues the pipeline before the jobs run.
+	if stage := convertWorkflowConcurrency(ctx); stage != nil {
+		pipeline.Stages = append(pipeline.Stages, stage)
+	}
 
-			pipeline.Stages = append(pipeline.Stages, &harness.Stage{
-				Name:     name,
-				Type:     "ci",
-				Strategy: convertStrategy(job.Strategy),
-				When:     convertIf(job.If),
-				Spec: &harness.StageCI{
-					Clone:    cloneStage,
-					Envs:     job.Env,
-					Platform: convertRunsOn(job.RunsOn),
-					Runtime: &harness.Runtime{
-						Type: "cloud",
-						Spec: &harness.RuntimeCloud{},
-					},
-					Steps: convertSteps(job),
-					//Volumes:  convertVolumes(from.Volumes),
-
-					// TODO support for delegate.selectors from.Node
-					// TODO support for stage.variables
-				},
-			})
+	for _, group := range groups {
+		var stages, approvals []*harness.Stage
+		for _, name := range group {
+			ctx.scope = scopes[name]
+			if approval := d.convertEnvironment(name, jobs[name], ctx); approval != nil {
+				approvals = append(approvals, approval)
+			}
+			stages = append(stages, d.convertJob(name, jobs[name], ctx)...)
 		}
+		// the approvals of the jobs that deploy to a
+		// protected environment run before the group.
+		pipeline.Stages = appendGroup(pipeline.Stages, approvals)
+		pipeline.Stages = appendGroup(pipeline.Stages, stages)
 	}
 
-	// marshal the harness yaml
-	out, err := yaml.Marshal(config)
-	if err != nil {
-		return nil, err
-	}
+	pipeline.Inputs = ctx.inputs
 
-	return out, nil
+	// the workflow events convert to harness triggers.
+	triggers := convertTriggers(ctx.pipeline.On, ctx)
+	convertCancelInProgress(triggers, ctx)
+	return config, triggers, nil
 }
 
-func convertClone(src *github.Step) *harness.CloneStage {
-	if src == nil || !isCheckoutAction(src.Uses) {
-		return nil
+// marshalPipeline marshals the pipeline resource. The
+// triggers are appended to the pipeline as separate yaml
+// documents, and the conversion notes are prepended as a
+// yaml comment block.
+func marshalPipeline(config *harness.Config, triggers []*v0.TriggerConfig, ctx *context) ([]byte, error) {
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
 	}
-	dst := new(harness.CloneStage)
-	if src.With != nil {
-		if depth, ok := src.With["fetch-depth"]; ok {
-			dst.Depth, _ = toInt64(depth)
+	for _, trigger := range triggers {
+		b, err := yaml.Marshal(trigger)
+		if err != nil {
+			return nil, err
 		}
+		out = append(out, "\n---\n"...)
+		out = append(out, b...)
 	}
-	return dst
-}
 
-func convertOn(src *github.On) *harness.When {
-	if src == nil || isTriggersEmpty(src) {
-		return nil
-	}
-
-	exprs := map[string]*harness.Expr{}
-
-	for eventName, eventCondition := range getEventConditions(src) {
-		if expr := convertEventCondition(eventCondition); expr != nil {
-			exprs[eventName] = expr
-		}
+	if notes := ctx.report.Comment(); notes != nil {
+		out = append(notes, out...)
 	}
 
-	dst := new(harness.When)
-	dst.Cond = []map[string]*harness.Expr{exprs}
-	return dst
+	return out, nil
 }
 
-func convertIf(i string) *harness.When {
-	if i == "" {
-		return nil
+// convertJob converts a GitHub job to Harness stages. A
+// matrix job that runs on multiple platforms converts to a
+// stage per platform.
+func (d *Converter) convertJob(name string, job *github.Job, ctx *context) []*harness.Stage {
+	var cloneStage *harness.CloneStage
+	for _, step := range job.Steps {
+		cloneStage = convertClone(step)
+		if cloneStage != nil {
+			break
+		}
 	}
 
-	i = githubExprToJexlExpr(i)
-
-	dst := new(harness.When)
-	dst.Eval = i
-	return dst
-}
-
-func githubExprToJexlExpr(githubExpr string) string {
-	// Replace functions
-	githubExpr = strings.Replace(githubExpr, "!contains(", "!~ ", -1)
-	githubExpr = strings.Replace(githubExpr, "contains(", "=~ ", -1)
-	githubExpr = strings.Replace(githubExpr, "startsWith(", "=^ ", -1)
-	githubExpr = strings.Replace(githubExpr, "endsWith(", "=$ ", -1)
-
-	// Replace variables
-	githubExpr = strings.Replace(githubExpr, "github.event_name", "<+trigger.event>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.ref", "<+trigger.payload.ref>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.head_ref", "<+trigger.sourceBranch>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.event.ref", "<+trigger.payload.ref>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.base_ref", "<+trigger.targetBranch>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.event.number", "<+trigger.prNumber>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.event.pull_request.title", "<+trigger.prTitle>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.event.pull_request.body", "<+trigger.payload.pull_request.body>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.event.pull_request.html_url", "<+trigger.payload.pull_request.html_url>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.event.repository.html_url", "<+trigger.repoUrl>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.actor", "<+trigger.gitUser>", -1)
-	githubExpr = strings.Replace(githubExpr, "github.actor_email", "<+codebase.gitUserEmail>", -1)
-
-	return githubExpr
-}
+	convertFailFast(name, job.Strategy, ctx)
 
-func getEventConditions(src *github.On) map[string][]string {
-	eventConditions := make(map[string][]string)
+	var stages []*harness.Stage
+	for _, matrix := range d.convertMatrix(name, job, ctx) {
+		ctx.stage = &stageState{
+			platform: matrix.runner.platform,
+			defaults: mergeDefaults(ctx.pipeline.Defaults, job.Defaults),
+			ids:      store.New(),
+		}
+		steps := d.convertSteps(job, ctx)
+		if queue := convertJobConcurrency(name, job, ctx); queue != nil {
+			steps = append([]*harness.Step{queue}, steps...)
+		}
 
-	if src.Push != nil {
-		eventConditions["push"] = src.Push.Branches
-	}
-	if src.PullRequest != nil {
-		eventConditions["pull_request"] = src.PullRequest.Branches
+		stages = append(stages, &harness.Stage{
+			Name:     name + matrix.suffix,
+			Type:     "ci",
+			Delegate: matrix.runner.delegate,
+			Strategy: matrix.strategy,
+			When:     convertJobIf(job, ctx),
+			Spec: &harness.StageCI{
+				Cache:    ctx.stage.cache,
+				Clone:    cloneStage,
+				Envs:     convertEnv(job.Env, ctx),
+				Platform: matrix.runner.platform,
+				Runtime:  matrix.runner.runtime,
+				Steps:    steps,
+				//Volumes:  convertVolumes(from.Volumes),
+
+				// TODO support for stage.variables
+			},
+		})
 	}
-	return eventConditions
+	return stages
 }
 
-func convertEventCondition(src []string) *harness.Expr {
-	if len(src) != 0 {
-		return &harness.Expr{In: src}
+func convertClone(src *github.Step) *harness.CloneStage {
+	if src == nil || !isCheckoutAction(src.Uses) {
+		return nil
 	}
-	return nil
-}
-
-func isTriggersEmpty(src *github.On) bool {
-	return (src.Push == nil || len(src.Push.Branches) == 0) &&
-		(src.PullRequest == nil || len(src.PullRequest.Branches) == 0)
+	dst := new(harness.CloneStage)
+	if src.With != nil {
+		if depth, ok := src.With["fetch-depth"]; ok {
+			dst.Depth, _ = toInt64(depth)
+		}
+	}
+	return dst
 }
 
 func toInt64(value interface{}) (int64, error) {
@@ -302,20 +343,16 @@ func isCheckoutAction(action string) bool {
 	return matched
 }
 
-func convertRunsOn(src string) *harness.Platform {
-	if src == "" {
+// convertEnv returns a copy of the environment variable
+// map with the expressions converted.
+func convertEnv(src map[string]string, ctx *context) map[string]string {
+	if src == nil {
 		return nil
 	}
-	dst := new(harness.Platform)
-	switch {
-	case strings.Contains(src, "windows"), strings.Contains(src, "win"):
-		dst.Os = harness.OSWindows.String()
-	case strings.Contains(src, "darwin"), strings.Contains(src, "macos"), strings.Contains(src, "mac"):
-		dst.Os = harness.OSDarwin.String()
-	default:
-		dst.Os = harness.OSLinux.String()
+	dst := map[string]string{}
+	for k, v := range src {
+		dst[k] = convertExprs(v, false, ctx)
 	}
-	dst.Arch = harness.ArchAmd64.String() // we assume amd64 for now
 	return dst
 }
 
@@ -328,18 +365,27 @@ func copyEnv(src map[string]string) map[string]string {
 	return dst
 }
 
-func convertSteps(src *github.Job) []*harness.Step {
+func (d *Converter) convertSteps(src *github.Job, ctx *context) []*harness.Step {
+	steps := d.convertServices(src.Services, ctx)
+	return append(steps, d.convertStepList(src.Steps, src.Container, nil, ctx)...)
+}
+
+// convertStepList converts the steps. The path contains the
+// local actions that are being inlined, and is used to
+// detect cycles.
+func (d *Converter) convertStepList(src []*github.Step, container *github.Container, path []string, ctx *context) []*harness.Step {
 	var steps []*harness.Step
-	for serviceName, service := range src.Services {
-		if service != nil {
-			steps = append(steps, convertServices(service, serviceName))
-		}
-	}
-	for _, step := range src.Steps {
+	for _, step := range src {
 		if isCheckoutAction(step.Uses) {
 			continue
 		}
+		// the run defaults do not apply to the steps of
+		// the inlined actions.
+		if len(path) == 0 {
+			step = withDefaults(step, ctx)
+		}
 		dst := &harness.Step{
+			Id:   step.ID,
 			Name: step.Name,
 		}
 
@@ -351,28 +397,47 @@ func convertSteps(src *github.Job) []*harness.Step {
 			dst.Timeout = convertTimeout(step)
 		}
 
-		if step.Uses != "" {
-			dst.Name = step.Name
-			dst.Spec = convertAction(step)
-			dst.Type = "action"
-		} else {
-			dst.Name = step.Name
-			dst.Spec = convertRun(step, src.Container)
+		if step.If != "" {
+			dst.When = convertStepIf(step, ctx)
+		}
+
+		switch {
+		case strings.HasPrefix(step.Uses, "docker://"):
+			dst.Spec = convertDockerAction(step, strings.TrimPrefix(step.Uses, "docker://"), nil, ctx)
+			dst.Type = "script"
+		case strings.HasPrefix(step.Uses, "./"):
+			if !d.convertLocalAction(dst, step, container, path, ctx) {
+				dst.Spec = convertAction(step, ctx)
+				dst.Type = "action"
+			}
+		case step.Uses != "":
+			if !convertUses(dst, step, ctx) {
+				continue
+			}
+		default:
+			dst.Spec = d.convertRun(step, container, ctx)
 			dst.Type = "script"
 		}
+		convertStepEnv(dst, step, ctx)
+		if spec, ok := dst.Spec.(*harness.StepExec); ok && step.Run != "" {
+			if isPosixShell(step, ctx) {
+				convertOutputs(dst, spec, step, ctx)
+			}
+			convertShell(spec, step, ctx)
+		}
 		steps = append(steps, dst)
 	}
 	return steps
 }
 
-func convertAction(src *github.Step) *harness.StepAction {
+func convertAction(src *github.Step, ctx *context) *harness.StepAction {
 	if src == nil {
 		return nil
 	}
 	dst := &harness.StepAction{
 		Uses: src.Uses,
 		With: make(map[string]interface{}),
-		Envs: src.Env,
+		Envs: convertEnv(src.Env, ctx),
 	}
 	for key, value := range src.With {
 		switch v := value.(type) {
@@ -384,7 +449,7 @@ func convertAction(src *github.Step) *harness.StepAction {
 			if strings.HasPrefix(v, "'") && strings.HasSuffix(v, "'") {
 				dst.With[key] = value
 			} else {
-				dst.With[key] = fmt.Sprintf("%s", v)
+				dst.With[key] = convertExprs(v, false, ctx)
 			}
 		default:
 			dst.With[key] = value
@@ -411,37 +476,24 @@ func convertContinueOnError(src *github.Step) *harness.FailureList {
 	}
 }
 
-func convertRun(src *github.Step, container *github.Container) *harness.StepExec {
+func (d *Converter) convertRun(src *github.Step, container *github.Container, ctx *context) *harness.StepExec {
 	if src == nil {
 		return nil
 	}
 	dst := &harness.StepExec{
-		Run:  src.Run,
-		Envs: src.Env,
+		Run:  convertExprs(src.Run, true, ctx),
+		Envs: convertEnv(src.Env, ctx),
 	}
 	if container != nil {
-		dst.Image = container.Image
+		d.convertContainer(dst, container, ctx)
+	} else if ctx.stage != nil {
+		// the image is set by the setup actions that
+		// precede the step.
+		dst.Image = ctx.stage.image
 	}
 	return dst
 }
 
-func convertServices(service *github.Service, serviceName string) *harness.Step {
-	if service == nil {
-		return nil
-	}
-	return &harness.Step{
-		Name: serviceName,
-		Type: "background",
-		Spec: &harness.StepBackground{
-			Image: service.Image,
-			Envs:  service.Env,
-			Mount: convertMounts(service.Volumes),
-			Ports: service.Ports,
-			Args:  service.Options,
-		},
-	}
-}
-
 func convertTimeout(src *github.Step) string {
 	if src == nil || src.Timeout == 0 {
 		return "0"
@@ -471,35 +523,3 @@ func convertMounts(volumes []string) []*harness.Mount {
 
 	return dst
 }
-
-func convertStrategy(src *github.Strategy) *harness.Strategy {
-	if src == nil || src.Matrix == nil {
-		return nil
-	}
-
-	matrix := src.Matrix
-
-	includeMaps := convertInterfaceMapsToStringMaps(matrix.Include)
-	excludeMaps := convertInterfaceMapsToStringMaps(matrix.Exclude)
-	dst := &harness.Strategy{
-		Type: "matrix",
-		Spec: &harness.Matrix{
-			Axis:    matrix.Matrix,
-			Include: includeMaps,
-			Exclude: excludeMaps,
-		},
-	}
-	return dst
-}
-
-func convertInterfaceMapsToStringMaps(maps []map[string]interface{}) []map[string]string {
-	convertedMaps := make([]map[string]string, len(maps))
-	for i, originalMap := range maps {
-		convertedMap := make(map[string]string)
-		for key, value := range originalMap {
-			convertedMap[key] = fmt.Sprintf("%v", value)
-		}
-		convertedMaps[i] = convertedMap
-	}
-	return convertedMaps
-}
@@ -15,11 +15,18 @@
 package github
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"path/filepath"
 	"sort"
 	"testing"
+	"time"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
 
 	"github.com/google/go-cmp/cmp"
 	"gopkg.in/yaml.v3"
@@ -34,23 +41,27 @@ func TestConvert(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test, func(t *testing.T) {
-			// convert the yaml file from github to harness
-			converter := New()
+			// convert the yaml file from github to harness.
+			// reusable workflows are loaded relative to the
+			// test directory.
+			converter := New(
+				WithRoot(filepath.Dir(test)),
+				WithWorkflowCache(filepath.Join(filepath.Dir(test), "cache")),
+			)
 			tmp1, err := converter.ConvertFile(test)
 			if err != nil {
 				t.Error(err)
 				return
 			}
 
-			// unmarshal the converted yaml file to a map
-			got := map[string]interface{}{}
-			if err := yaml.Unmarshal(tmp1, &got); err != nil {
+			// unmarshal the converted yaml documents, the
+			// pipeline and triggers, to maps
+			got, err := unmarshalDocuments(tmp1)
+			if err != nil {
 				t.Error(err)
 				return
 			}
 
-			got = normalizeMap(got)
-
 			// parse the golden yaml file
 			data, err := ioutil.ReadFile(test + ".golden")
 			if err != nil {
@@ -58,15 +69,13 @@ func TestConvert(t *testing.T) {
 				return
 			}
 
-			// unmarshal the golden yaml file to a map
-			want := map[string]interface{}{}
-			if err := yaml.Unmarshal(data, &want); err != nil {
+			// unmarshal the golden yaml documents to maps
+			want, err := unmarshalDocuments(data)
+			if err != nil {
 				t.Error(err)
 				return
 			}
 
-			want = normalizeMap(want)
-
 			// compare the converted yaml to the golden file
 			if diff := cmp.Diff(got, want); diff != "" {
 				t.Errorf("Unexpected conversion result")
@@ -76,6 +85,22 @@ func TestConvert(t *testing.T) {
 	}
 }
 
+// unmarshalDocuments unmarshals the yaml documents to
+// normalized maps.
+func unmarshalDocuments(b []byte) ([]map[string]interface{}, error) {
+	var docs []map[string]interface{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	for {
+		doc := map[string]interface{}{}
+		if err := dec.Decode(&doc); err == io.EOF {
+			return docs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		docs = append(docs, normalizeMap(doc))
+	}
+}
+
 func normalizeMap(m map[string]interface{}) map[string]interface{} {
 	normalized := make(map[string]interface{}, len(m))
 	keys := make([]string, 0, len(m))
@@ -130,3 +155,605 @@ func normalizeSlice(s []interface{}) []interface{} {
 	})
 	return s
 }
+
+func TestSortJobs(t *testing.T) {
+	jobs := map[string]*github.Job{
+		"deploy":  {Needs: []string{"lint", "test"}},
+		"test":    {Needs: []string{"build"}},
+		"lint":    {Needs: []string{"build"}},
+		"build":   {},
+		"docs":    {Needs: []string{"unknown"}},
+		"cleanup": {Needs: []string{"deploy"}},
+	}
+	want := [][]string{
+		{"build", "docs"},
+		{"lint", "test"},
+		{"deploy"},
+		{"cleanup"},
+	}
+	for i := 0; i < 10; i++ {
+		r := report.New()
+		got, err := sortJobs(jobs, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("Unexpected job order: %s", diff)
+		}
+		if diff := cmp.Diff([]string{`job "docs": needs unknown job "unknown", the dependency is ignored`}, r.Notes()); diff != "" {
+			t.Fatalf("Unexpected notes: %s", diff)
+		}
+	}
+}
+
+func TestSortJobsCycle(t *testing.T) {
+	jobs := map[string]*github.Job{
+		"a": {Needs: []string{"b"}},
+		"b": {Needs: []string{"a"}},
+	}
+	if _, err := sortJobs(jobs, report.New()); err == nil {
+		t.Errorf("Expected dependency cycle error")
+	}
+}
+
+func TestConvertCondition(t *testing.T) {
+	tests := []struct {
+		before, after string
+		noted         bool
+	}{
+		{"github.event_name == 'push'", "<+trigger.event> == 'PUSH'", false},
+		{"'pull_request' != github.event_name", "'PR' != <+trigger.event>", false},
+		{"github.event_name == 'release'", "<+trigger.event> == 'release'", true},
+		{"${{ github.ref == 'refs/heads/main' }}", "<+trigger.payload.ref> == 'refs/heads/main'", false},
+		{"!contains(github.event.head_commit.message, 'skip ci')", "!<+codebase.commitMessage>.toLowerCase().contains('skip ci')", false},
+		{"contains(github.event.head_commit.message, 'Skip CI')", "<+codebase.commitMessage>.toLowerCase().contains('skip ci')", false},
+		{"startsWith(github.ref, 'refs/tags/') && endsWith(github.ref, '-rc')", "<+trigger.payload.ref>.toLowerCase().startsWith('refs/tags/') && <+trigger.payload.ref>.toLowerCase().endsWith('-rc')", false},
+		{"(matrix.os == 'linux' || matrix.os == 'mac') && inputs.deploy", "(<+matrix.os> == 'linux' || <+matrix.os> == 'mac') && <+inputs.deploy>", false},
+		{"matrix['node-version'] >= 16", "<+matrix.node-version> >= 16", false},
+		{"github.event.commits[0].author.name == 'bot'", "<+trigger.payload.commits[0].author.name> == 'bot'", false},
+		{"format('v{0}-{1}', github.run_number, matrix.os) == 'v1-{x}'", "'v' + <+pipeline.sequenceId> + '-' + <+matrix.os> == 'v1-{x}'", false},
+		{"fromJSON('true') && needs.build.result == 'success'", "true && <+pipeline.stages.build.status> == 'success'", false},
+		{"steps.meta.outputs.version != ''", "<+steps.meta.output.outputVariables.version> != ''", false},
+		{"github.actor == 'it''s'", `<+trigger.gitUser> == 'it\'s'`, false},
+		{"0xff == 255", "255 == 255", false},
+		{"contains(github.event.pull_request.labels.*.name, 'deploy')", `<+trigger.payload.pull_request.labels>.toString() =~ '(?is).*[{ ,]"?name"?[=:] ?"?deploy"?[,}].*'`, false},
+		{"contains(github.event.pull_request.labels.*.name, github.ref)", "contains(github.event.pull_request.labels.*.name, github.ref)", true},
+		{"contains(fromJSON('[\"push\", \"pull_request\"]'), github.event_name)", "<+trigger.event> =~ ['push', 'pull_request']", false},
+		{"fromJSON('{\"os\": [\"linux\"], \"go\": 1.21}')", "{'go': 1.21, 'os': ['linux']}", false},
+		{"fromJSON(needs.build.outputs.config).deploy", "fromJSON(needs.build.outputs.config).deploy", true},
+		{"fromJSON(steps.meta.outputs.json) == 'x'", "<+json.object(<+steps.meta.output.outputVariables.json>)> == 'x'", false},
+		{"toJSON(fromJSON('[1, 2]')) == '[1,2]'", "'[1,2]' == '[1,2]'", false},
+		{"toJSON(github.event.pull_request) != ''", "<+json.format(<+trigger.payload.pull_request>)> != ''", false},
+		{"join(fromJSON('[\"a\", \"b\"]'), '-') == 'a-b'", "'a-b' == 'a-b'", false},
+		{"join(matrix.os) == 'linux'", `<+matrix.os>.toString().replaceAll('^\\[|\\]$', '').replace(', ', ',') == 'linux'`, true},
+		{"join(github.event.pull_request.labels.*.name, ', ')", "join(github.event.pull_request.labels.*.name, ', ')", true},
+		{"hashFiles('**/go.sum') != ''", "hashFiles('**/go.sum') != ''", true},
+		{"github.ref == 'main", "github.ref == 'main", true},
+	}
+	for _, test := range tests {
+		ctx := newTestContext()
+		if got, want := convertCondition(test.before, ctx), test.after; got != want {
+			t.Errorf("Want condition %q converted to %q, got %q", test.before, want, got)
+		}
+		if got, want := len(ctx.report.Notes()) != 0, test.noted; got != want {
+			t.Errorf("Want condition %q reported %v, got %v", test.before, want, got)
+		}
+	}
+}
+
+func TestConvertIf(t *testing.T) {
+	tests := []struct {
+		before, status, eval string
+		noted                bool
+	}{
+		{"always()", "all", "", false},
+		{"${{ success() }}", "", "", false},
+		{"failure()", "failure", "", false},
+		{"!cancelled()", "all", "", false},
+		{"success() || failure()", "all", "", false},
+		{"failure() || cancelled()", "failure", "", false},
+		{"always() && github.ref == 'refs/heads/main'", "all", "<+trigger.payload.ref> == 'refs/heads/main'", false},
+		{"failure() && (matrix.os == 'linux' || matrix.os == 'mac')", "failure", "(<+matrix.os> == 'linux' || <+matrix.os> == 'mac')", false},
+		{"github.event_name == 'push'", "", "<+trigger.event> == 'PUSH'", false},
+		{"cancelled()", "", "false", true},
+		{"failure() || github.event_name == 'push'", "", "failure() || github.event_name == 'push'", true},
+	}
+	for _, test := range tests {
+		ctx := newTestContext()
+		status, eval := convertIf(test.before, ctx)
+		if status != test.status || eval != test.eval {
+			t.Errorf("Want condition %q converted to status %q and %q, got %q and %q", test.before, test.status, test.eval, status, eval)
+		}
+		if got, want := len(ctx.report.Notes()) != 0, test.noted; got != want {
+			t.Errorf("Want condition %q reported %v, got %v", test.before, want, got)
+		}
+	}
+}
+
+func TestConvertExprs(t *testing.T) {
+	tests := []struct {
+		before, after string
+		shell         bool
+	}{
+		{"${{ github.sha }}", "<+codebase.commitSha>", false},
+		{"npm@${{ matrix.npm }} --tag=${{ github.ref_name }}", "npm@<+matrix.npm> --tag=<+codebase.branch>", true},
+		{"echo ${{ env.GREETING }}", "echo ${GREETING}", true},
+		{"echo ${{ hashFiles('**/go.sum', 'src/**/*.lock') }}", `echo $(find . -type f \( -name 'go.sum' -o -path './src/*.lock' \) -exec sha256sum {} + | sort -k 2 | sha256sum | cut -d ' ' -f 1)`, true},
+		{"${{ secrets.NPM_TOKEN }}", `<+secrets.getValue("NPM_TOKEN")>`, false},
+		{"${{ matrix.go == '1.21' }}", "<+<+matrix.go> == '1.21'>", false},
+		{"${{ 'literal' }}", "literal", false},
+		{"${{ env.GREETING }}", "${{ env.GREETING }}", false},
+		{"no expressions", "no expressions", false},
+	}
+	for _, test := range tests {
+		if got, want := convertExprs(test.before, test.shell, newTestContext()), test.after; got != want {
+			t.Errorf("Want %q converted to %q, got %q", test.before, want, got)
+		}
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	ctx := &context{
+		report:  report.New(),
+		secrets: newSecretStore([]string{"NPM_TOKEN"}, []string{"DOCKER_PASSWORD"}),
+	}
+	tests := []struct {
+		before, after string
+	}{
+		{"${{ secrets.DEPLOY_KEY }}", `<+secrets.getValue("DEPLOY_KEY")>`},
+		{"${{ secrets.NPM_TOKEN }}", `<+secrets.getValue("org.NPM_TOKEN")>`},
+		{"${{ secrets.DOCKER_PASSWORD }}", `<+secrets.getValue("account.DOCKER_PASSWORD")>`},
+		{"${{ secrets.GITHUB_TOKEN }}", `<+secrets.getValue("GITHUB_TOKEN")>`},
+		{"${{ github.token }}", `<+secrets.getValue("GITHUB_TOKEN")>`},
+		{"${{ vars.REGION }}", "<+inputs.REGION>"},
+	}
+	for _, test := range tests {
+		if got, want := convertExprs(test.before, false, ctx), test.after; got != want {
+			t.Errorf("Want %q converted to %q, got %q", test.before, want, got)
+		}
+	}
+	if got, want := len(ctx.report.Notes()), 1; got != want {
+		t.Errorf("Want %d note for the github token, got %d", want, got)
+	}
+	if ctx.inputs["REGION"] == nil {
+		t.Errorf("Want pipeline input for configuration variable REGION")
+	}
+}
+
+// newTestContext returns a conversion context for unit
+// tests.
+func newTestContext() *context {
+	return &context{
+		report:  report.New(),
+		secrets: newSecretStore(nil, nil),
+	}
+}
+
+func TestLoadWorkflow_Error(t *testing.T) {
+	d := New(WithRoot("testdata/reusable"))
+	tests := []struct {
+		uses string
+		path []string
+	}{
+		{"./.github/workflows/build.yml", []string{"./.github/workflows/build.yml"}},
+		{"./.github/workflows/missing.yml", nil},
+		{"acme/shared/.github/workflows/notify.yml@v1", nil},
+	}
+	for _, test := range tests {
+		if _, err := d.loadWorkflow(test.uses, test.path); err == nil {
+			t.Errorf("Expect error loading reusable workflow %q", test.uses)
+		}
+	}
+}
+
+func TestMarketplaceActions(t *testing.T) {
+	tests := []struct {
+		uses  string
+		with  map[string]interface{}
+		typ   string // converted step type, empty if removed
+		image string // image of the plugin or run steps
+	}{
+		{"actions/setup-go@v4", map[string]interface{}{"go-version": "1.21.x"}, "", "golang:1.21"},
+		{"actions/setup-go@v5", map[string]interface{}{"go-version": "stable"}, "", "golang:latest"},
+		{"actions/setup-go@v5", map[string]interface{}{"go-version-file": "go.mod"}, "action", ""},
+		{"actions/setup-go@v2", map[string]interface{}{"go-version": "1.21"}, "action", ""},
+		{"actions/setup-node@v3", map[string]interface{}{"node-version": "18.x"}, "", "node:18"},
+		{"actions/setup-node@v4", map[string]interface{}{"node-version": "lts/*"}, "", "node:lts"},
+		{"actions/setup-python@v4", map[string]interface{}{"python-version": "3.11"}, "", "python:3.11"},
+		{"actions/setup-python@v5", map[string]interface{}{"python-version": "pypy3.10"}, "", "pypy:3.10"},
+		{"actions/setup-java@v3", map[string]interface{}{"distribution": "temurin", "java-version": "17"}, "", "eclipse-temurin:17"},
+		{"actions/setup-java@v4", map[string]interface{}{"distribution": "corretto", "java-version": "21"}, "", "amazoncorretto:21"},
+		{"actions/setup-java@v4", map[string]interface{}{"distribution": "oracle", "java-version": "21"}, "action", ""},
+		{"actions/cache@v3", map[string]interface{}{"path": "node_modules", "key": "npm"}, "", ""},
+		{"actions/cache@v4", map[string]interface{}{"path": "node_modules", "key": "npm"}, "", ""},
+		{"actions/upload-artifact@v3", map[string]interface{}{"name": "dist", "path": "dist/"}, "plugin", "plugins/s3-cache"},
+		{"actions/upload-artifact@v4", map[string]interface{}{"name": "dist", "path": "dist/"}, "plugin", "plugins/s3-cache"},
+		{"actions/download-artifact@v4", map[string]interface{}{"name": "dist"}, "plugin", "plugins/s3-cache"},
+		{"docker/login-action@v3", map[string]interface{}{"username": "octocat"}, "", ""},
+		{"docker/setup-buildx-action@v3", nil, "", ""},
+		{"docker/build-push-action@v5", map[string]interface{}{"tags": "acme/app:1.0"}, "plugin", "plugins/docker"},
+		{"docker/build-push-action@v6", map[string]interface{}{"tags": "acme/app:1.0", "push": true}, "template", ""},
+		{"codecov/codecov-action@v3", map[string]interface{}{"files": "coverage.out"}, "plugin", "plugins/codecov"},
+		{"codecov/codecov-action@v4", map[string]interface{}{"files": "coverage.out"}, "plugin", "plugins/codecov"},
+		{"softprops/action-gh-release@v1", map[string]interface{}{"files": "dist/*"}, "plugin", "plugins/github-release"},
+		{"softprops/action-gh-release@v2", map[string]interface{}{"files": "dist/*"}, "plugin", "plugins/github-release"},
+		{"softprops/action-gh-release@de2c0eb89ae2a093876385947365aca7b0e5f844", nil, "plugin", "plugins/github-release"},
+		{"octo-org/custom-action@v1", nil, "action", ""},
+	}
+	for _, test := range tests {
+		ctx := newTestContext()
+		ctx.stage = &stageState{platform: &harness.Platform{Os: "linux", Arch: "amd64"}}
+		src := &github.Step{Uses: test.uses, With: test.with}
+		dst := new(harness.Step)
+		if ok := convertUses(dst, src, ctx); ok != (test.typ != "") {
+			t.Errorf("%s: want step kept %v, got %v", test.uses, test.typ != "", ok)
+			continue
+		}
+		if got, want := dst.Type, test.typ; got != want {
+			t.Errorf("%s: want step type %q, got %q", test.uses, want, got)
+		}
+		var image string
+		switch spec := dst.Spec.(type) {
+		case *harness.StepPlugin:
+			image = spec.Image
+		case nil:
+			image = ctx.stage.image
+		}
+		if got, want := image, test.image; got != want {
+			t.Errorf("%s: want image %q, got %q", test.uses, want, got)
+		}
+	}
+}
+
+func TestMarketplaceActions_Platform(t *testing.T) {
+	for _, os := range []string{harness.OSWindows.String(), harness.OSDarwin.String()} {
+		ctx := newTestContext()
+		ctx.stage = &stageState{platform: &harness.Platform{Os: os, Arch: "amd64"}}
+		src := &github.Step{Uses: "actions/setup-go@v5", With: map[string]interface{}{"go-version": "1.21"}}
+		dst := new(harness.Step)
+		if !convertUses(dst, src, ctx) {
+			t.Errorf("%s: want setup action kept", os)
+			continue
+		}
+		if got, want := dst.Type, "action"; got != want {
+			t.Errorf("%s: want step type %q, got %q", os, want, got)
+		}
+		if ctx.stage.image != "" {
+			t.Errorf("%s: want run step image unset, got %q", os, ctx.stage.image)
+		}
+	}
+}
+
+func TestDockerBuildPush(t *testing.T) {
+	tests := []struct {
+		login         map[string]interface{}
+		dockerhubConn string
+		want          map[string]interface{}
+	}{
+		{
+			login: map[string]interface{}{"registry": "ghcr.io", "username": "octocat"},
+			want: map[string]interface{}{
+				"connector": "ghcrio",
+				"registry":  "ghcr.io",
+				"repo":      "ghcr.io/acme/app",
+				"tags":      []interface{}{"1.0"},
+				"build_args": map[string]interface{}{
+					"GO_VERSION": "1.21",
+				},
+			},
+		},
+		{
+			login:         map[string]interface{}{"username": "octocat"},
+			dockerhubConn: "account.docker",
+			want: map[string]interface{}{
+				"connector": "account.docker",
+				"repo":      "ghcr.io/acme/app",
+				"tags":      []interface{}{"1.0"},
+				"build_args": map[string]interface{}{
+					"GO_VERSION": "1.21",
+				},
+			},
+		},
+		{
+			want: map[string]interface{}{
+				"connector": "<+input>",
+				"repo":      "ghcr.io/acme/app",
+				"tags":      []interface{}{"1.0"},
+				"build_args": map[string]interface{}{
+					"GO_VERSION": "1.21",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		ctx := newTestContext()
+		ctx.dockerhubConn = test.dockerhubConn
+		ctx.stage = new(stageState)
+		if test.login != nil {
+			convertUses(new(harness.Step), &github.Step{Uses: "docker/login-action@v3", With: test.login}, ctx)
+		}
+		dst := new(harness.Step)
+		convertUses(dst, &github.Step{Uses: "docker/build-push-action@v5", With: map[string]interface{}{
+			"tags":       "ghcr.io/acme/app:1.0",
+			"build-args": "GO_VERSION=1.21",
+			"push":       true,
+		}}, ctx)
+		spec, ok := dst.Spec.(*stepTemplate)
+		if !ok {
+			t.Errorf("Want build and push template step, got %T", dst.Spec)
+			continue
+		}
+		if got, want := spec.Uses, "buildAndPushDockerRegistry"; got != want {
+			t.Errorf("Want template %q, got %q", want, got)
+		}
+		if diff := cmp.Diff(spec.With, test.want); diff != "" {
+			t.Errorf("Unexpected build and push inputs")
+			t.Log(diff)
+		}
+	}
+}
+
+func TestDockerBuildPush_Push(t *testing.T) {
+	ctx := newTestContext()
+	ctx.stage = new(stageState)
+	dst := new(harness.Step)
+	convertUses(dst, &github.Step{Uses: "docker/build-push-action@v5", With: map[string]interface{}{
+		"tags":       "acme/app:1.0",
+		"build-args": "LIST=a,b\nNAME=app",
+		"push":       "${{ github.event_name != 'pull_request' }}",
+	}}, ctx)
+	spec, ok := dst.Spec.(*stepTemplate)
+	if !ok {
+		t.Fatalf("Want build and push template step, got %T", dst.Spec)
+	}
+	if dst.When == nil || dst.When.Eval != "<+trigger.event> != 'PR'" {
+		t.Errorf("Want the push expression converted to a step condition, got %+v", dst.When)
+	}
+	want := map[string]interface{}{"LIST": "a,b", "NAME": "app"}
+	if diff := cmp.Diff(spec.With["build_args"], want); diff != "" {
+		t.Errorf("Unexpected build arguments")
+		t.Log(diff)
+	}
+}
+
+func TestMatrixCombinations(t *testing.T) {
+	// https://docs.github.com/en/actions/using-jobs/using-a-matrix-for-your-jobs#example-expanding-configurations
+	matrix := &github.Matrix{
+		Matrix: map[string][]string{
+			"fruit":  {"apple", "pear"},
+			"animal": {"cat", "dog"},
+		},
+		Exclude: []map[string]interface{}{
+			{"fruit": "pear", "animal": "cat"},
+		},
+		Include: []map[string]interface{}{
+			{"color": "green"},
+			{"color": "pink", "animal": "cat"},
+			{"fruit": "apple", "shape": "circle"},
+			{"fruit": "banana"},
+			{"fruit": "banana", "animal": "cat"},
+		},
+	}
+	want := []map[string]string{
+		{"fruit": "apple", "animal": "cat", "color": "pink", "shape": "circle"},
+		{"fruit": "apple", "animal": "dog", "color": "green", "shape": "circle"},
+		{"fruit": "pear", "animal": "dog", "color": "green"},
+		{"fruit": "banana"},
+		{"fruit": "banana", "animal": "cat"},
+	}
+	got := matrixCombinations(matrix)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected matrix combinations: %s", diff)
+	}
+
+	// the explicit combinations matrix excludes the other
+	// combinations of the axis values.
+	spec := combinationMatrix(got)
+	combos := product([]string{"animal", "color", "fruit", "shape"}, spec.Axis)
+	if got, want := len(combos)-len(spec.Exclude), len(want); got != want {
+		t.Errorf("Want %d combinations, got %d", want, got)
+	}
+}
+
+func TestMatrixRunsOn(t *testing.T) {
+	tests := []struct {
+		runsOn string
+		axis   string
+	}{
+		{"${{ matrix.os }}", "os"},
+		{"${{ matrix['platform'] }}", "platform"},
+		{"ubuntu-latest", ""},
+		{"${{ inputs.runner }}", ""},
+	}
+	for _, test := range tests {
+		if got, _ := matrixAxis(test.runsOn); got != test.axis {
+			t.Errorf("Want runs-on %q axis %q, got %q", test.runsOn, test.axis, got)
+		}
+	}
+}
+
+func TestConvertRunsOn(t *testing.T) {
+	tests := []struct {
+		labels   []string
+		group    string
+		os, arch string
+		runtime  string
+		size     string
+		delegate []string
+	}{
+		{[]string{"ubuntu-latest"}, "", "linux", "amd64", "cloud", "", nil},
+		{[]string{"ubuntu-22.04-arm"}, "", "linux", "arm64", "cloud", "", nil},
+		{[]string{"windows-2022"}, "", "windows", "amd64", "cloud", "", nil},
+		{[]string{"macos-13"}, "", "darwin", "amd64", "cloud", "", nil},
+		{[]string{"macos-14"}, "", "darwin", "arm64", "cloud", "", nil},
+		{[]string{"macos-latest-large"}, "", "darwin", "amd64", "cloud", "large", nil},
+		{[]string{"ubuntu-22.04-16core"}, "", "linux", "amd64", "cloud", "xlarge", nil},
+		{[]string{"self-hosted", "linux", "ARM64", "gpu"}, "", "linux", "arm64", "machine", "", []string{"gpu-delegate"}},
+		{[]string{"self-hosted", "build"}, "", "linux", "amd64", "machine", "", []string{"build"}},
+		{[]string{"k8s"}, "", "linux", "amd64", "kubernetes", "", nil},
+		{nil, "ci-runners", "linux", "amd64", "machine", "", []string{"ci-runners"}},
+		{[]string{"ubuntu-22.04-8core"}, "larger-runners", "linux", "amd64", "cloud", "large", nil},
+	}
+	d := New(WithRunners(map[string]string{"gpu": "gpu-delegate", "k8s": KubernetesRunner}))
+	for _, test := range tests {
+		src := &github.RunsOn{Group: test.group, Labels: test.labels}
+		got := d.convertRunsOn("test", src, newTestContext())
+		if got.platform.Os != test.os || got.platform.Arch != test.arch {
+			t.Errorf("Want runs-on %v platform %s/%s, got %s/%s", test.labels, test.os, test.arch, got.platform.Os, got.platform.Arch)
+		}
+		if got.runtime.Type != test.runtime {
+			t.Errorf("Want runs-on %v runtime %s, got %s", test.labels, test.runtime, got.runtime.Type)
+		}
+		if cloud, ok := got.runtime.Spec.(*harness.RuntimeCloud); ok && cloud.Size != test.size {
+			t.Errorf("Want runs-on %v size %q, got %q", test.labels, test.size, cloud.Size)
+		}
+		if diff := cmp.Diff(got.delegate, test.delegate); diff != "" {
+			t.Errorf("Unexpected runs-on %v delegate selectors", test.labels)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestRefCondition(t *testing.T) {
+	tests := []struct {
+		patterns, ignore []string
+		prefix           string
+		operator, value  string
+	}{
+		{[]string{"main", "develop"}, nil, "", "In", "main, develop"},
+		{nil, []string{"gh-pages"}, "", "NotIn", "gh-pages"},
+		{[]string{"releases/**"}, nil, "", "Regex", "^(?:releases/.*)$"},
+		{[]string{"feature/*", "!feature/wip"}, nil, "", "Regex", "^(?!(?:feature/wip)$)(?:feature/[^/]*)$"},
+		{[]string{"v[12].*"}, nil, "refs/tags/", "Regex", `^refs/tags/(?:v[12]\.[^/]*)$`},
+		{nil, []string{"v*-rc"}, "refs/tags/", "Regex", "^(?!refs/tags/(?:v[^/]*-rc)$)refs/tags/.*$"},
+	}
+	for _, test := range tests {
+		got := refCondition("ref", test.patterns, test.ignore, test.prefix)
+		if got.Operator != test.operator || got.Value != test.value {
+			t.Errorf("Want patterns %v ignore %v converted to %s %q, got %s %q",
+				test.patterns, test.ignore, test.operator, test.value, got.Operator, got.Value)
+		}
+	}
+}
+
+func TestParseEnvFileWrite(t *testing.T) {
+	tests := []struct {
+		line                     string
+		file, name, value, quote string
+		ok                       bool
+	}{
+		{`echo "version=1.2.3" >> $GITHUB_OUTPUT`, "GITHUB_OUTPUT", "version", "1.2.3", `"`, true},
+		{`echo 'tag=v$1' >> "$GITHUB_OUTPUT"`, "GITHUB_OUTPUT", "tag", "v$1", `'`, true},
+		{`echo GOFLAGS=-mod=mod >> ${GITHUB_ENV}`, "GITHUB_ENV", "GOFLAGS", "-mod=mod", `"`, true},
+		{`echo "$HOME/.local/bin" >> $GITHUB_PATH`, "GITHUB_PATH", "", "$HOME/.local/bin", `"`, true},
+		{`echo "::set-output name=dir::$(go env GOCACHE)"`, "GITHUB_OUTPUT", "dir", "$(go env GOCACHE)", `"`, true},
+		{`echo "version=1.2.3" > version.txt`, "", "", "", "", false},
+		{`echo "$NAME=1" >> $GITHUB_ENV`, "", "", "", "", false},
+	}
+	for _, test := range tests {
+		_, file, name, value, quote, ok := parseEnvFileWrite(test.line)
+		if file != test.file || name != test.name || value != test.value || quote != test.quote || ok != test.ok {
+			t.Errorf("Want %q parsed to %s %q=%q (%s), got %s %q=%q (%s)",
+				test.line, test.file, test.name, test.value, test.quote, file, name, value, quote)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	got, unsupported := parseOptions(`--health-cmd "pg_isready -U postgres" --health-interval=10s --health-retries 5 --user 1001 --privileged --restart always`)
+	want := &containerOptions{
+		healthCmd:      "pg_isready -U postgres",
+		healthInterval: 10 * time.Second,
+		healthRetries:  5,
+		user:           "1001",
+		privileged:     true,
+	}
+	if *got != *want {
+		t.Errorf("Want options %+v, got %+v", want, got)
+	}
+	if diff := cmp.Diff(unsupported, []string{"--restart always"}); diff != "" {
+		t.Errorf("Unexpected unsupported options")
+		t.Log(diff)
+	}
+}
+
+func TestHealthCommand(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+		ok   bool
+	}{
+		{"pg_isready -U postgres", "pg_isready -h db -U postgres", true},
+		{"redis-cli ping", "redis-cli -h db ping", true},
+		{"mongosh --eval 'db.runCommand(\"ping\")'", "mongosh --host db --eval 'db.runCommand(\"ping\")'", true},
+		{"mysqladmin ping -h mysql", "mysqladmin ping -h mysql", true},
+		{"curl -f http://localhost:8080/health", "curl -f http://db:8080/health", true},
+		{"/healthcheck.sh", "", false},
+	}
+	for _, test := range tests {
+		got, ok := healthCommand(test.cmd, "db")
+		if got != test.want || ok != test.ok {
+			t.Errorf("Want health command %q converted to %q (%v), got %q (%v)", test.cmd, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+func TestConvertEnvironment(t *testing.T) {
+	d := New(WithEnvironments(map[string]*Environment{
+		"production": {Approvers: []string{"release-managers"}},
+	}))
+	job := &github.Job{Environment: &github.Environment{Name: "production"}}
+	stage := d.convertEnvironment("deploy", job, newTestContext())
+	if stage == nil {
+		t.Fatalf("Want approval stage for the production environment")
+	}
+	step := stage.Spec.(*stageSteps).Steps[0]
+	want := &stepApproval{
+		Message: "deploy deploy to production",
+		Approvers: &approvers{
+			UserGroups:   []string{"release-managers"},
+			MinimumCount: 1,
+		},
+	}
+	if diff := cmp.Diff(step.Spec, interface{}(want)); diff != "" {
+		t.Errorf("Unexpected approval step")
+		t.Log(diff)
+	}
+
+	job.Environment.Name = "staging"
+	if stage := d.convertEnvironment("deploy", job, newTestContext()); stage != nil {
+		t.Errorf("Want no approval stage for an environment without approvers")
+	}
+}
+
+func TestConvertDir(t *testing.T) {
+	got, err := New().ConvertDir("testdata/directory/.github/workflows")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, workflow := range got.Workflows {
+		ids = append(ids, workflow.Identifier)
+	}
+	if diff := cmp.Diff(ids, []string{"ci", "deploy", "release"}); diff != "" {
+		t.Errorf("Unexpected pipeline identifiers")
+		t.Log(diff)
+	}
+
+	if len(got.Templates) != 1 || got.Templates[0].Identifier != "lint" {
+		t.Errorf("Want the shared lint stage converted to a template")
+	} else if diff := cmp.Diff(got.Templates[0].Pipelines, []string{"ci", "release"}); diff != "" {
+		t.Errorf("Unexpected template pipelines")
+		t.Log(diff)
+	}
+
+	summary, err := ioutil.ReadFile("testdata/directory/summary.md.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(got.Summary), string(summary)); diff != "" {
+		t.Errorf("Unexpected summary")
+		t.Log(diff)
+	}
+}
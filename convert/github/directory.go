@@ -0,0 +1,505 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	v0 "github.com/hunain-avyka/Go-drone/convert/harness/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+	"github.com/hunain-avyka/Go-drone/internal/slug"
+	"github.com/hunain-avyka/Go-drone/internal/store"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+
+	"github.com/ghodss/yaml"
+)
+
+// Directory is the result of converting a workflow
+// directory.
+type Directory struct {
+	// Workflows are the converted workflows, sorted by
+	// path.
+	Workflows []*Workflow
+
+	// Templates are the stage templates of the jobs that
+	// are shared by the workflows.
+	Templates []*Template
+
+	// Summary describes the converted workflows and the
+	// references between them, in markdown.
+	Summary []byte
+}
+
+// Workflow is a workflow converted to a pipeline.
+type Workflow struct {
+	// Path is the workflow path, relative to the
+	// workflow directory.
+	Path string
+
+	// Name is the workflow name.
+	Name string
+
+	// Identifier is the pipeline identifier, which is
+	// unique in the directory.
+	Identifier string
+
+	// Pipeline is the pipeline yaml, including the
+	// triggers.
+	Pipeline []byte
+}
+
+// Template is a stage template.
+type Template struct {
+	// Identifier is the template identifier, which is
+	// unique in the directory.
+	Identifier string
+
+	// Name is the name of the templated stage.
+	Name string
+
+	// Pipelines are the identifiers of the pipelines
+	// that use the template.
+	Pipelines []string
+
+	// Template is the template yaml.
+	Template []byte
+}
+
+// stageTemplate defines the spec of a stage that uses a
+// stage template.
+type stageTemplate struct {
+	Uses string `json:"uses,omitempty"`
+}
+
+// directoryWorkflow stores the state of a workflow while
+// the directory is converted.
+type directoryWorkflow struct {
+	*Workflow
+	src      *github.Pipeline
+	ctx      *context
+	config   *harness.Config
+	triggers []*v0.TriggerConfig
+	err      error
+
+	// callers are the identifiers of the pipelines that
+	// call the workflow, if it is a reusable workflow.
+	callers []string
+}
+
+// ConvertDir converts the workflows of the directory to
+// pipelines. Reusable workflows that are only triggered by
+// workflow_call are inlined into the calling pipelines,
+// workflow_run triggers reference the pipeline identifiers
+// of the upstream workflows, and identical stages that are
+// shared by multiple pipelines are converted to stage
+// templates.
+func (d *Converter) ConvertDir(dir string) (*Directory, error) {
+	// reusable workflows and local actions are loaded
+	// relative to the repository root, which defaults to
+	// the repository that contains the directory.
+	conv := d
+	if d.root == "" {
+		dup := *d
+		dup.root = workflowRoot(dir)
+		conv = &dup
+	}
+
+	paths, err := workflowFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := store.New()
+	names := map[string]string{}
+	var workflows []*directoryWorkflow
+	for _, path := range paths {
+		rel, _ := filepath.Rel(dir, path)
+		src, err := github.ParseFile(path)
+		if err != nil {
+			workflows = append(workflows, &directoryWorkflow{
+				Workflow: &Workflow{Path: filepath.ToSlash(rel)},
+				err:      err,
+			})
+			continue
+		}
+		name := src.Name
+		if name == "" {
+			// github names the workflow after the file path
+			// if the workflow has no name.
+			name = filepath.ToSlash(rel)
+		}
+		base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		id := ids.Generate(slug.Create(src.Name), slug.Create(base), "pipeline")
+		names[name] = id
+		workflows = append(workflows, &directoryWorkflow{
+			Workflow: &Workflow{
+				Path:       filepath.ToSlash(rel),
+				Name:       name,
+				Identifier: id,
+			},
+			src: src,
+		})
+	}
+
+	// reusable workflows in the directory are recorded
+	// with the pipelines that call them.
+	for _, caller := range workflows {
+		if caller.src == nil {
+			continue
+		}
+		for _, uses := range localCalls(caller.src) {
+			for _, called := range workflows {
+				if called.src != nil && samePath(filepath.Join(conv.root, filepath.FromSlash(uses)), filepath.Join(dir, filepath.FromSlash(called.Path))) {
+					called.callers = appendUnique(called.callers, caller.Identifier)
+				}
+			}
+		}
+	}
+
+	for _, w := range workflows {
+		if w.src == nil || isReusableOnly(w.src) {
+			continue
+		}
+		w.ctx = &context{
+			pipeline:      w.src,
+			report:        report.New(),
+			secrets:       newSecretStore(d.orgSecrets, d.accountSecrets),
+			workflows:     names,
+			dockerhubConn: conv.dockerhubConn,
+		}
+		w.config, w.triggers, w.err = conv.convertPipeline(w.ctx)
+	}
+	reportChains(workflows)
+
+	templates := extractTemplates(workflows)
+
+	out := new(Directory)
+	for _, w := range workflows {
+		if w.config == nil {
+			continue
+		}
+		b, err := marshalPipeline(w.config, w.triggers, w.ctx)
+		if err != nil {
+			return nil, err
+		}
+		w.Pipeline = b
+		out.Workflows = append(out.Workflows, w.Workflow)
+	}
+	out.Templates = templates
+	out.Summary = summarize(workflows, templates)
+	return out, nil
+}
+
+// workflowRoot returns the repository root of the workflow
+// directory.
+func workflowRoot(dir string) string {
+	clean := filepath.Clean(dir)
+	if filepath.Base(clean) == "workflows" && filepath.Base(filepath.Dir(clean)) == ".github" {
+		return filepath.Dir(filepath.Dir(clean))
+	}
+	return clean
+}
+
+// workflowFiles returns the paths of the workflow files in
+// the directory, sorted by path.
+func workflowFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// samePath returns true if the paths reference the same
+// file.
+func samePath(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+// localCalls returns the local reusable workflows called
+// by the workflow jobs.
+func localCalls(src *github.Pipeline) []string {
+	var calls []string
+	for _, job := range src.Jobs {
+		if job != nil && strings.HasPrefix(job.Uses, "./") {
+			calls = append(calls, job.Uses)
+		}
+	}
+	sort.Strings(calls)
+	return calls
+}
+
+// localActions returns the local actions used by the steps
+// of the workflow jobs.
+func localActions(src *github.Pipeline) []string {
+	var actions []string
+	for _, job := range src.Jobs {
+		if job == nil {
+			continue
+		}
+		for _, step := range job.Steps {
+			if step != nil && strings.HasPrefix(step.Uses, "./") {
+				actions = appendUnique(actions, step.Uses)
+			}
+		}
+	}
+	return actions
+}
+
+// isReusableOnly returns true if the workflow is only
+// triggered when it is called by another workflow.
+func isReusableOnly(src *github.Pipeline) bool {
+	if src.On == nil || src.On.WorkflowCall == nil {
+		return false
+	}
+	on := *src.On
+	on.WorkflowCall = nil
+	return on == github.On{}
+}
+
+// extractTemplates replaces the ci stages that are shared
+// by multiple pipelines with stages that use a template.
+// Stages are shared if the converted stages are identical.
+func extractTemplates(workflows []*directoryWorkflow) []*Template {
+	// count the pipelines that contain each stage.
+	users := map[string][]string{}
+	var keys []string
+	for _, w := range workflows {
+		if w.config == nil {
+			continue
+		}
+		walkStages(w.config, func(stage *harness.Stage) *harness.Stage {
+			key := stageKey(stage)
+			if key == "" {
+				return stage
+			}
+			if _, ok := users[key]; !ok {
+				keys = append(keys, key)
+			}
+			users[key] = appendUnique(users[key], w.Identifier)
+			return stage
+		})
+	}
+
+	ids := store.New()
+	byKey := map[string]*Template{}
+	var templates []*Template
+	for _, w := range workflows {
+		if w.config == nil {
+			continue
+		}
+		walkStages(w.config, func(stage *harness.Stage) *harness.Stage {
+			key := stageKey(stage)
+			if len(users[key]) < 2 {
+				return stage
+			}
+			t, ok := byKey[key]
+			if !ok {
+				b, _ := yaml.Marshal(&harness.Config{
+					Version: 1,
+					Kind:    "template",
+					Type:    "stage",
+					Name:    stage.Name,
+					Spec:    stage,
+				})
+				t = &Template{
+					Identifier: ids.Generate(slug.Create(stage.Name), "stage"),
+					Name:       stage.Name,
+					Pipelines:  users[key],
+					Template:   b,
+				}
+				byKey[key] = t
+				templates = append(templates, t)
+			}
+			return &harness.Stage{
+				Name: stage.Name,
+				Type: "template",
+				Spec: &stageTemplate{Uses: t.Identifier},
+			}
+		})
+	}
+	return templates
+}
+
+// walkStages calls the function for the stages of the
+// pipeline, including the stages of parallel stages, and
+// replaces the stages with the returned stages.
+func walkStages(config *harness.Config, fn func(*harness.Stage) *harness.Stage) {
+	pipeline, ok := config.Spec.(*harness.Pipeline)
+	if !ok {
+		return
+	}
+	var walk func([]*harness.Stage)
+	walk = func(stages []*harness.Stage) {
+		for i, stage := range stages {
+			if parallel, ok := stage.Spec.(*stageParallel); ok {
+				walk(parallel.Stages)
+				continue
+			}
+			stages[i] = fn(stage)
+		}
+	}
+	walk(pipeline.Stages)
+}
+
+// stageKey returns the json encoding of a ci stage, which
+// identifies identical stages, or empty if the stage is
+// not a ci stage.
+func stageKey(stage *harness.Stage) string {
+	if stage.Type != "ci" {
+		return ""
+	}
+	b, err := json.Marshal(stage)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// reportChains records in the upstream pipelines that the
+// downstream pipelines of workflow_run triggers must be
+// invoked by hand. The upstream pipelines do not invoke the
+// custom webhook triggers of the downstream pipelines.
+func reportChains(workflows []*directoryWorkflow) {
+	for _, w := range workflows {
+		if w.config == nil || w.src.On.WorkflowRun == nil {
+			continue
+		}
+		for _, name := range w.src.On.WorkflowRun.Workflows {
+			for _, upstream := range workflows {
+				if upstream.config != nil && upstream.Name == name {
+					upstream.ctx.report.Addf("workflow_run: add a step that invokes the custom webhook trigger of the %s pipeline when the pipeline completes", w.Identifier)
+				}
+			}
+		}
+	}
+}
+
+// summarize returns the markdown summary of the converted
+// workflow directory.
+func summarize(workflows []*directoryWorkflow, templates []*Template) []byte {
+	var b bytes.Buffer
+	b.WriteString("# GitHub workflow conversion\n")
+
+	b.WriteString("\n## Pipelines\n\n")
+	b.WriteString("| Workflow | Name | Pipeline | Notes |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, w := range workflows {
+		if w.config == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %d |\n", w.Path, w.Name, w.Identifier, len(w.ctx.report.Notes()))
+	}
+
+	var reusable, chains, actions, errs []string
+	actionUsers := map[string][]string{}
+	for _, w := range workflows {
+		switch {
+		case w.err != nil:
+			errs = append(errs, fmt.Sprintf("- `%s`: %s", w.Path, w.err))
+			continue
+		case w.config == nil:
+			callers := "is not called by the other workflows"
+			if len(w.callers) != 0 {
+				callers = "is inlined into " + strings.Join(w.callers, ", ")
+			}
+			reusable = append(reusable, fmt.Sprintf("- `%s` %s", w.Path, callers))
+			continue
+		}
+		if run := w.src.On.WorkflowRun; run != nil {
+			var upstream []string
+			for _, name := range run.Workflows {
+				if id, ok := w.ctx.workflows[name]; ok {
+					upstream = append(upstream, id)
+				} else {
+					upstream = append(upstream, name+" (not found)")
+				}
+			}
+			chains = append(chains, fmt.Sprintf("- `%s` runs when %s completes, add a step that invokes the `%s` custom webhook trigger to the end of the upstream pipelines by hand", w.Identifier, strings.Join(upstream, ", "), w.Identifier))
+		}
+	}
+
+	// the actions used by reusable workflows are used by
+	// the calling pipelines.
+	for _, w := range workflows {
+		if w.src == nil {
+			continue
+		}
+		users := []string{w.Identifier}
+		if w.config == nil {
+			users = w.callers
+		}
+		for _, action := range localActions(w.src) {
+			if _, ok := actionUsers[action]; !ok {
+				actions = append(actions, action)
+				actionUsers[action] = nil
+			}
+			for _, user := range users {
+				actionUsers[action] = appendUnique(actionUsers[action], user)
+			}
+		}
+	}
+	sort.Strings(actions)
+	for _, users := range actionUsers {
+		sort.Strings(users)
+	}
+
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", title)
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+	}
+	section("Reusable workflows", reusable)
+	section("Pipeline chains", chains)
+
+	var lines []string
+	for _, t := range templates {
+		lines = append(lines, fmt.Sprintf("- `%s` (stage %s) is used by %s", t.Identifier, t.Name, strings.Join(t.Pipelines, ", ")))
+	}
+	section("Stage templates", lines)
+
+	lines = nil
+	for _, action := range actions {
+		if len(actionUsers[action]) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("- `%s` is used by %s", action, strings.Join(actionUsers[action], ", ")))
+	}
+	section("Local actions", lines)
+	section("Errors", errs)
+	return b.Bytes()
+}
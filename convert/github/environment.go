@@ -0,0 +1,168 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	v0 "github.com/hunain-avyka/Go-drone/convert/harness/yaml"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// queue scopes of the concurrency groups.
+const (
+	queueScopePipeline = "pipeline"
+	queueScopeStage    = "stage"
+)
+
+// stageSteps defines the spec of a stage that only
+// contains steps, such as an approval stage.
+type stageSteps struct {
+	Steps []*harness.Step `json:"steps,omitempty"`
+}
+
+// stepApproval defines an approval step.
+type stepApproval struct {
+	Message   string     `json:"message,omitempty"`
+	Approvers *approvers `json:"approvers,omitempty"`
+}
+
+// approvers defines the approvers of an approval step.
+type approvers struct {
+	UserGroups   []string `json:"user_groups,omitempty"`
+	MinimumCount int      `json:"minimum_count,omitempty"`
+}
+
+// stepQueue defines a step that acquires a resource
+// constraint, so executions that use the same key run one
+// at a time.
+type stepQueue struct {
+	Key   string `json:"key,omitempty"`
+	Scope string `json:"scope,omitempty"`
+}
+
+// convertEnvironment returns an approval stage for the job
+// if the job environment requires reviewers, or nil. The
+// protection rules of the environment are not defined in
+// the workflow, so the reviewers are configured with the
+// environments option.
+func (d *Converter) convertEnvironment(name string, job *github.Job, ctx *context) *harness.Stage {
+	if job.Environment == nil || job.Environment.Name == "" {
+		return nil
+	}
+	env := job.Environment.Name
+	if strings.Contains(env, "${{") {
+		ctx.report.Addf("job %q: environment %q is evaluated at runtime, required reviewers are not converted", name, env)
+		return nil
+	}
+	rules := d.environments[env]
+	if rules == nil || len(rules.Approvers) == 0 {
+		return nil
+	}
+	minimum := rules.MinimumApprovals
+	if minimum == 0 {
+		minimum = 1
+	}
+	return &harness.Stage{
+		Name: "approve " + name,
+		Type: "approval",
+		When: convertJobIf(job, ctx),
+		Spec: &stageSteps{
+			Steps: []*harness.Step{
+				{
+					Name: "approve",
+					Type: "approval",
+					Spec: &stepApproval{
+						Message: "deploy " + name + " to " + env,
+						Approvers: &approvers{
+							UserGroups:   rules.Approvers,
+							MinimumCount: minimum,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// convertConcurrency converts the concurrency group to a
+// queue step with the scope. Harness queues the executions
+// instead of cancelling the executions in progress.
+func convertConcurrency(src *github.Concurrency, scope string, ctx *context) *harness.Step {
+	if src == nil || src.Group == "" {
+		return nil
+	}
+	return &harness.Step{
+		Name: "concurrency",
+		Type: "queue",
+		Spec: &stepQueue{
+			Key:   convertExprs(src.Group, false, ctx),
+			Scope: scope,
+		},
+	}
+}
+
+// convertJobConcurrency converts the job concurrency group
+// to a queue step that runs before the stage steps.
+func convertJobConcurrency(name string, job *github.Job, ctx *context) *harness.Step {
+	if job.Concurrency != nil && job.Concurrency.CancelInProgress {
+		ctx.report.Addf("job %q: cancel-in-progress is not supported, stages in the concurrency group are queued", name)
+	}
+	return convertConcurrency(job.Concurrency, queueScopeStage, ctx)
+}
+
+// convertWorkflowConcurrency converts the workflow
+// concurrency group to a stage that acquires the queue for
+// the remainder of the pipeline.
+func convertWorkflowConcurrency(ctx *context) *harness.Stage {
+	step := convertConcurrency(ctx.pipeline.Concurrency, queueScopePipeline, ctx)
+	if step == nil {
+		return nil
+	}
+	return &harness.Stage{
+		Name: "concurrency",
+		Type: "custom",
+		Spec: &stageSteps{
+			Steps: []*harness.Step{step},
+		},
+	}
+}
+
+// convertCancelInProgress sets the github webhook triggers
+// to abort the previous executions if the workflow cancels
+// the runs in progress. Harness aborts the executions of
+// the same branch or pull request, rather than the
+// executions in the concurrency group.
+func convertCancelInProgress(triggers []*v0.TriggerConfig, ctx *context) {
+	src := ctx.pipeline.Concurrency
+	if src == nil || !src.CancelInProgress {
+		return
+	}
+	aborted := false
+	for _, trigger := range triggers {
+		source, ok := trigger.Trigger.Source.Spec.(*v0.WebhookSource)
+		if !ok || source.Type != "Github" {
+			continue
+		}
+		if event, ok := source.Spec.(*v0.WebhookEvent); ok && event.Spec != nil {
+			event.Spec.AutoAbort = true
+			aborted = true
+		}
+	}
+	if aborted {
+		ctx.report.Addf("concurrency %q: cancel-in-progress is converted to abort the previous executions of the same branch or pull request", src.Group)
+	}
+}
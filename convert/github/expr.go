@@ -0,0 +1,354 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// this file implements a lexer and parser for the GitHub
+// Actions expression syntax.
+// https://docs.github.com/en/actions/learn-github-actions/expressions
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// operators and punctuation, longest first.
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"<", ">", "!", "(", ")", "[", "]", ",", ".", "*",
+}
+
+// lex splits the expression into tokens.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(s) {
+					return nil, errors.New("unterminated string")
+				}
+				if s[j] == '\'' {
+					// a quote is escaped with a second quote.
+					if j+1 < len(s) && s[j+1] == '\'' {
+						b.WriteByte('\'')
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+				j++
+			}
+			tokens = append(tokens, token{tokenString, b.String()})
+			i = j + 1
+		case isDigit(c) || (c == '-' && i+1 < len(s) && isDigit(s[i+1])):
+			j := i + 1
+			for j < len(s) && (isIdentChar(s[j]) || s[j] == '.' ||
+				((s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, s[i:j]})
+			i = j
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, v := range operators {
+				if strings.HasPrefix(s[i:], v) {
+					op = v
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, token{tokenOp, op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '-'
+}
+
+type (
+	// exprNode is a node in the expression syntax tree.
+	exprNode interface{}
+
+	// literalNode is a string, number, boolean or null
+	// literal.
+	literalNode struct {
+		kind  tokenKind
+		value string
+	}
+
+	// contextNode is a named context, such as github or
+	// matrix.
+	contextNode struct {
+		name string
+	}
+
+	// propertyNode is a property dereference, such as
+	// github.sha, or a wildcard filter, such as labels.*
+	propertyNode struct {
+		x    exprNode
+		name string
+	}
+
+	// indexNode is an index dereference, such as
+	// matrix['node-version'] or commits[0].
+	indexNode struct {
+		x     exprNode
+		index exprNode
+	}
+
+	// callNode is a function call.
+	callNode struct {
+		name string
+		args []exprNode
+	}
+
+	// unaryNode is a logical not.
+	unaryNode struct {
+		op string
+		x  exprNode
+	}
+
+	// binaryNode is a comparison or logical operation.
+	binaryNode struct {
+		op   string
+		x, y exprNode
+	}
+)
+
+// parser is a recursive descent expression parser.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseExpr parses the GitHub expression.
+func parseExpr(s string) (exprNode, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected token %q", t.text)
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the
+// operators.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return fmt.Errorf("expected %q", op)
+	}
+	return nil
+}
+
+func (p *parser) parseBinary(next func() (exprNode, error), ops ...string) (exprNode, error) {
+	x, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return x, nil
+		}
+		y, err := next()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) parseOr() (exprNode, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseEquality, "&&")
+}
+
+func (p *parser) parseEquality() (exprNode, error) {
+	return p.parseBinary(p.parseComparison, "==", "!=")
+}
+
+func (p *parser) parseComparison() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, "<", "<=", ">", ">=")
+}
+
+func (p *parser) parseUnary() (exprNode, error) {
+	if _, ok := p.accept("!"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "!", x: x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch op, _ := p.accept(".", "["); op {
+		case ".":
+			if _, ok := p.accept("*"); ok {
+				x = &propertyNode{x: x, name: "*"}
+				continue
+			}
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, fmt.Errorf("expected property name after %q", ".")
+			}
+			x = &propertyNode{x: x, name: t.text}
+		case "[":
+			var index exprNode
+			if _, ok := p.accept("*"); ok {
+				index = &literalNode{kind: tokenOp, value: "*"}
+			} else if index, err = p.parseOr(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexNode{x: x, index: index}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString, tokenNumber:
+		return &literalNode{kind: t.kind, value: t.text}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false", "null":
+			return &literalNode{kind: tokenIdent, value: t.text}, nil
+		}
+		if _, ok := p.accept("("); !ok {
+			return &contextNode{name: t.text}, nil
+		}
+		call := &callNode{name: t.text}
+		if _, ok := p.accept(")"); ok {
+			return call, nil
+		}
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if _, ok := p.accept(","); ok {
+				continue
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return call, nil
+		}
+	case tokenOp:
+		if t.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+		return nil, fmt.Errorf("unexpected token %q", t.text)
+	}
+	return nil, errors.New("unexpected end of expression")
+}
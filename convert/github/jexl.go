@@ -0,0 +1,865 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hunain-avyka/Go-drone/internal/slug"
+)
+
+// githubContext maps github context properties to harness
+// expressions.
+var githubContext = map[string]string{
+	"actor":                          "<+trigger.gitUser>",
+	"actor_email":                    "<+codebase.gitUserEmail>",
+	"base_ref":                       "<+trigger.targetBranch>",
+	"event_name":                     "<+trigger.event>",
+	"event.after":                    "<+codebase.commitSha>",
+	"event.before":                   "<+codebase.baseCommitSha>",
+	"event.head_commit.author.email": "<+codebase.gitUserEmail>",
+	"event.head_commit.id":           "<+codebase.commitSha>",
+	"event.head_commit.message":      "<+codebase.commitMessage>",
+	"event.number":                   "<+trigger.prNumber>",
+	"event.pull_request.base.ref":    "<+trigger.targetBranch>",
+	"event.pull_request.body":        "<+trigger.payload.pull_request.body>",
+	"event.pull_request.head.ref":    "<+trigger.sourceBranch>",
+	"event.pull_request.head.sha":    "<+codebase.commitSha>",
+	"event.pull_request.html_url":    "<+trigger.payload.pull_request.html_url>",
+	"event.pull_request.number":      "<+trigger.prNumber>",
+	"event.pull_request.title":       "<+trigger.prTitle>",
+	"event.ref":                      "<+trigger.payload.ref>",
+	"event.repository.html_url":      "<+trigger.repoUrl>",
+	"head_ref":                       "<+trigger.sourceBranch>",
+	"job":                            "<+stage.identifier>",
+	"ref":                            "<+trigger.payload.ref>",
+	"ref_name":                       "<+codebase.branch>",
+	"run_id":                         "<+pipeline.executionId>",
+	"run_number":                     "<+pipeline.sequenceId>",
+	"sha":                            "<+codebase.commitSha>",
+	"triggering_actor":               "<+trigger.gitUser>",
+	"workflow":                       "<+pipeline.name>",
+}
+
+// triggerEvents maps the GitHub event names to the harness
+// trigger events, which are compared with the event_name.
+var triggerEvents = map[string]string{
+	"push":                "PUSH",
+	"pull_request":        "PR",
+	"pull_request_target": "PR",
+}
+
+// strategyContext maps strategy context properties to
+// harness expressions.
+var strategyContext = map[string]string{
+	"job-index": "<+strategy.iteration>",
+	"job-total": "<+strategy.iterations>",
+}
+
+// operator precedence of the converted jexl expressions.
+const (
+	precOr = iota + 1
+	precAnd
+	precEquality
+	precComparison
+	precAdditive
+	precUnary
+	precPrimary
+)
+
+var binaryPrec = map[string]int{
+	"||": precOr,
+	"&&": precAnd,
+	"==": precEquality,
+	"!=": precEquality,
+	"<":  precComparison,
+	"<=": precComparison,
+	">":  precComparison,
+	">=": precComparison,
+}
+
+// exprConverter converts a GitHub expression syntax tree
+// to a jexl expression.
+type exprConverter struct {
+	ctx *context
+
+	// err is the first part of the expression that could
+	// not be converted.
+	err string
+}
+
+// convertCondition converts a GitHub condition, with or
+// without the ${{ }} syntax, to a jexl expression. If the
+// condition cannot be converted it is returned unchanged
+// and added to the report.
+func convertCondition(s string, ctx *context) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	expr := s
+	if strings.HasPrefix(expr, "${{") && strings.HasSuffix(expr, "}}") &&
+		strings.Count(expr, "${{") == 1 {
+		expr = strings.TrimSpace(expr[3 : len(expr)-2])
+	}
+	node, err := parseExpr(expr)
+	if err != nil {
+		ctx.report.Addf("expression %q cannot be parsed: %s", expr, err)
+		return s
+	}
+	c := &exprConverter{ctx: ctx}
+	out, _ := c.convert(node)
+	if c.err != "" {
+		ctx.report.Addf("expression %q cannot be converted to a harness expression: %s is not supported", expr, c.err)
+		return s
+	}
+	return out
+}
+
+// convertExprs converts the ${{ }} expressions embedded in
+// the string to harness expressions. Expressions that
+// cannot be converted are left unchanged and added to the
+// report.
+func convertExprs(s string, shell bool, ctx *context) string {
+	if !strings.Contains(s, "${{") {
+		return s
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${{")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(s[start:], "}}")
+		if end == -1 {
+			break
+		}
+		end += start + 2
+		b.WriteString(s[:start])
+		b.WriteString(convertInterpolation(s[start:end], shell, ctx))
+		s = s[end:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// convertInterpolation converts a single ${{ }} expression
+// to a harness expression.
+func convertInterpolation(s string, shell bool, ctx *context) string {
+	expr := strings.TrimSpace(s[3 : len(s)-2])
+	node, err := parseExpr(expr)
+	if err != nil {
+		ctx.report.Addf("expression %q cannot be parsed: %s", expr, err)
+		return s
+	}
+
+	out, unsupported := interpolate(node, shell, ctx)
+	if unsupported != "" {
+		ctx.report.Addf("expression %q cannot be converted to a harness expression: %s is not supported", expr, unsupported)
+		return s
+	}
+	return out
+}
+
+// interpolate converts the expression to text with embedded
+// harness expressions. It returns the unsupported part of
+// the expression if the expression cannot be converted.
+func interpolate(node exprNode, shell bool, ctx *context) (string, string) {
+	path, isRef := refPath(node)
+
+	// reusable workflow inputs are interpolated in the scope
+	// of the calling job.
+	if isRef && len(path) == 2 && path[0] == "inputs" && ctx.scope != nil {
+		if b, ok := ctx.scope.inputs[path[1]]; ok {
+			saved := ctx.scope
+			ctx.scope = b.scope
+			defer func() { ctx.scope = saved }()
+			return interpolate(b.node, shell, ctx)
+		}
+	}
+
+	// environment variables are referenced directly in
+	// shell scripts.
+	if isRef && shell && len(path) == 2 && path[0] == "env" {
+		return "${" + path[1] + "}", ""
+	}
+
+	switch n := node.(type) {
+	case *literalNode:
+		// literals are interpolated as plain text.
+		if n.kind == tokenIdent && n.value == "null" {
+			return "", ""
+		}
+		return n.value, ""
+	case *callNode:
+		// hashFiles calls are interpolated as a command
+		// that calculates the checksum in scripts.
+		if strings.EqualFold(n.name, "hashFiles") && shell && !isWindows(ctx) {
+			if out, ok := shellHashFiles(n); ok {
+				return out, ""
+			}
+		}
+		// format calls are interpolated as text, if the
+		// format string is a literal.
+		if strings.EqualFold(n.name, "format") {
+			if segments, err := splitFormat(n); err == "" {
+				var b strings.Builder
+				for _, seg := range segments {
+					if seg.arg == nil {
+						b.WriteString(seg.text)
+						continue
+					}
+					out, unsupported := interpolate(seg.arg, shell, ctx)
+					if unsupported != "" {
+						return "", unsupported
+					}
+					b.WriteString(out)
+				}
+				return b.String(), ""
+			}
+		}
+	}
+
+	c := &exprConverter{ctx: ctx}
+	out, prec := c.convert(node)
+	if c.err != "" {
+		return "", c.err
+	}
+	// context references are already harness expressions.
+	if prec == precPrimary && strings.HasPrefix(out, "<+") && strings.HasSuffix(out, ">") &&
+		strings.Count(out, "<+") == 1 {
+		return out, ""
+	}
+	return "<+" + out + ">", ""
+}
+
+// fail records the first unsupported part of the
+// expression.
+func (c *exprConverter) fail(format string, args ...interface{}) (string, int) {
+	if c.err == "" {
+		c.err = fmt.Sprintf(format, args...)
+	}
+	return "", precPrimary
+}
+
+// convert returns the jexl expression and its precedence.
+func (c *exprConverter) convert(node exprNode) (string, int) {
+	switch n := node.(type) {
+	case *literalNode:
+		return convertLiteral(n), precPrimary
+	case *contextNode, *propertyNode, *indexNode:
+		return c.convertRef(n)
+	case *unaryNode:
+		x := c.operand(n.x, precUnary)
+		return n.op + x, precUnary
+	case *binaryNode:
+		if out, ok := c.convertEventCompare(n); ok {
+			return out, precEquality
+		}
+		prec := binaryPrec[n.op]
+		x := c.operand(n.x, prec)
+		// operators are left associative, the right
+		// operand is wrapped if it has equal precedence.
+		y := c.operand(n.y, prec+1)
+		return x + " " + n.op + " " + y, prec
+	case *callNode:
+		return c.convertCall(n)
+	}
+	return c.fail("expression")
+}
+
+// convertEventCompare converts a comparison of the event
+// name with a literal event to a comparison with the
+// harness trigger event. Events that harness does not have
+// are added to the report, and the comparison is converted
+// unchanged.
+func (c *exprConverter) convertEventCompare(n *binaryNode) (string, bool) {
+	if n.op != "==" && n.op != "!=" {
+		return "", false
+	}
+	x, y := n.x, n.y
+	lit, ok := y.(*literalNode)
+	if !ok {
+		x, y = y, x
+		lit, ok = y.(*literalNode)
+	}
+	if !ok || lit.kind != tokenString {
+		return "", false
+	}
+	if path, ok := refPath(x); !ok || joinPath(path) != "github.event_name" {
+		return "", false
+	}
+	event, ok := triggerEvents[strings.ToLower(lit.value)]
+	if !ok {
+		c.ctx.report.Addf("event %q is not a harness trigger event, the condition github.event_name %s '%s' is not converted", lit.value, n.op, lit.value)
+		return "", false
+	}
+	ref, _ := c.convert(x)
+	if n.x == x {
+		return ref + " " + n.op + " " + quote(event), true
+	}
+	return quote(event) + " " + n.op + " " + ref, true
+}
+
+// operand converts the node and wraps it in parentheses if
+// it binds less tightly than prec.
+func (c *exprConverter) operand(node exprNode, prec int) string {
+	out, p := c.convert(node)
+	if p < prec {
+		return "(" + out + ")"
+	}
+	return out
+}
+
+func convertLiteral(n *literalNode) string {
+	switch n.kind {
+	case tokenString:
+		return quote(n.value)
+	case tokenNumber:
+		// hexadecimal and exponent notation are converted
+		// to a decimal number.
+		if f, err := strconv.ParseFloat(n.value, 64); err == nil &&
+			strings.ContainsAny(n.value, "xXeE") {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		if i, err := strconv.ParseInt(n.value, 0, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+	}
+	return n.value
+}
+
+// quote returns the string as a single-quoted jexl string.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+// refPath returns the property path of a context reference.
+// Index dereferences with literal values are included in
+// the path, array indexes formatted as [n].
+func refPath(node exprNode) ([]string, bool) {
+	switch n := node.(type) {
+	case *contextNode:
+		return []string{n.name}, true
+	case *propertyNode:
+		path, ok := refPath(n.x)
+		return append(path, n.name), ok
+	case *indexNode:
+		path, ok := refPath(n.x)
+		lit, isLit := n.index.(*literalNode)
+		if !ok || !isLit {
+			return nil, false
+		}
+		switch lit.kind {
+		case tokenNumber:
+			return append(path, "["+lit.value+"]"), true
+		case tokenOp:
+			return append(path, "*"), true
+		}
+		return append(path, lit.value), true
+	}
+	return nil, false
+}
+
+// joinPath joins the property path using dot notation.
+func joinPath(path []string) string {
+	var b strings.Builder
+	for i, name := range path {
+		if i > 0 && !strings.HasPrefix(name, "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(name)
+	}
+	return b.String()
+}
+
+// convertRef converts a context reference to a harness
+// expression.
+func (c *exprConverter) convertRef(node exprNode) (string, int) {
+	path, ok := refPath(node)
+	if !ok {
+		return c.fail("dynamic property access")
+	}
+	ref := joinPath(path)
+	for _, name := range path {
+		if name == "*" {
+			return c.fail("object filter %s", ref)
+		}
+	}
+	if len(path) == 1 {
+		return c.fail("context %s", ref)
+	}
+
+	name := path[0]
+	rest := path[1:]
+	switch name {
+	case "github":
+		if joinPath(rest) == "token" {
+			return c.ctx.secrets.expr(githubToken, c.ctx.report), precPrimary
+		}
+		if v, ok := githubContext[joinPath(rest)]; ok {
+			return v, precPrimary
+		}
+		if rest[0] == "event" {
+			if len(rest) > 2 && rest[1] == "inputs" {
+				return "<+inputs." + joinPath(rest[2:]) + ">", precPrimary
+			}
+			return "<+trigger.payload" + strings.TrimPrefix(joinPath(rest), "event") + ">", precPrimary
+		}
+	case "matrix":
+		return "<+matrix." + joinPath(rest) + ">", precPrimary
+	case "strategy":
+		if v, ok := strategyContext[joinPath(rest)]; ok {
+			return v, precPrimary
+		}
+	case "inputs":
+		if len(rest) == 1 && c.ctx.scope != nil {
+			if b, ok := c.ctx.scope.inputs[rest[0]]; ok {
+				return c.convertBinding(b)
+			}
+		}
+		return "<+inputs." + joinPath(rest) + ">", precPrimary
+	case "secrets":
+		if len(rest) == 1 {
+			return c.convertSecret(rest[0])
+		}
+	case "vars":
+		if len(rest) == 1 {
+			return c.ctx.variable(rest[0]), precPrimary
+		}
+	case "steps":
+		if len(rest) == 3 && rest[1] == "outputs" {
+			return stepOutputExpr(c.ctx.outputStage, rest[0], rest[2]), precPrimary
+		}
+	case "needs":
+		if len(rest) == 2 && rest[1] == "result" {
+			return "<+pipeline.stages." + slug.Create(rest[0]) + ".status>", precPrimary
+		}
+		if len(rest) == 3 && rest[1] == "outputs" {
+			return c.convertJobOutput(rest[0], rest[2])
+		}
+	}
+	return c.fail("context %s", ref)
+}
+
+// convertBinding converts the expression bound to a
+// reusable workflow input or secret in the scope of the
+// calling job.
+func (c *exprConverter) convertBinding(b *binding) (string, int) {
+	saved := c.ctx.scope
+	c.ctx.scope = b.scope
+	defer func() { c.ctx.scope = saved }()
+	return c.convert(b.node)
+}
+
+// convertJobOutput converts a job output reference. The job
+// output expression is evaluated in the scope of the job,
+// where the step outputs reference the steps of the job
+// stage.
+func (c *exprConverter) convertJobOutput(name, output string) (string, int) {
+	job, ok := c.ctx.jobs[name]
+	if !ok || job.Outputs[output] == "" {
+		return c.fail("job output needs.%s.outputs.%s", name, output)
+	}
+	node := parseBinding(job.Outputs[output], c.ctx)
+	savedScope, savedStage := c.ctx.scope, c.ctx.outputStage
+	c.ctx.scope, c.ctx.outputStage = c.ctx.scopes[name], name
+	defer func() { c.ctx.scope, c.ctx.outputStage = savedScope, savedStage }()
+	return c.convert(node)
+}
+
+// convertSecret converts a secret reference. Secrets in a
+// reusable workflow resolve to the secrets passed by the
+// calling job, or to the secrets of the calling job if the
+// secrets are inherited.
+func (c *exprConverter) convertSecret(name string) (string, int) {
+	for scope := c.ctx.scope; scope != nil; scope = scope.parent {
+		if b, ok := scope.secrets[name]; ok {
+			return c.convertBinding(b)
+		}
+		if !scope.inherit && name != githubToken {
+			c.ctx.report.Addf("job %q: secret %s is not passed to the reusable workflow", scope.name, name)
+			break
+		}
+	}
+	return c.ctx.secrets.expr(name, c.ctx.report), precPrimary
+}
+
+// convertCall converts a function call to a jexl
+// expression.
+func (c *exprConverter) convertCall(n *callNode) (string, int) {
+	name := strings.ToLower(n.name)
+	switch name {
+	case "contains", "startswith", "endswith":
+		if len(n.args) != 2 {
+			return c.fail("%s with %d arguments", n.name, len(n.args))
+		}
+		if name == "contains" {
+			if out, ok := c.convertContains(n); ok {
+				return out, precEquality
+			}
+		}
+		method := map[string]string{
+			"contains":   "contains",
+			"startswith": "startsWith",
+			"endswith":   "endsWith",
+		}[name]
+		// the github functions ignore case, so both values
+		// are converted to lower case.
+		x := c.lowerOperand(n.args[0])
+		y := c.lowerOperand(n.args[1])
+		return x + "." + method + "(" + y + ")", precPrimary
+	case "format":
+		return c.convertFormat(n)
+	case "fromjson":
+		if len(n.args) != 1 {
+			return c.fail("%s with %d arguments", n.name, len(n.args))
+		}
+		// fromJSON of a literal value is converted to the
+		// jexl literal of the value.
+		if v, ok := jsonLiteral(n); ok {
+			return convertValue(v), precPrimary
+		}
+		if _, ok := n.args[0].(*literalNode); ok {
+			return c.fail("%s of invalid json", n.name)
+		}
+		x, _ := c.convert(n.args[0])
+		return "<+json.object(" + x + ")>", precPrimary
+	case "tojson":
+		if len(n.args) != 1 {
+			return c.fail("%s with %d arguments", n.name, len(n.args))
+		}
+		if v, ok := jsonLiteral(n.args[0]); ok {
+			b, _ := json.Marshal(v)
+			return quote(string(b)), precPrimary
+		}
+		if lit, ok := n.args[0].(*literalNode); ok {
+			if lit.kind == tokenString {
+				b, _ := json.Marshal(lit.value)
+				return quote(string(b)), precPrimary
+			}
+			return quote(convertLiteral(lit)), precPrimary
+		}
+		x, _ := c.convert(n.args[0])
+		return "<+json.format(" + x + ")>", precPrimary
+	case "join":
+		return c.convertJoin(n)
+	case "hashfiles":
+		// the files are not available when the condition
+		// is evaluated. hashFiles is converted in cache
+		// keys and scripts.
+		return c.fail("function %s outside of a cache key or script", n.name)
+	case "always", "success":
+		// stages and steps only execute when the previous
+		// stages and steps succeed, unless the status
+		// condition is changed, so these are always true
+		// when the expression is evaluated.
+		if len(n.args) == 0 {
+			return "true", precPrimary
+		}
+	}
+	return c.fail("function %s", n.name)
+}
+
+// lowerOperand converts the operand to a lower case string.
+// String literals are converted to lower case when the
+// expression is converted.
+func (c *exprConverter) lowerOperand(node exprNode) string {
+	if lit, ok := node.(*literalNode); ok && lit.kind == tokenString {
+		return quote(strings.ToLower(lit.value))
+	}
+	return c.operand(node, precPrimary) + ".toLowerCase()"
+}
+
+// convertContains converts contains calls that test the
+// membership of an array. The array is a fromJSON literal,
+// which is converted to the jexl in operator, or an object
+// filter, which is converted to a match of the string value
+// of the objects, since jexl does not support projections.
+func (c *exprConverter) convertContains(n *callNode) (string, bool) {
+	if v, ok := jsonLiteral(n.args[0]); ok {
+		if _, ok := v.([]interface{}); ok {
+			x := c.operand(n.args[1], precEquality+1)
+			return x + " =~ " + convertValue(v), true
+		}
+		return "", false
+	}
+	list, prop, ok := objectFilter(n.args[0])
+	if !ok {
+		return "", false
+	}
+	item, ok := n.args[1].(*literalNode)
+	if !ok {
+		c.fail("contains of an object filter and a dynamic value")
+		return "", true
+	}
+	x := c.operand(list, precPrimary)
+	if c.err != "" {
+		return "", true
+	}
+	// the objects are formatted as a map, with name=value
+	// properties, or as json, with "name":"value"
+	// properties.
+	pattern := `(?is).*[{ ,]"?` + regexp.QuoteMeta(prop) + `"?[=:] ?"?` + regexp.QuoteMeta(item.value) + `"?[,}].*`
+	return x + ".toString() =~ " + quote(pattern), true
+}
+
+// convertJoin converts the join function. Literal arrays
+// are joined when the expression is converted, and other
+// arrays are joined using the string value of the list,
+// which is lossy and reported.
+func (c *exprConverter) convertJoin(n *callNode) (string, int) {
+	if len(n.args) != 1 && len(n.args) != 2 {
+		return c.fail("%s with %d arguments", n.name, len(n.args))
+	}
+	sep := ","
+	if len(n.args) == 2 {
+		lit, ok := n.args[1].(*literalNode)
+		if !ok {
+			return c.fail("%s with a dynamic separator", n.name)
+		}
+		sep = lit.value
+	}
+	if v, ok := jsonLiteral(n.args[0]); ok {
+		items, ok := v.([]interface{})
+		if !ok {
+			items = []interface{}{v}
+		}
+		var parts []string
+		for _, item := range items {
+			parts = append(parts, formatValue(item))
+		}
+		return quote(strings.Join(parts, sep)), precPrimary
+	}
+	// join of a string is the string itself.
+	if lit, ok := n.args[0].(*literalNode); ok {
+		return convertLiteral(lit), precPrimary
+	}
+	if _, _, ok := objectFilter(n.args[0]); ok {
+		return c.fail("%s of an object filter", n.name)
+	}
+	x := c.operand(n.args[0], precPrimary)
+	// jexl cannot join a list, so the items are separated
+	// in the string value of the list, which is formatted
+	// as [a, b]. Items that contain the ", " separator are
+	// split, and strings that start or end with brackets
+	// are changed.
+	c.ctx.report.Addf("expression %s: join uses the string value of the list, items that contain %q are split", x, ", ")
+	return x + ".toString().replaceAll(" + quote(`^\[|\]$`) + ", '').replace(', ', " + quote(sep) + ")", precPrimary
+}
+
+// jsonLiteral returns the value of a fromJSON call with a
+// literal json string.
+func jsonLiteral(node exprNode) (interface{}, bool) {
+	call, ok := node.(*callNode)
+	if !ok || !strings.EqualFold(call.name, "fromJSON") || len(call.args) != 1 {
+		return nil, false
+	}
+	lit, ok := call.args[0].(*literalNode)
+	if !ok || lit.kind != tokenString {
+		return nil, false
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(lit.value), &v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// convertValue converts a json value to a jexl literal.
+// Objects are converted to jexl maps with sorted keys.
+func convertValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return quote(v)
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, convertValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var items []string
+		for _, k := range keys {
+			items = append(items, quote(k)+": "+convertValue(v[k]))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	return formatValue(v)
+}
+
+// formatValue formats a json value as a string, the way
+// GitHub converts values to strings.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// objectFilter returns the list and the property of an
+// object filter, such as labels.*.name.
+func objectFilter(node exprNode) (exprNode, string, bool) {
+	prop, ok := node.(*propertyNode)
+	if !ok || prop.name == "*" {
+		return nil, "", false
+	}
+	switch x := prop.x.(type) {
+	case *propertyNode:
+		if x.name == "*" {
+			return x.x, prop.name, true
+		}
+	case *indexNode:
+		if lit, ok := x.index.(*literalNode); ok && lit.kind == tokenOp {
+			return x.x, prop.name, true
+		}
+	}
+	return nil, "", false
+}
+
+// shellHashFiles converts the hashFiles function to a shell
+// command that calculates the checksum of the files, or
+// returns false if the patterns are not literals.
+func shellHashFiles(n *callNode) (string, bool) {
+	var exprs []string
+	for _, arg := range n.args {
+		lit, ok := arg.(*literalNode)
+		if !ok || lit.kind != tokenString || strings.HasPrefix(lit.value, "!") {
+			return "", false
+		}
+		pattern := strings.TrimPrefix(lit.value, "./")
+		if name := strings.TrimPrefix(pattern, "**/"); name != pattern && !strings.Contains(name, "/") {
+			exprs = append(exprs, "-name '"+name+"'")
+			continue
+		}
+		// the find wildcard matches directories, so the
+		// globstar is not required.
+		pattern = strings.ReplaceAll(pattern, "**/", "")
+		pattern = strings.ReplaceAll(pattern, "**", "*")
+		exprs = append(exprs, "-path './"+pattern+"'")
+	}
+	if len(exprs) == 0 {
+		return "", false
+	}
+	match := exprs[0]
+	if len(exprs) > 1 {
+		match = `\( ` + strings.Join(exprs, " -o ") + ` \)`
+	}
+	return "$(find . -type f " + match + " -exec sha256sum {} + | sort -k 2 | sha256sum | cut -d ' ' -f 1)", true
+}
+
+// convertFormat converts the format function to a string
+// concatenation.
+func (c *exprConverter) convertFormat(n *callNode) (string, int) {
+	segments, err := splitFormat(n)
+	if err != "" {
+		return c.fail("%s", err)
+	}
+	var parts []string
+	for _, seg := range segments {
+		if seg.arg == nil {
+			parts = append(parts, quote(seg.text))
+		} else {
+			parts = append(parts, c.operand(seg.arg, precPrimary))
+		}
+	}
+	if len(parts) == 0 {
+		return quote(""), precPrimary
+	}
+	if len(parts) == 1 {
+		return parts[0], precPrimary
+	}
+	return strings.Join(parts, " + "), precAdditive
+}
+
+// formatSegment is a segment of a format string, either
+// text or an argument.
+type formatSegment struct {
+	text string
+	arg  exprNode
+}
+
+// splitFormat splits the format call into text and argument
+// segments. It returns the unsupported part of the call if
+// the format string is not a literal or is invalid.
+func splitFormat(n *callNode) ([]formatSegment, string) {
+	if len(n.args) == 0 {
+		return nil, "format without arguments"
+	}
+	lit, ok := n.args[0].(*literalNode)
+	if !ok || lit.kind != tokenString {
+		return nil, "format with a dynamic format string"
+	}
+
+	var segments []formatSegment
+	var text strings.Builder
+	s := lit.value
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"):
+			text.WriteByte('{')
+			i++
+		case strings.HasPrefix(s[i:], "}}"):
+			text.WriteByte('}')
+			i++
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end == -1 {
+				return nil, fmt.Sprintf("format string %q", s)
+			}
+			index, err := strconv.Atoi(s[i+1 : i+end])
+			if err != nil || index < 0 || index+1 >= len(n.args) {
+				return nil, fmt.Sprintf("format string %q", s)
+			}
+			if text.Len() != 0 {
+				segments = append(segments, formatSegment{text: text.String()})
+				text.Reset()
+			}
+			segments = append(segments, formatSegment{arg: n.args[index+1]})
+			i += end
+		default:
+			text.WriteByte(s[i])
+		}
+	}
+	if text.Len() != 0 {
+		segments = append(segments, formatSegment{text: text.String()})
+	}
+	return segments, ""
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
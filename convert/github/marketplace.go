@@ -0,0 +1,642 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/slug"
+	"github.com/hunain-avyka/Go-drone/internal/store"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// stageState stores the stage settings collected while the
+// job steps are converted.
+type stageState struct {
+	platform *harness.Platform
+
+	// image is the image of the run steps, set by the
+	// setup actions.
+	image string
+
+	// cache is the stage cache, set by the cache action.
+	cache *harness.Cache
+
+	// login stores the registry and connector of the
+	// docker login action.
+	login *dockerLogin
+
+	// envs and paths store the environment variables and
+	// paths that the steps write to GITHUB_ENV and
+	// GITHUB_PATH.
+	envs  []*stepEnv
+	paths []string
+
+	// defaults stores the run defaults of the job,
+	// merged with the workflow defaults.
+	defaults *github.Defaults
+
+	// ids stores the generated step identifiers.
+	ids *store.Identifiers
+}
+
+// dockerLogin defines the registry and connector of the
+// docker login action.
+type dockerLogin struct {
+	registry  string
+	connector string
+}
+
+// stepTemplate defines a native harness step, configured
+// using inputs.
+type stepTemplate struct {
+	Uses string                 `json:"uses,omitempty"`
+	With map[string]interface{} `json:"with,omitempty"`
+}
+
+// marketplaceAction defines the conversion of a well-known
+// marketplace action.
+type marketplaceAction struct {
+	// versions lists the supported major versions.
+	versions []string
+
+	// inputs lists the supported inputs. Other inputs are
+	// ignored and reported.
+	inputs []string
+
+	// convert converts the action step. It returns false
+	// if the step is replaced by stage settings and is
+	// removed from the stage.
+	convert func(dst *harness.Step, src *github.Step, ctx *context) bool
+}
+
+// marketplaceActions maps well-known marketplace actions to
+// harness steps and stage settings.
+var marketplaceActions = map[string]*marketplaceAction{
+	"actions/setup-go": {
+		versions: []string{"v3", "v4", "v5"},
+		inputs:   []string{"go-version", "go-version-file", "cache", "cache-dependency-path"},
+		convert:  convertSetupGo,
+	},
+	"actions/setup-node": {
+		versions: []string{"v3", "v4"},
+		inputs:   []string{"node-version", "node-version-file", "cache", "cache-dependency-path"},
+		convert:  convertSetupNode,
+	},
+	"actions/setup-python": {
+		versions: []string{"v4", "v5"},
+		inputs:   []string{"python-version", "python-version-file", "cache", "cache-dependency-path"},
+		convert:  convertSetupPython,
+	},
+	"actions/setup-java": {
+		versions: []string{"v3", "v4"},
+		inputs:   []string{"distribution", "java-version", "cache", "cache-dependency-path"},
+		convert:  convertSetupJava,
+	},
+	"actions/cache": {
+		versions: []string{"v3", "v4"},
+		inputs:   []string{"path", "key", "restore-keys"},
+		convert:  convertCacheAction,
+	},
+	"actions/upload-artifact": {
+		versions: []string{"v3", "v4"},
+		inputs:   []string{"name", "path"},
+		convert:  convertUploadArtifact,
+	},
+	"actions/download-artifact": {
+		versions: []string{"v3", "v4"},
+		inputs:   []string{"name", "path"},
+		convert:  convertDownloadArtifact,
+	},
+	"docker/login-action": {
+		versions: []string{"v2", "v3"},
+		inputs:   []string{"registry", "username", "password"},
+		convert:  convertDockerLogin,
+	},
+	"docker/build-push-action": {
+		versions: []string{"v4", "v5", "v6"},
+		inputs:   []string{"context", "file", "target", "tags", "build-args", "push", "platforms"},
+		convert:  convertDockerBuildPush,
+	},
+	"docker/setup-buildx-action": {
+		versions: []string{"v2", "v3"},
+		convert:  removeBuildxStep,
+	},
+	"docker/setup-qemu-action": {
+		versions: []string{"v2", "v3"},
+		convert:  removeBuildxStep,
+	},
+	"codecov/codecov-action": {
+		versions: []string{"v3", "v4"},
+		inputs:   []string{"token", "name", "files", "flags"},
+		convert:  convertCodecov,
+	},
+	"softprops/action-gh-release": {
+		versions: []string{"v1", "v2"},
+		inputs:   []string{"name", "body", "draft", "prerelease", "token", "files"},
+		convert:  convertGithubRelease,
+	},
+}
+
+// javaImages maps the setup-java distributions to images.
+var javaImages = map[string]string{
+	"adopt":         "eclipse-temurin",
+	"adopt-hotspot": "eclipse-temurin",
+	"corretto":      "amazoncorretto",
+	"liberica":      "bellsoft/liberica-openjdk-debian",
+	"temurin":       "eclipse-temurin",
+	"zulu":          "azul/zulu-openjdk",
+}
+
+// convertUses converts a step that uses an action. Well-known
+// marketplace actions are converted to harness steps and
+// stage settings, other actions remain action steps. It
+// returns false if the step is removed from the stage.
+func convertUses(dst *harness.Step, src *github.Step, ctx *context) bool {
+	name, ref := splitUses(src.Uses)
+	action, ok := marketplaceActions[name]
+	if ok && !supportsVersion(action, ref) {
+		ctx.report.Addf("step %q: %s version %s is not supported, the step is converted to an action step", stepName(src), name, ref)
+		ok = false
+	}
+	if !ok {
+		return convertActionStep(dst, src, ctx)
+	}
+	for key := range src.With {
+		if !contains(action.inputs, key) {
+			ctx.report.Addf("step %q: %s input %q is not supported", stepName(src), name, key)
+		}
+	}
+	return action.convert(dst, src, ctx)
+}
+
+// convertActionStep converts the step to an action step.
+func convertActionStep(dst *harness.Step, src *github.Step, ctx *context) bool {
+	dst.Spec = convertAction(src, ctx)
+	dst.Type = "action"
+	return true
+}
+
+// splitUses splits the action reference into the action
+// name and ref.
+func splitUses(uses string) (string, string) {
+	if i := strings.LastIndex(uses, "@"); i != -1 {
+		return uses[:i], uses[i+1:]
+	}
+	return uses, ""
+}
+
+// supportsVersion returns true if the action ref is one of
+// the supported major versions. Refs that are not versions,
+// such as commit shas and branches, are assumed supported.
+func supportsVersion(action *marketplaceAction, ref string) bool {
+	if len(ref) < 2 || ref[0] != 'v' || !isDigit(ref[1]) {
+		return true
+	}
+	major := ref
+	if i := strings.IndexByte(ref, '.'); i != -1 {
+		major = ref[:i]
+	}
+	return contains(action.versions, major)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// withString returns the step input as a string with the
+// expressions converted.
+func withString(src *github.Step, key string, ctx *context) string {
+	v, ok := src.With[key]
+	if !ok || v == nil {
+		return ""
+	}
+	return convertExprs(strings.TrimSpace(fmt.Sprint(v)), false, ctx)
+}
+
+// withList returns the step input as a list. List inputs are
+// separated by newlines or commas.
+func withList(src *github.Step, key string, ctx *context) []interface{} {
+	var dst []interface{}
+	for _, line := range strings.Split(withString(src, key, ctx), "\n") {
+		for _, item := range strings.Split(line, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				dst = append(dst, item)
+			}
+		}
+	}
+	return dst
+}
+
+// withLines returns the step input as a list of lines. It
+// is used for list inputs whose items may contain commas.
+func withLines(src *github.Step, key string, ctx *context) []interface{} {
+	var dst []interface{}
+	for _, line := range strings.Split(withString(src, key, ctx), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			dst = append(dst, line)
+		}
+	}
+	return dst
+}
+
+// copyWith copies the step inputs to the plugin settings.
+func copyWith(dst map[string]interface{}, src *github.Step, ctx *context, keys map[string]string) {
+	for from, to := range keys {
+		if v := withString(src, from, ctx); v != "" {
+			dst[to] = v
+		}
+	}
+}
+
+// convertPlugin converts the step to a plugin step.
+func convertPlugin(dst *harness.Step, src *github.Step, image string, with map[string]interface{}, ctx *context) bool {
+	dst.Type = "plugin"
+	dst.Spec = &harness.StepPlugin{
+		Image: image,
+		Envs:  convertEnv(src.Env, ctx),
+		With:  with,
+	}
+	return true
+}
+
+// removeBuildxStep removes the buildx and qemu setup
+// actions, which are not required by the build and push
+// steps.
+func removeBuildxStep(dst *harness.Step, src *github.Step, ctx *context) bool {
+	ctx.report.Addf("step %q: %s is removed, the build and push steps do not require it", stepName(src), src.Uses)
+	return false
+}
+
+// setImage sets the image of the run steps that follow the
+// setup action. It returns false if the image is set, and
+// the step is removed from the stage. Images are only
+// supported on linux, so on other platforms the setup
+// action installs the tool.
+func setImage(dst *harness.Step, src *github.Step, image string, ctx *context) bool {
+	if ctx.stage.platform != nil && ctx.stage.platform.Os != harness.OSLinux.String() {
+		return convertActionStep(dst, src, ctx)
+	}
+	if ctx.stage.image != "" && ctx.stage.image != image {
+		ctx.report.Addf("step %q: the run steps already use image %q, the step is converted to an action step", stepName(src), ctx.stage.image)
+		return convertActionStep(dst, src, ctx)
+	}
+	ctx.stage.image = image
+	// the setup actions cache the package manager
+	// dependencies, which is provided by cache
+	// intelligence.
+	if withString(src, "cache", ctx) != "" && withString(src, "cache", ctx) != "false" && ctx.stage.cache == nil {
+		ctx.stage.cache = &harness.Cache{Enabled: true}
+	}
+	return false
+}
+
+// toolVersion returns the image tag for the tool version.
+// Version ranges are converted to the matching major or
+// minor version tag.
+func toolVersion(v string) string {
+	v = strings.TrimSpace(v)
+	v = strings.TrimLeft(v, "^~>=v")
+	v = strings.TrimSuffix(v, ".x")
+	v = strings.TrimSuffix(v, ".x")
+	switch v {
+	case "", "stable", "latest", "*":
+		return "latest"
+	}
+	return v
+}
+
+func convertSetupGo(dst *harness.Step, src *github.Step, ctx *context) bool {
+	if withString(src, "go-version-file", ctx) != "" {
+		ctx.report.Addf("step %q: go-version-file is not supported, the step is converted to an action step", stepName(src))
+		return convertActionStep(dst, src, ctx)
+	}
+	return setImage(dst, src, "golang:"+toolVersion(withString(src, "go-version", ctx)), ctx)
+}
+
+func convertSetupNode(dst *harness.Step, src *github.Step, ctx *context) bool {
+	if withString(src, "node-version-file", ctx) != "" {
+		ctx.report.Addf("step %q: node-version-file is not supported, the step is converted to an action step", stepName(src))
+		return convertActionStep(dst, src, ctx)
+	}
+	version := withString(src, "node-version", ctx)
+	if strings.HasPrefix(version, "lts/") {
+		version = "lts"
+	}
+	return setImage(dst, src, "node:"+toolVersion(version), ctx)
+}
+
+func convertSetupPython(dst *harness.Step, src *github.Step, ctx *context) bool {
+	if withString(src, "python-version-file", ctx) != "" {
+		ctx.report.Addf("step %q: python-version-file is not supported, the step is converted to an action step", stepName(src))
+		return convertActionStep(dst, src, ctx)
+	}
+	version := withString(src, "python-version", ctx)
+	if strings.HasPrefix(version, "pypy") {
+		return setImage(dst, src, "pypy:"+toolVersion(strings.TrimPrefix(version, "pypy")), ctx)
+	}
+	return setImage(dst, src, "python:"+toolVersion(version), ctx)
+}
+
+func convertSetupJava(dst *harness.Step, src *github.Step, ctx *context) bool {
+	distribution := withString(src, "distribution", ctx)
+	image, ok := javaImages[distribution]
+	if !ok {
+		ctx.report.Addf("step %q: java distribution %q is not supported, the step is converted to an action step", stepName(src), distribution)
+		return convertActionStep(dst, src, ctx)
+	}
+	return setImage(dst, src, image+":"+toolVersion(withString(src, "java-version", ctx)), ctx)
+}
+
+// convertCacheAction converts the cache action to the stage
+// cache. The cache is saved when the stage completes.
+func convertCacheAction(dst *harness.Step, src *github.Step, ctx *context) bool {
+	var paths []string
+	for _, path := range withList(src, "path", ctx) {
+		paths = append(paths, path.(string))
+	}
+	var key string
+	if v := src.With["key"]; v != nil {
+		key = convertCacheKey(fmt.Sprint(v), ctx)
+	} else {
+		ctx.report.Addf("step %q: the cache key is not set, the default cache key is used", stepName(src))
+	}
+
+	if ctx.stage.cache == nil || ctx.stage.cache.Key == "" && len(ctx.stage.cache.Paths) == 0 {
+		ctx.stage.cache = &harness.Cache{
+			Enabled: true,
+			Key:     key,
+			Paths:   paths,
+		}
+	} else {
+		ctx.report.Addf("step %q: the stage cache supports a single key, the paths are added to the cache with key %q", stepName(src), ctx.stage.cache.Key)
+		ctx.stage.cache.Paths = append(ctx.stage.cache.Paths, paths...)
+	}
+	if _, ok := src.With["restore-keys"]; ok {
+		ctx.report.Addf("step %q: cache restore-keys are not supported", stepName(src))
+	}
+	return false
+}
+
+// convertCacheKey converts the cache key. The hashFiles
+// function is converted to the checksum of the file.
+func convertCacheKey(s string, ctx *context) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${{")
+		end := strings.Index(s, "}}")
+		if start == -1 || end < start {
+			break
+		}
+		b.WriteString(s[:start])
+		expr := s[start : end+2]
+		node, err := parseExpr(strings.TrimSpace(expr[3 : len(expr)-2]))
+		call, isCall := node.(*callNode)
+		path, isRef := refPath(node)
+		switch {
+		case err == nil && isCall && strings.EqualFold(call.name, "hashFiles") && len(call.args) != 0:
+			file, _ := call.args[0].(*literalNode)
+			if file == nil {
+				b.WriteString(convertExprs(expr, false, ctx))
+				break
+			}
+			if len(call.args) > 1 {
+				ctx.report.Addf("cache key %q: the checksum is calculated for the first file pattern only", s)
+			}
+			fmt.Fprintf(&b, "{{ checksum %q }}", strings.TrimPrefix(file.value, "**/"))
+		case err == nil && isRef && joinPath(path) == "runner.os" && ctx.stage.platform != nil:
+			b.WriteString(ctx.stage.platform.Os)
+		default:
+			b.WriteString(convertExprs(expr, false, ctx))
+		}
+		s = s[end+2:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// artifactKey returns the cache key used to share the named
+// artifact between the stages of the pipeline execution.
+func artifactKey(src *github.Step, ctx *context) string {
+	name := withString(src, "name", ctx)
+	if name == "" {
+		name = "artifact"
+	}
+	return "<+pipeline.executionId>/" + name
+}
+
+// convertUploadArtifact converts the upload artifact action
+// to a plugin step that saves the files to an s3 bucket,
+// from where they are restored by download artifact steps.
+func convertUploadArtifact(dst *harness.Step, src *github.Step, ctx *context) bool {
+	ctx.report.Addf("step %q: artifacts are shared using an s3 bucket, set the bucket and the access_key and secret_key settings", stepName(src))
+	return convertPlugin(dst, src, "plugins/s3-cache", map[string]interface{}{
+		"root":    "<+input>",
+		"path":    artifactKey(src, ctx),
+		"mount":   withList(src, "path", ctx),
+		"rebuild": true,
+	}, ctx)
+}
+
+// convertDownloadArtifact converts the download artifact
+// action to a plugin step that restores the files saved by
+// the upload artifact step.
+func convertDownloadArtifact(dst *harness.Step, src *github.Step, ctx *context) bool {
+	ctx.report.Addf("step %q: artifacts are shared using an s3 bucket, set the bucket and the access_key and secret_key settings", stepName(src))
+	if withString(src, "path", ctx) != "" {
+		ctx.report.Addf("step %q: artifacts are restored to the path they were uploaded from", stepName(src))
+	}
+	return convertPlugin(dst, src, "plugins/s3-cache", map[string]interface{}{
+		"root":    "<+input>",
+		"path":    artifactKey(src, ctx),
+		"restore": true,
+	}, ctx)
+}
+
+// convertDockerLogin stores the registry connector, which
+// is used by the build and push steps. The docker hub
+// connector is used for docker hub, if configured.
+// Otherwise a connector must be created for the registry.
+func convertDockerLogin(dst *harness.Step, src *github.Step, ctx *context) bool {
+	registry := withString(src, "registry", ctx)
+	host := registry
+	if host == "" {
+		host = "docker.io"
+	}
+	login := &dockerLogin{registry: registry}
+	if host == "docker.io" && ctx.dockerhubConn != "" {
+		login.connector = ctx.dockerhubConn
+	} else {
+		login.connector = slug.Create(host)
+		ctx.report.Addf("step %q: create a docker registry connector %q for %s with username %s and password %s",
+			stepName(src), login.connector, host, withString(src, "username", ctx), withString(src, "password", ctx))
+	}
+	ctx.stage.login = login
+	return false
+}
+
+// convertDockerBuildPush converts the build and push action
+// to a native build and push step, using the connector of
+// the docker login action. The native step always pushes
+// the image, so images that are only built use the docker
+// plugin.
+func convertDockerBuildPush(dst *harness.Step, src *github.Step, ctx *context) bool {
+	with := map[string]interface{}{}
+	copyWith(with, src, ctx, map[string]string{
+		"context": "context",
+		"file":    "dockerfile",
+		"target":  "target",
+	})
+
+	// the tags are formatted as repo:tag.
+	var tags []interface{}
+	for _, item := range withList(src, "tags", ctx) {
+		tag := item.(string)
+		repo := tag
+		if i := strings.LastIndex(tag, ":"); i > strings.LastIndex(tag, "/") {
+			repo, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = "latest"
+		}
+		if _, ok := with["repo"]; !ok {
+			with["repo"] = repo
+		} else if with["repo"] != repo {
+			ctx.report.Addf("step %q: tags for repository %q are ignored, the step pushes to a single repository", stepName(src), repo)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	if tags != nil {
+		with["tags"] = tags
+	}
+	if withString(src, "platforms", ctx) != "" {
+		ctx.report.Addf("step %q: multi-platform builds are not supported by the native build and push step", stepName(src))
+	}
+
+	// push expressions, such as pushing on events other than
+	// pull requests, are converted to a step condition.
+	push := ""
+	if v := src.With["push"]; v != nil {
+		push = strings.TrimSpace(fmt.Sprint(v))
+	}
+	if strings.Contains(push, "${{") {
+		eval := convertCondition(push, ctx)
+		if eval == push {
+			ctx.report.Addf("step %q: push %q cannot be converted, the image is built without pushing", stepName(src), push)
+			push = "false"
+		} else {
+			ctx.report.Addf("step %q: the image is built and pushed when %s, the build is skipped otherwise", stepName(src), eval)
+			dst.When = andWhen(dst.When, eval)
+			push = "true"
+		}
+	}
+	if push != "true" {
+		if args := withLines(src, "build-args", ctx); args != nil {
+			with["build_args"] = args
+		}
+		with["dry_run"] = true
+		return convertPlugin(dst, src, "plugins/docker", with, ctx)
+	}
+
+	if args := buildArgs(withLines(src, "build-args", ctx)); args != nil {
+		with["build_args"] = args
+	}
+	if ctx.stage.login == nil {
+		ctx.report.Addf("step %q: select a harness docker connector", stepName(src))
+		with["connector"] = "<+input>"
+	} else {
+		with["connector"] = ctx.stage.login.connector
+		// the registry is only required for registries
+		// other than docker hub.
+		if ctx.stage.login.registry != "" && ctx.stage.login.registry != "docker.io" {
+			with["registry"] = ctx.stage.login.registry
+		}
+	}
+	dst.Type = "template"
+	dst.Spec = &stepTemplate{
+		Uses: "buildAndPushDockerRegistry",
+		With: with,
+	}
+	return true
+}
+
+// andWhen adds the expression to the step condition.
+func andWhen(when *harness.When, eval string) *harness.When {
+	switch {
+	case when == nil:
+		return &harness.When{Eval: eval}
+	case when.Eval == "":
+		when.Eval = eval
+	default:
+		when.Eval = "(" + when.Eval + ") && (" + eval + ")"
+	}
+	return when
+}
+
+// buildArgs converts the KEY=value build arguments to a
+// map.
+func buildArgs(args []interface{}) map[string]interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	dst := map[string]interface{}{}
+	for _, arg := range args {
+		k, v, _ := strings.Cut(arg.(string), "=")
+		dst[k] = v
+	}
+	return dst
+}
+
+func convertCodecov(dst *harness.Step, src *github.Step, ctx *context) bool {
+	with := map[string]interface{}{}
+	copyWith(with, src, ctx, map[string]string{
+		"token": "token",
+		"name":  "name",
+	})
+	if files := withList(src, "files", ctx); files != nil {
+		with["files"] = files
+	}
+	if flags := withList(src, "flags", ctx); flags != nil {
+		with["flags"] = flags
+	}
+	return convertPlugin(dst, src, "plugins/codecov", with, ctx)
+}
+
+func convertGithubRelease(dst *harness.Step, src *github.Step, ctx *context) bool {
+	with := map[string]interface{}{}
+	copyWith(with, src, ctx, map[string]string{
+		"name":       "title",
+		"body":       "note",
+		"draft":      "draft",
+		"prerelease": "prerelease",
+	})
+	if token := withString(src, "token", ctx); token != "" {
+		with["api_key"] = token
+	} else {
+		with["api_key"] = ctx.secrets.expr(githubToken, ctx.report)
+	}
+	if files := withList(src, "files", ctx); files != nil {
+		with["files"] = files
+	}
+	ctx.report.Addf("step %q: the release plugin publishes releases for tag events only", stepName(src))
+	return convertPlugin(dst, src, "plugins/github-release", with, ctx)
+}
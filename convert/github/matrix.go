@@ -0,0 +1,369 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// runtimeInput is the value of a matrix axis that is
+// provided when the pipeline runs.
+const runtimeInput = "<+input>"
+
+// matrixStage is the runner and matrix strategy of a
+// stage converted from a matrix job. Jobs that run the
+// matrix combinations on different platforms convert to
+// a stage per platform.
+type matrixStage struct {
+	// suffix is appended to the job name to name the
+	// stage, if the job converts to multiple stages.
+	suffix string
+
+	runner   *runner
+	strategy *harness.Strategy
+}
+
+// convertMatrix converts the job runs-on and matrix strategy
+// to the stage runners and strategies. If a runs-on label
+// is a matrix axis, the combinations are grouped by the
+// runner platform.
+func (d *Converter) convertMatrix(name string, job *github.Job, ctx *context) []*matrixStage {
+	axis, index, isAxis := matrixRunsOn(job.RunsOn)
+	if job.Strategy == nil || job.Strategy.Matrix == nil {
+		return []*matrixStage{{runner: d.convertRunsOn(name, job.RunsOn, ctx)}}
+	}
+	src := job.Strategy.Matrix
+
+	// matrices generated at runtime, such as matrices
+	// created by a previous job, cannot be expanded.
+	if src.Expression != "" {
+		ctx.report.Addf("job %q: the matrix is generated at runtime by %q, define the matrix axes and provide the values as runtime input", name, src.Expression)
+		return []*matrixStage{{runner: d.convertRunsOn(name, job.RunsOn, ctx)}}
+	}
+	if len(src.Expressions) != 0 {
+		return []*matrixStage{{
+			runner:   d.convertRunsOn(name, job.RunsOn, ctx),
+			strategy: convertDynamicMatrix(name, job.Strategy, ctx),
+		}}
+	}
+
+	combos := matrixCombinations(src)
+	if !isAxis {
+		return []*matrixStage{{
+			runner:   d.convertRunsOn(name, job.RunsOn, ctx),
+			strategy: convertCombinations(job.Strategy, combos),
+		}}
+	}
+
+	// group the combinations by the platform of the
+	// runs-on axis value.
+	var stages []*matrixStage
+	groups := map[string]*matrixStage{}
+	grouped := map[*matrixStage][]map[string]string{}
+	for _, combo := range combos {
+		runsOn := *job.RunsOn
+		runsOn.Labels = append(github.Stringorslice{}, job.RunsOn.Labels...)
+		runsOn.Labels[index] = combo[axis]
+		runner := d.convertRunsOn(name, &runsOn, ctx)
+		if runner.platform == nil {
+			runner = d.convertRunsOn(name, &github.RunsOn{Labels: github.Stringorslice{"ubuntu-latest"}}, ctx)
+		}
+		suffix := runner.platform.Os
+		if runner.platform.Arch != harness.ArchAmd64.String() {
+			suffix += "_" + runner.platform.Arch
+		}
+		stage, ok := groups[suffix]
+		if !ok {
+			stage = &matrixStage{suffix: "_" + suffix, runner: runner}
+			groups[suffix] = stage
+			stages = append(stages, stage)
+		}
+		grouped[stage] = append(grouped[stage], combo)
+	}
+	if len(stages) == 0 {
+		return []*matrixStage{{runner: d.convertRunsOn(name, nil, ctx)}}
+	}
+	if len(stages) == 1 {
+		stages[0].suffix = ""
+		stages[0].strategy = convertCombinations(job.Strategy, combos)
+		return stages
+	}
+	ctx.report.Addf("job %q: the matrix runs on multiple platforms and is converted to a stage per platform", name)
+	for _, stage := range stages {
+		stage.strategy = convertStrategy(job.Strategy, combinationMatrix(grouped[stage]))
+	}
+	return stages
+}
+
+// matrixRunsOn returns the matrix axis name and the label
+// index if a runs-on label is a matrix axis, such as
+// ${{ matrix.os }}.
+func matrixRunsOn(src *github.RunsOn) (string, int, bool) {
+	if src == nil {
+		return "", 0, false
+	}
+	for i, label := range src.Labels {
+		if axis, ok := matrixAxis(label); ok {
+			return axis, i, true
+		}
+	}
+	return "", 0, false
+}
+
+// matrixAxis returns the matrix axis name if the value is a
+// matrix axis expression.
+func matrixAxis(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "${{") || !strings.HasSuffix(s, "}}") {
+		return "", false
+	}
+	node, err := parseExpr(strings.TrimSpace(s[3 : len(s)-2]))
+	if err != nil {
+		return "", false
+	}
+	path, ok := refPath(node)
+	if !ok || len(path) != 2 || path[0] != "matrix" {
+		return "", false
+	}
+	return path[1], true
+}
+
+// convertDynamicMatrix converts a matrix with axes that are
+// generated at runtime. The axis values are provided as
+// runtime input.
+func convertDynamicMatrix(name string, src *github.Strategy, ctx *context) *harness.Strategy {
+	axes := map[string][]string{}
+	for key, values := range src.Matrix.Matrix {
+		axes[key] = values
+	}
+	for key, expr := range src.Matrix.Expressions {
+		switch key {
+		case "include", "exclude":
+			ctx.report.Addf("job %q: matrix %s is generated at runtime by %q and is ignored", name, key, expr)
+		default:
+			ctx.report.Addf("job %q: matrix axis %s is generated at runtime by %q, provide the axis values as runtime input", name, key, expr)
+			axes[key] = []string{runtimeInput}
+		}
+	}
+	if len(src.Matrix.Include) != 0 {
+		ctx.report.Addf("job %q: matrix include is not supported for axes generated at runtime", name)
+	}
+	return convertStrategy(src, &harness.Matrix{
+		Axis:    axes,
+		Exclude: stringMaps(src.Matrix.Exclude),
+	})
+}
+
+// convertCombinations converts the matrix combinations to a
+// strategy. Matrices without includes convert to the matrix
+// axes and excludes, other matrices convert to the explicit
+// combinations.
+func convertCombinations(src *github.Strategy, combos []map[string]string) *harness.Strategy {
+	if len(src.Matrix.Include) == 0 {
+		return convertStrategy(src, &harness.Matrix{
+			Axis:    src.Matrix.Matrix,
+			Exclude: stringMaps(src.Matrix.Exclude),
+		})
+	}
+	return convertStrategy(src, combinationMatrix(combos))
+}
+
+// convertStrategy returns the matrix strategy with the
+// max-parallel setting.
+func convertStrategy(src *github.Strategy, matrix *harness.Matrix) *harness.Strategy {
+	matrix.Concurrency = int64(src.MaxParallel)
+	return &harness.Strategy{
+		Type: "matrix",
+		Spec: matrix,
+	}
+}
+
+// convertFailFast reports the fail-fast setting, which is
+// enabled by default. Harness does not cancel the sibling
+// matrix combinations when a combination fails, and a
+// stage failure strategy would abort the pipeline, so the
+// setting is not converted.
+func convertFailFast(name string, src *github.Strategy, ctx *context) {
+	if src == nil || src.Matrix == nil || (src.FailFast != nil && !*src.FailFast) {
+		return
+	}
+	ctx.report.Addf("job %q: fail-fast is not supported, the remaining matrix combinations run when a combination fails", name)
+}
+
+// matrixCombinations returns the matrix combinations. The
+// combinations of the axes that match an exclude are
+// removed. An include adds its values to the combinations
+// that it matches without overwriting the axis values, and
+// is added as a combination if it matches none.
+func matrixCombinations(src *github.Matrix) []map[string]string {
+	var keys []string
+	for key := range src.Matrix {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var combos []map[string]string
+	if len(keys) != 0 {
+		combos = product(keys, src.Matrix)
+	}
+
+	excludes := stringMaps(src.Exclude)
+	var filtered []map[string]string
+	for _, combo := range combos {
+		excluded := false
+		for _, exclude := range excludes {
+			if matches(combo, exclude, nil) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			filtered = append(filtered, combo)
+		}
+	}
+	combos = filtered
+
+	original := len(combos)
+	for _, include := range stringMaps(src.Include) {
+		matched := false
+		for _, combo := range combos[:original] {
+			if !matches(combo, include, src.Matrix) {
+				continue
+			}
+			matched = true
+			for k, v := range include {
+				combo[k] = v
+			}
+		}
+		if !matched {
+			combo := map[string]string{}
+			for k, v := range include {
+				combo[k] = v
+			}
+			combos = append(combos, combo)
+		}
+	}
+	return combos
+}
+
+// matches returns true if the combination has the values of
+// the match. If axes is not nil, only the values of the axes
+// are compared.
+func matches(combo, match map[string]string, axes map[string][]string) bool {
+	for k, v := range match {
+		if axes != nil {
+			if _, ok := axes[k]; !ok {
+				continue
+			}
+		}
+		if combo[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// product returns the cartesian product of the axes.
+func product(keys []string, axes map[string][]string) []map[string]string {
+	combos := []map[string]string{{}}
+	for _, key := range keys {
+		var next []map[string]string
+		for _, combo := range combos {
+			for _, value := range axes[key] {
+				dst := map[string]string{key: value}
+				for k, v := range combo {
+					dst[k] = v
+				}
+				next = append(next, dst)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// combinationMatrix returns the matrix that runs exactly the
+// combinations. The axes contain the values of the
+// combinations, and the other combinations of the axes are
+// excluded. A combination without a value for an axis is
+// run with an empty value.
+func combinationMatrix(combos []map[string]string) *harness.Matrix {
+	var keys []string
+	axes := map[string][]string{}
+	for _, combo := range combos {
+		for k := range combo {
+			if _, ok := axes[k]; !ok {
+				keys = append(keys, k)
+				axes[k] = nil
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	// the axis values are ordered by first use.
+	seen := map[string]bool{}
+	for _, combo := range combos {
+		for _, k := range keys {
+			v := combo[k]
+			if id := k + "\x00" + v; !seen[id] {
+				seen[id] = true
+				axes[k] = append(axes[k], v)
+			}
+		}
+	}
+
+	included := map[string]bool{}
+	for _, combo := range combos {
+		included[comboID(keys, combo)] = true
+	}
+	var excludes []map[string]string
+	for _, combo := range product(keys, axes) {
+		if !included[comboID(keys, combo)] {
+			excludes = append(excludes, combo)
+		}
+	}
+	return &harness.Matrix{
+		Axis:    axes,
+		Exclude: excludes,
+	}
+}
+
+// comboID returns a string that identifies the combination.
+func comboID(keys []string, combo map[string]string) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = combo[k]
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// stringMaps returns the maps with the values converted to
+// strings.
+func stringMaps(maps []map[string]interface{}) []map[string]string {
+	var dst []map[string]string
+	for _, src := range maps {
+		m := map[string]string{}
+		for k, v := range src {
+			m[k] = fmt.Sprint(v)
+		}
+		dst = append(dst, m)
+	}
+	return dst
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/report"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// stageParallel defines a group of stages that execute
+// in parallel.
+type stageParallel struct {
+	Stages []*harness.Stage `json:"stages,omitempty"`
+}
+
+// appendGroup appends the stages to the pipeline stages.
+// Stages that do not depend on each other are grouped into
+// a parallel stage.
+func appendGroup(dst, stages []*harness.Stage) []*harness.Stage {
+	switch len(stages) {
+	case 0:
+		return dst
+	case 1:
+		return append(dst, stages[0])
+	}
+	return append(dst, &harness.Stage{
+		Type: "parallel",
+		Spec: &stageParallel{Stages: stages},
+	})
+}
+
+// sortJobs orders the jobs topologically using the job
+// needs. The jobs are grouped by their depth in the
+// dependency graph, so the jobs in a group do not depend
+// on each other and can execute in parallel. The jobs in
+// a group are sorted by identifier, so the order is the
+// same for every conversion of the same workflow.
+//
+// Needs that reference unknown jobs are ignored, and
+// recorded in the report. An error is returned if the
+// needs contain a cycle.
+func sortJobs(jobs map[string]*github.Job, r *report.Report) ([][]string, error) {
+	depth := map[string]int{}
+	visiting := map[string]bool{}
+
+	var visit func(name string, path []string) (int, error)
+	visit = func(name string, path []string) (int, error) {
+		if d, ok := depth[name]; ok {
+			return d, nil
+		}
+		if visiting[name] {
+			return 0, fmt.Errorf("github: job dependency cycle %s", strings.Join(append(path, name), " -> "))
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+
+		d := 0
+		for _, need := range jobs[name].Needs {
+			if jobs[need] == nil {
+				r.Addf("job %q: needs unknown job %q, the dependency is ignored", name, need)
+				continue
+			}
+			n, err := visit(need, append(path, name))
+			if err != nil {
+				return 0, err
+			}
+			if n+1 > d {
+				d = n + 1
+			}
+		}
+		depth[name] = d
+		return d, nil
+	}
+
+	var names []string
+	for name, job := range jobs {
+		if job != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var groups [][]string
+	for _, name := range names {
+		d, err := visit(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		for len(groups) <= d {
+			groups = append(groups, nil)
+		}
+		groups[d] = append(groups[d], name)
+	}
+	return groups, nil
+}
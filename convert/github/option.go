@@ -14,6 +14,18 @@
 
 package github
 
+// Environment defines the protection rules of a GitHub
+// environment, which are not defined in the workflow.
+type Environment struct {
+	// Approvers are the user groups that approve the
+	// deployments to the environment.
+	Approvers []string
+
+	// MinimumApprovals is the number of approvals that
+	// are required. The default is one approval.
+	MinimumApprovals int
+}
+
 // Option configures a Converter option.
 type Option func(*Converter)
 
@@ -33,3 +45,55 @@ func WithKubernetes(namespace, connector string) Option {
 		d.kubeConnector = connector
 	}
 }
+
+// WithOrgSecrets returns an option to set secrets that
+// resolve to organization scoped harness secrets.
+func WithOrgSecrets(secrets ...string) Option {
+	return func(d *Converter) {
+		d.orgSecrets = secrets
+	}
+}
+
+// WithAccountSecrets returns an option to set secrets that
+// resolve to account scoped harness secrets.
+func WithAccountSecrets(secrets ...string) Option {
+	return func(d *Converter) {
+		d.accountSecrets = secrets
+	}
+}
+
+// WithRoot returns an option to set the repository root,
+// which is used to load local reusable workflows.
+func WithRoot(root string) Option {
+	return func(d *Converter) {
+		d.root = root
+	}
+}
+
+// WithWorkflowCache returns an option to set the directory
+// used to load remote reusable workflows. The workflow
+// owner/repo/path@ref is loaded from owner/repo/ref/path.
+func WithWorkflowCache(dir string) Option {
+	return func(d *Converter) {
+		d.workflowCache = dir
+	}
+}
+
+// WithRunners returns an option to map self-hosted runner
+// labels to harness delegate selectors. Labels mapped to
+// KubernetesRunner convert to the kubernetes runtime.
+func WithRunners(runners map[string]string) Option {
+	return func(d *Converter) {
+		d.runners = runners
+	}
+}
+
+// WithEnvironments returns an option to set the protection
+// rules of the environments. Jobs that deploy to an
+// environment with approvers are preceded by an approval
+// stage.
+func WithEnvironments(environments map[string]*Environment) Option {
+	return func(d *Converter) {
+		d.environments = environments
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/slug"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+var (
+	// echoFileRe matches a line that appends an echo to a
+	// github environment file, such as
+	// echo "version=1.0" >> $GITHUB_OUTPUT
+	echoFileRe = regexp.MustCompile(`^(\s*)echo\s+(.+?)\s*>>\s*"?\$\{?(GITHUB_OUTPUT|GITHUB_ENV|GITHUB_PATH)\}?"?\s*$`)
+
+	// setOutputRe matches the deprecated set-output command,
+	// such as echo "::set-output name=version::1.0"
+	setOutputRe = regexp.MustCompile(`^(\s*)echo\s+(.+)$`)
+
+	// outputNameRe matches the names of the outputs and
+	// environment variables that can be converted.
+	outputNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+	// envFileRe matches a reference to a github environment
+	// file.
+	envFileRe = regexp.MustCompile(`\$\{?GITHUB_(OUTPUT|ENV|PATH)\b`)
+)
+
+// stepEnv is an environment variable that a step sets for
+// the steps that follow it by writing to GITHUB_ENV.
+type stepEnv struct {
+	name string
+	step string
+}
+
+// convertOutputs rewrites the writes to the GITHUB_OUTPUT,
+// GITHUB_ENV and GITHUB_PATH files to exported variables,
+// which are the output variables of the step. Variables
+// written to GITHUB_ENV and GITHUB_PATH are passed to the
+// steps that follow.
+func convertOutputs(dst *harness.Step, spec *harness.StepExec, src *github.Step, ctx *context) {
+	if spec.Run == "" || ctx.stage == nil || !envFileRe.MatchString(spec.Run) {
+		return
+	}
+
+	var outputs []string
+	var envs []string
+	lines := strings.Split(spec.Run, "\n")
+	for i, line := range lines {
+		indent, file, name, value, quote, ok := parseEnvFileWrite(line)
+		if !ok {
+			continue
+		}
+		switch file {
+		case "GITHUB_OUTPUT":
+			name = outputName(name)
+			outputs = append(outputs, name)
+		case "GITHUB_ENV":
+			outputs = append(outputs, name)
+			envs = append(envs, name)
+		case "GITHUB_PATH":
+			ctx.stage.paths = append(ctx.stage.paths, value)
+			name, value, quote = "PATH", value+":$PATH", `"`
+		}
+		lines[i] = fmt.Sprintf("%sexport %s=%s%s%s", indent, name, quote, value, quote)
+	}
+	spec.Run = strings.Join(lines, "\n")
+
+	if envFileRe.MatchString(spec.Run) {
+		ctx.report.Addf("step %q: only single line echo commands that write to the github environment files are converted", stepName(src))
+	}
+	if len(outputs) == 0 {
+		return
+	}
+
+	spec.Outputs = appendUnique(spec.Outputs, outputs...)
+	if dst.Id == "" {
+		dst.Id = ctx.stage.ids.Generate(slug.Create(src.Name), "step")
+	}
+	for _, name := range envs {
+		ctx.stage.envs = append(ctx.stage.envs, &stepEnv{name: name, step: dst.Id})
+	}
+}
+
+// parseEnvFileWrite parses a line that writes to a github
+// environment file, and returns the file, the variable name
+// and value, and the quote character of the value.
+func parseEnvFileWrite(line string) (indent, file, name, value, quote string, ok bool) {
+	if m := echoFileRe.FindStringSubmatch(line); m != nil {
+		indent, file = m[1], m[3]
+		text, q := unquote(m[2])
+		if file == "GITHUB_PATH" {
+			return indent, file, "", text, q, true
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 || !outputNameRe.MatchString(parts[0]) {
+			return "", "", "", "", "", false
+		}
+		if q == "" {
+			q = `"`
+		}
+		return indent, file, parts[0], parts[1], q, true
+	}
+	if m := setOutputRe.FindStringSubmatch(line); m != nil {
+		text, q := unquote(m[2])
+		if !strings.HasPrefix(text, "::set-output name=") {
+			return "", "", "", "", "", false
+		}
+		parts := strings.SplitN(strings.TrimPrefix(text, "::set-output name="), "::", 2)
+		if len(parts) != 2 || !outputNameRe.MatchString(parts[0]) {
+			return "", "", "", "", "", false
+		}
+		if q == "" {
+			q = `"`
+		}
+		return m[1], "GITHUB_OUTPUT", parts[0], parts[1], q, true
+	}
+	return "", "", "", "", "", false
+}
+
+// unquote removes the quotes around the shell word, and
+// returns the quote character.
+func unquote(s string) (string, string) {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], s[:1]
+	}
+	return s, ""
+}
+
+// outputName returns the name of the output variable. Output
+// variables are shell variables, so dashes are replaced.
+func outputName(s string) string {
+	return strings.ReplaceAll(s, "-", "_")
+}
+
+// appendUnique appends the values that are not in the list.
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// convertStepEnv passes the environment variables that the
+// previous steps wrote to GITHUB_ENV and GITHUB_PATH to the
+// step. Variables set by the step take precedence.
+func convertStepEnv(dst *harness.Step, src *github.Step, ctx *context) {
+	if ctx.stage == nil || (len(ctx.stage.envs) == 0 && len(ctx.stage.paths) == 0) {
+		return
+	}
+	envs := map[string]string{}
+	for _, env := range ctx.stage.envs {
+		envs[env.name] = "<+steps." + slug.Create(env.step) + ".output.outputVariables." + env.name + ">"
+	}
+
+	var stepEnvs *map[string]string
+	switch spec := dst.Spec.(type) {
+	case *harness.StepExec:
+		stepEnvs = &spec.Envs
+		// the paths written last take precedence.
+		if n := len(ctx.stage.paths); n != 0 && isPosixShell(src, ctx) {
+			paths := make([]string, n)
+			for i, path := range ctx.stage.paths {
+				paths[n-1-i] = path
+			}
+			spec.Run = fmt.Sprintf("export PATH=\"%s:$PATH\"\n%s", strings.Join(paths, ":"), spec.Run)
+		}
+	case *harness.StepPlugin:
+		stepEnvs = &spec.Envs
+	case *harness.StepAction:
+		stepEnvs = &spec.Envs
+	default:
+		return
+	}
+	if len(envs) == 0 {
+		return
+	}
+	if *stepEnvs == nil {
+		*stepEnvs = map[string]string{}
+	}
+	for k, v := range envs {
+		if _, ok := (*stepEnvs)[k]; !ok {
+			(*stepEnvs)[k] = v
+		}
+	}
+}
+
+// stepOutputExpr returns the expression of the step output.
+// If the stage is not empty, the expression references the
+// step in the stage, otherwise it references the step in
+// the current stage.
+func stepOutputExpr(stage, step, name string) string {
+	if stage == "" {
+		return "<+steps." + slug.Create(step) + ".output.outputVariables." + outputName(name) + ">"
+	}
+	return "<+pipeline.stages." + slug.Create(stage) + ".spec.execution.steps." + slug.Create(step) + ".output.outputVariables." + outputName(name) + ">"
+}
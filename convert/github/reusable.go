@@ -0,0 +1,323 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+)
+
+// callScope binds the inputs and secrets of a reusable
+// workflow to the values passed by the calling job.
+type callScope struct {
+	parent *callScope
+
+	// name is the name of the calling job.
+	name string
+
+	// cond is the if condition of the calling job, which
+	// is evaluated in the parent scope.
+	cond string
+
+	inputs  map[string]*binding
+	secrets map[string]*binding
+	inherit bool
+}
+
+// binding is an expression bound to a reusable workflow
+// input or secret. The expression is evaluated in the
+// scope of the calling job.
+type binding struct {
+	node  exprNode
+	scope *callScope
+}
+
+// expandJobs replaces the jobs that call reusable workflows
+// with the jobs of the called workflows. The called jobs
+// are named after the calling job and the called job, and
+// run after the jobs the calling job needs. Jobs that need
+// the calling job need all the called jobs.
+//
+// The returned scopes map the job names to the scope in
+// which the job expressions are evaluated.
+func (d *Converter) expandJobs(jobs map[string]*github.Job, scope *callScope, path []string, ctx *context) (map[string]*github.Job, map[string]*callScope) {
+	out := map[string]*github.Job{}
+	scopes := map[string]*callScope{}
+	calls := map[string][]string{}
+
+	for name, job := range jobs {
+		if job == nil {
+			continue
+		}
+		if job.Uses == "" {
+			out[name] = job
+			scopes[name] = scope
+			continue
+		}
+
+		called, err := d.loadWorkflow(job.Uses, path)
+		if err != nil {
+			ctx.report.Addf("job %q: reusable workflow %q cannot be resolved: %s", name, job.Uses, err)
+			out[name] = job
+			scopes[name] = scope
+			continue
+		}
+		if job.Strategy != nil {
+			ctx.report.Addf("job %q: matrix strategy is not supported for reusable workflow calls", name)
+		}
+
+		child := newCallScope(name, job, called, scope, ctx)
+		sub, subScopes := d.expandJobs(called.Jobs, child, append(path, job.Uses), ctx)
+		for subName, subJob := range sub {
+			dst := *subJob
+			dst.Env = mergeEnv(called.Env, subJob.Env)
+			dst.Defaults = mergeDefaults(called.Defaults, subJob.Defaults)
+			if len(subJob.Needs) == 0 {
+				dst.Needs = job.Needs
+			} else {
+				dst.Needs = nil
+				for _, need := range subJob.Needs {
+					dst.Needs = append(dst.Needs, name+"_"+need)
+				}
+			}
+			out[name+"_"+subName] = &dst
+			scopes[name+"_"+subName] = subScopes[subName]
+			calls[name] = append(calls[name], name+"_"+subName)
+		}
+	}
+
+	// jobs that need a calling job need all the jobs of
+	// the called workflow.
+	for name, job := range out {
+		var needs []string
+		var changed bool
+		for _, need := range job.Needs {
+			if called, ok := calls[need]; ok {
+				needs = append(needs, called...)
+				changed = true
+			} else {
+				needs = append(needs, need)
+			}
+		}
+		if changed {
+			dst := *job
+			dst.Needs = needs
+			out[name] = &dst
+		}
+	}
+	return out, scopes
+}
+
+// loadWorkflow loads the reusable workflow. Local workflows
+// are loaded from the repository root, and remote workflows
+// are loaded from the workflow cache, where the workflow
+// owner/repo/path@ref is stored at owner/repo/ref/path.
+func (d *Converter) loadWorkflow(uses string, path []string) (*github.Pipeline, error) {
+	for _, v := range path {
+		if v == uses {
+			return nil, fmt.Errorf("reusable workflow cycle %s", strings.Join(append(path, uses), " -> "))
+		}
+	}
+
+	var file string
+	switch {
+	case strings.HasPrefix(uses, "./"):
+		if d.root == "" {
+			return nil, errors.New("repository root is not configured")
+		}
+		file = filepath.Join(d.root, filepath.FromSlash(uses))
+	default:
+		if d.workflowCache == "" {
+			return nil, errors.New("workflow cache is not configured")
+		}
+		i := strings.LastIndex(uses, "@")
+		parts := strings.SplitN(uses, "/", 3)
+		if i == -1 || len(parts) != 3 {
+			return nil, errors.New("invalid reusable workflow reference")
+		}
+		owner, repo := parts[0], parts[1]
+		ref := uses[i+1:]
+		file = filepath.Join(d.workflowCache, owner, repo, ref,
+			filepath.FromSlash(strings.TrimSuffix(parts[2], "@"+ref)))
+	}
+	return github.ParseFile(file)
+}
+
+// newCallScope returns the scope of a reusable workflow
+// called by the job. Inputs that are not passed by the job
+// are bound to the input defaults.
+func newCallScope(name string, job *github.Job, called *github.Pipeline, parent *callScope, ctx *context) *callScope {
+	scope := &callScope{
+		parent:  parent,
+		name:    name,
+		cond:    job.If,
+		inputs:  map[string]*binding{},
+		secrets: map[string]*binding{},
+	}
+	inputs := workflowCallInputs(called)
+	for key, input := range inputs {
+		if input != nil && input.Default != nil {
+			scope.inputs[key] = &binding{
+				node:  typedLiteral(fmt.Sprint(input.Default), input),
+				scope: parent,
+			}
+		}
+	}
+	for key, value := range job.With {
+		node := parseBinding(value, ctx)
+		if lit, ok := node.(*literalNode); ok {
+			node = typedLiteral(lit.value, inputs[key])
+		}
+		scope.inputs[key] = &binding{
+			node:  node,
+			scope: parent,
+		}
+	}
+	if job.Secrets != nil {
+		scope.inherit = job.Secrets.Inherit
+		for key, value := range job.Secrets.Values {
+			scope.secrets[key] = &binding{
+				node:  parseBinding(value, ctx),
+				scope: parent,
+			}
+		}
+	}
+	return scope
+}
+
+// workflowCallInputs returns the inputs of the reusable
+// workflow.
+func workflowCallInputs(src *github.Pipeline) map[string]*github.Input {
+	if src.On == nil || src.On.WorkflowCall == nil {
+		return nil
+	}
+	dst := map[string]*github.Input{}
+	for key, value := range src.On.WorkflowCall.Inputs {
+		input := new(github.Input)
+		if m, ok := value.(map[string]interface{}); ok {
+			input.Default = m["default"]
+			input.Type, _ = m["type"].(string)
+			input.Required, _ = m["required"].(bool)
+			input.Description, _ = m["description"].(string)
+		}
+		dst[key] = input
+	}
+	return dst
+}
+
+// typedLiteral returns the input value as a literal of the
+// input type, so boolean and number inputs are not
+// compared as strings.
+func typedLiteral(s string, input *github.Input) *literalNode {
+	if input != nil {
+		switch input.Type {
+		case "boolean":
+			if s == "true" || s == "false" {
+				return &literalNode{kind: tokenIdent, value: s}
+			}
+		case "number":
+			if isNumber(s) {
+				return &literalNode{kind: tokenNumber, value: s}
+			}
+		}
+	}
+	return &literalNode{kind: tokenString, value: s}
+}
+
+// parseBinding parses a value passed to a reusable workflow.
+// Plain text is parsed as a string literal, and text with
+// embedded expressions is parsed as a format call.
+func parseBinding(s string, ctx *context) exprNode {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "${{") && strings.HasSuffix(trimmed, "}}") &&
+		strings.Count(trimmed, "${{") == 1 {
+		expr := strings.TrimSpace(trimmed[3 : len(trimmed)-2])
+		node, err := parseExpr(expr)
+		if err != nil {
+			ctx.report.Addf("expression %q cannot be parsed: %s", expr, err)
+			return &literalNode{kind: tokenString, value: s}
+		}
+		return node
+	}
+	if !strings.Contains(s, "${{") {
+		return &literalNode{kind: tokenString, value: s}
+	}
+
+	var format strings.Builder
+	call := &callNode{name: "format"}
+	for {
+		start := strings.Index(s, "${{")
+		end := strings.Index(s, "}}")
+		if start == -1 || end < start {
+			break
+		}
+		expr := strings.TrimSpace(s[start+3 : end])
+		node, err := parseExpr(expr)
+		if err != nil {
+			ctx.report.Addf("expression %q cannot be parsed: %s", expr, err)
+			node = &literalNode{kind: tokenString, value: s[start : end+2]}
+		}
+		format.WriteString(escapeFormat(s[:start]))
+		fmt.Fprintf(&format, "{%d}", len(call.args))
+		call.args = append(call.args, node)
+		s = s[end+2:]
+	}
+	format.WriteString(escapeFormat(s))
+	call.args = append([]exprNode{&literalNode{kind: tokenString, value: format.String()}}, call.args...)
+	return call
+}
+
+// escapeFormat escapes the braces in format string text.
+func escapeFormat(s string) string {
+	s = strings.ReplaceAll(s, "{", "{{")
+	return strings.ReplaceAll(s, "}", "}}")
+}
+
+// mergeEnv returns the workflow environment merged with the
+// job environment. Job variables take precedence.
+func mergeEnv(workflow, job map[string]string) map[string]string {
+	if len(workflow) == 0 {
+		return job
+	}
+	dst := map[string]string{}
+	for k, v := range workflow {
+		dst[k] = v
+	}
+	for k, v := range job {
+		dst[k] = v
+	}
+	return dst
+}
+
+// callConditions returns the converted if conditions of the
+// jobs that call the reusable workflow in the current scope.
+func callConditions(ctx *context) []string {
+	saved := ctx.scope
+	defer func() { ctx.scope = saved }()
+
+	var conds []string
+	for scope := saved; scope != nil; scope = scope.parent {
+		if scope.cond == "" {
+			continue
+		}
+		ctx.scope = scope.parent
+		conds = append(conds, convertCondition(scope.cond, ctx))
+	}
+	return conds
+}
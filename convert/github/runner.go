@@ -0,0 +1,208 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// KubernetesRunner is the runner mapping value that converts
+// the jobs that run on a self-hosted runner label to the
+// kubernetes runtime.
+const KubernetesRunner = "kubernetes"
+
+// coresRe matches the number of cores in the name of a
+// larger runner, such as ubuntu-22.04-16core.
+var coresRe = regexp.MustCompile(`(\d+)[-_]?cores?\b`)
+
+// runner is the platform, runtime and delegate selectors of
+// a stage, converted from the job runs-on labels.
+type runner struct {
+	platform *harness.Platform
+	runtime  *harness.Runtime
+	delegate []string
+}
+
+// convertRunsOn converts the job runs-on labels. GitHub
+// hosted and larger runners convert to the cloud runtime
+// with the runner platform and resource class. Self-hosted
+// runner labels convert to delegate selectors, or to the
+// kubernetes runtime, using the runner mapping.
+func (d *Converter) convertRunsOn(name string, src *github.RunsOn, ctx *context) *runner {
+	dst := &runner{
+		runtime: &harness.Runtime{
+			Type: "cloud",
+			Spec: &harness.RuntimeCloud{},
+		},
+	}
+	if src == nil || (src.Group == "" && len(src.Labels) == 0) {
+		return dst
+	}
+
+	platform := &harness.Platform{
+		Os:   harness.OSLinux.String(),
+		Arch: harness.ArchAmd64.String(),
+	}
+	dst.platform = platform
+
+	var size string
+	var selfHosted, hosted, kube bool
+	var custom []string
+	for _, label := range src.Labels {
+		switch l := strings.ToLower(label); {
+		case strings.Contains(l, "${{"):
+			ctx.report.Addf("job %q: runs-on %q is evaluated at runtime and is converted to a linux platform", name, label)
+		case l == "self-hosted":
+			selfHosted = true
+		case l == "linux":
+			platform.Os = harness.OSLinux.String()
+		case l == "windows":
+			platform.Os = harness.OSWindows.String()
+		case l == "macos":
+			platform.Os = harness.OSDarwin.String()
+		case l == "x64":
+			platform.Arch = harness.ArchAmd64.String()
+		case l == "arm64", l == "arm":
+			platform.Arch = harness.ArchArm64.String()
+		case d.runners[label] != "":
+			custom = append(custom, label)
+		default:
+			if os, arch, class, ok := hostedRunner(l); ok {
+				platform.Os, platform.Arch, size = os, arch, class
+				hosted = true
+			} else {
+				custom = append(custom, label)
+			}
+		}
+	}
+
+	// runner groups of larger runners are ignored, unless
+	// the group is mapped.
+	if src.Group != "" && (d.runners[src.Group] != "" || !hosted) {
+		custom = append([]string{src.Group}, custom...)
+	}
+
+	for _, label := range custom {
+		switch selector := d.runners[label]; selector {
+		case KubernetesRunner:
+			kube = true
+		case "":
+			ctx.report.Addf("job %q: self-hosted runner label %q is converted to a delegate selector", name, label)
+			dst.delegate = appendUnique(dst.delegate, label)
+		default:
+			dst.delegate = appendUnique(dst.delegate, selector)
+		}
+	}
+
+	switch {
+	case kube:
+		dst.runtime = &harness.Runtime{
+			Type: "kubernetes",
+			Spec: &harness.RuntimeKube{
+				Connector: d.kubeConnector,
+				Namespace: d.kubeNamespace,
+			},
+		}
+		if d.kubeConnector == "" {
+			ctx.report.Addf("job %q: kubernetes runtime requires a harness kubernetes connector", name)
+		}
+	case selfHosted || len(dst.delegate) != 0:
+		dst.runtime = &harness.Runtime{
+			Type: "machine",
+			Spec: &harness.RuntimeMachine{},
+		}
+		if len(dst.delegate) == 0 {
+			ctx.report.Addf("job %q: self-hosted runners without custom labels run on any delegate", name)
+		}
+	default:
+		dst.runtime.Spec = &harness.RuntimeCloud{Size: size}
+	}
+	return dst
+}
+
+// hostedRunner returns the platform and resource class of a
+// GitHub hosted or larger runner label.
+func hostedRunner(label string) (os, arch, size string, ok bool) {
+	arch = harness.ArchAmd64.String()
+	switch {
+	case strings.HasPrefix(label, "ubuntu-"):
+		os = harness.OSLinux.String()
+	case strings.HasPrefix(label, "windows-"):
+		os = harness.OSWindows.String()
+	case strings.HasPrefix(label, "macos-"):
+		os = harness.OSDarwin.String()
+		// macos 14 and later, and the xlarge runners, run
+		// on apple silicon.
+		switch {
+		case strings.HasSuffix(label, "-xlarge"):
+			arch = harness.ArchArm64.String()
+		case strings.HasSuffix(label, "-large"):
+		case strings.HasPrefix(label, "macos-latest"), !macosIntel(label):
+			arch = harness.ArchArm64.String()
+		}
+	case coresRe.MatchString(label):
+		// larger runners are named by the organization, so
+		// the platform is derived from the name.
+		os = harness.OSLinux.String()
+		if strings.Contains(label, "windows") {
+			os = harness.OSWindows.String()
+		}
+	default:
+		return "", "", "", false
+	}
+	if strings.HasSuffix(label, "-arm") || strings.Contains(label, "-arm64") {
+		arch = harness.ArchArm64.String()
+	}
+
+	switch {
+	case strings.HasSuffix(label, "-xlarge"):
+		size = "xlarge"
+	case strings.HasSuffix(label, "-large"):
+		size = "large"
+	}
+	if m := coresRe.FindStringSubmatch(label); m != nil {
+		cores, _ := strconv.Atoi(m[1])
+		size = resourceClass(cores)
+	}
+	return os, arch, size, true
+}
+
+// macosIntel returns true if the macos runner version runs
+// on intel.
+func macosIntel(label string) bool {
+	version := strings.SplitN(strings.TrimPrefix(label, "macos-"), "-", 2)[0]
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	return err == nil && major < 14
+}
+
+// resourceClass returns the harness cloud resource class
+// for the number of cores of a larger runner.
+func resourceClass(cores int) string {
+	switch {
+	case cores <= 4:
+		return ""
+	case cores <= 8:
+		return "large"
+	case cores <= 16:
+		return "xlarge"
+	default:
+		return "xxlarge"
+	}
+}
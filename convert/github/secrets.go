@@ -0,0 +1,85 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+
+	"github.com/hunain-avyka/Go-drone/internal/report"
+
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// githubToken is the name of the token secret that GitHub
+// creates for every workflow run.
+const githubToken = "GITHUB_TOKEN"
+
+// secretStore resolves github secret names to harness
+// secret identifiers.
+type secretStore struct {
+	org     map[string]bool
+	account map[string]bool
+}
+
+// newSecretStore returns a secret store. Secrets in the
+// org and account lists resolve to organization and account
+// scoped secrets. All other secrets resolve to project
+// scoped secrets.
+func newSecretStore(org, account []string) *secretStore {
+	s := &secretStore{
+		org:     map[string]bool{},
+		account: map[string]bool{},
+	}
+	for _, name := range org {
+		s.org[name] = true
+	}
+	for _, name := range account {
+		s.account[name] = true
+	}
+	return s
+}
+
+// expr returns the harness expression for the named github
+// secret.
+func (s *secretStore) expr(name string, r *report.Report) string {
+	id := name
+	switch {
+	case s.account[name]:
+		id = "account." + id
+	case s.org[name]:
+		id = "org." + id
+	}
+	if name == githubToken {
+		r.Addf("secret %s: harness does not create a github token, create harness secret %q from a github connector token", name, id)
+	}
+	return fmt.Sprintf("<+secrets.getValue(%q)>", id)
+}
+
+// variable returns the harness expression for the named
+// github configuration variable. Configuration variables
+// are not stored in the workflow, so they are converted to
+// pipeline inputs.
+func (ctx *context) variable(name string) string {
+	if ctx.inputs == nil {
+		ctx.inputs = map[string]*harness.Input{}
+	}
+	if ctx.inputs[name] == nil {
+		ctx.inputs[name] = &harness.Input{
+			Type:        "string",
+			Description: fmt.Sprintf("GitHub configuration variable %s", name),
+		}
+	}
+	return "<+inputs." + name + ">"
+}
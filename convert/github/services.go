@@ -0,0 +1,310 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/slug"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// defaultHealthRetries is the number of health checks the
+// wait step runs if the service does not set the retries.
+const defaultHealthRetries = 10
+
+// healthClients maps the clients used by common health
+// commands to the flag that sets the server host.
+var healthClients = map[string]string{
+	"pg_isready": "-h",
+	"redis-cli":  "-h",
+	"mysqladmin": "-h",
+	"mongosh":    "--host",
+	"mongo":      "--host",
+}
+
+// containerOptions is the docker create options of a job
+// container or service container.
+type containerOptions struct {
+	healthCmd      string
+	healthInterval time.Duration
+	healthRetries  int
+	healthStart    time.Duration
+	user           string
+	entrypoint     string
+	privileged     bool
+}
+
+// parseOptions parses the docker create options. It returns
+// the options that are not supported.
+func parseOptions(s string) (*containerOptions, []string) {
+	dst := new(containerOptions)
+	var unsupported []string
+	args := splitArgs(s)
+	for i := 0; i < len(args); i++ {
+		name, value := args[i], ""
+		hasValue := false
+		if j := strings.Index(name, "="); j != -1 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		next := func() string {
+			if hasValue {
+				return value
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch name {
+		case "--health-cmd":
+			dst.healthCmd = next()
+		case "--health-interval":
+			dst.healthInterval, _ = time.ParseDuration(next())
+		case "--health-retries":
+			dst.healthRetries, _ = strconv.Atoi(next())
+		case "--health-start-period":
+			dst.healthStart, _ = time.ParseDuration(next())
+		case "--health-timeout":
+			// the wait step checks the health until the
+			// retries are exhausted.
+			next()
+		case "--user", "-u":
+			dst.user = next()
+		case "--entrypoint":
+			dst.entrypoint = next()
+		case "--privileged":
+			dst.privileged = !hasValue || value == "true"
+		default:
+			// the values of unsupported options are not
+			// reported separately.
+			if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				name += " " + args[i+1]
+				i++
+			}
+			unsupported = append(unsupported, name)
+		}
+	}
+	return dst, unsupported
+}
+
+// splitArgs splits the string into arguments separated by
+// whitespace. Quoted arguments may contain whitespace.
+func splitArgs(s string) []string {
+	var args []string
+	var b strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			b.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			b.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args
+}
+
+// convertCredentials converts the container registry
+// credentials to a registry connector. Images on docker hub
+// use the dockerhub connector, if configured. Otherwise a
+// connector must be created for the registry.
+func (d *Converter) convertCredentials(image string, src *github.Credentials, ctx *context) string {
+	if src == nil {
+		return ""
+	}
+	registry := imageRegistry(image)
+	if registry == "docker.io" && d.dockerhubConn != "" {
+		return d.dockerhubConn
+	}
+	conn := slug.Create(registry)
+	ctx.report.Addf("image %q: create a docker registry connector %q for %s with username %s and password %s",
+		image, conn, registry, convertExprs(src.Username, false, ctx), convertExprs(src.Password, false, ctx))
+	return conn
+}
+
+// imageRegistry returns the registry host of the image.
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return "docker.io"
+}
+
+// convertContainer applies the job container to the run
+// step. The container environment is merged into the step
+// environment, and step variables take precedence.
+func (d *Converter) convertContainer(dst *harness.StepExec, src *github.Container, ctx *context) {
+	dst.Image = convertExprs(src.Image, false, ctx)
+	dst.Connector = d.convertCredentials(src.Image, src.Credentials, ctx)
+	dst.Mount = convertMounts(src.Volumes)
+	if len(src.Env) != 0 {
+		envs := convertEnv(src.Env, ctx)
+		for k, v := range dst.Envs {
+			envs[k] = v
+		}
+		dst.Envs = envs
+	}
+	if len(src.Ports) != 0 {
+		ctx.report.Addf("image %q: job container ports are not supported", src.Image)
+	}
+
+	opts, unsupported := parseOptions(src.Options)
+	dst.User = opts.user
+	dst.Privileged = opts.privileged
+	dst.Entrypoint = opts.entrypoint
+	for _, opt := range unsupported {
+		ctx.report.Addf("image %q: container option %q is not supported", src.Image, opt)
+	}
+}
+
+// convertServices converts the service containers to
+// background steps. Services with a health check are
+// followed by a step that waits until the service is
+// healthy.
+func (d *Converter) convertServices(src map[string]*github.Service, ctx *context) []*harness.Step {
+	var names []string
+	for name, service := range src {
+		if service != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var steps, waits []*harness.Step
+	for _, name := range names {
+		service := src[name]
+		opts, unsupported := parseOptions(strings.Join(service.Options, " "))
+		for _, opt := range unsupported {
+			ctx.report.Addf("service %q: container option %q is not supported", name, opt)
+		}
+		if len(service.Networks) != 0 {
+			ctx.report.Addf("service %q: networks are not supported", name)
+		}
+		steps = append(steps, &harness.Step{
+			Name: name,
+			Type: "background",
+			Spec: &harness.StepBackground{
+				Image:      convertExprs(service.Image, false, ctx),
+				Connector:  d.convertCredentials(service.Image, service.Credentials, ctx),
+				Envs:       convertEnv(service.Env, ctx),
+				Mount:      convertMounts(service.Volumes),
+				Ports:      service.Ports,
+				User:       opts.user,
+				Privileged: opts.privileged,
+				Entrypoint: opts.entrypoint,
+			},
+		})
+		if opts.healthCmd != "" {
+			if wait := d.convertHealthCheck(name, service, opts, ctx); wait != nil {
+				waits = append(waits, wait)
+			}
+		}
+	}
+	return append(steps, waits...)
+}
+
+// convertHealthCheck returns a step that runs the service
+// health command, using the service image, until the
+// service is healthy. The step runs in a separate container,
+// so the command must connect to the service host. It
+// returns nil if the host cannot be set.
+func (d *Converter) convertHealthCheck(name string, src *github.Service, opts *containerOptions, ctx *context) *harness.Step {
+	cmd, ok := healthCommand(opts.healthCmd, name)
+	if !ok {
+		ctx.report.Addf("service %q: the health check %q cannot connect to the service from the wait step, add a step that waits for the service", name, opts.healthCmd)
+		return nil
+	}
+	retries := opts.healthRetries
+	if retries == 0 {
+		retries = defaultHealthRetries
+	}
+	interval := opts.healthInterval
+	if interval == 0 {
+		interval = time.Second * 30
+	}
+
+	var b strings.Builder
+	if opts.healthStart != 0 {
+		fmt.Fprintf(&b, "sleep %d\n", int(opts.healthStart.Seconds()))
+	}
+	fmt.Fprintf(&b, "for i in $(seq 1 %d); do\n", retries)
+	fmt.Fprintf(&b, "  %s && exit 0\n", convertExprs(cmd, true, ctx))
+	fmt.Fprintf(&b, "  if [ $i -lt %d ]; then sleep %d; fi\n", retries, int(interval.Seconds()))
+	b.WriteString("done\n")
+	fmt.Fprintf(&b, "echo \"service %s is not healthy\"\n", name)
+	b.WriteString("exit 1\n")
+
+	return &harness.Step{
+		Name: "wait for " + name,
+		Type: "script",
+		Spec: &harness.StepExec{
+			Image:     convertExprs(src.Image, false, ctx),
+			Connector: d.convertCredentials(src.Image, src.Credentials, ctx),
+			Envs:      convertEnv(src.Env, ctx),
+			Run:       b.String(),
+		},
+	}
+}
+
+// healthCommand returns the health command that connects to
+// the service host. Local addresses are replaced with the
+// host, and the host flag is added to known clients. It
+// returns false if the command does not connect to the host.
+func healthCommand(cmd, host string) (string, bool) {
+	for _, local := range []string{"localhost", "127.0.0.1"} {
+		if strings.Contains(cmd, local) {
+			return strings.ReplaceAll(cmd, local, host), true
+		}
+	}
+	cmd = strings.TrimSpace(cmd)
+	args := strings.Fields(cmd)
+	if len(args) == 0 {
+		return "", false
+	}
+	flag, ok := healthClients[args[0]]
+	if !ok {
+		return "", false
+	}
+	for _, arg := range args[1:] {
+		if arg == flag || arg == "--host" || strings.HasPrefix(arg, "--host=") {
+			return cmd, true
+		}
+	}
+	return args[0] + " " + flag + " " + host + strings.TrimPrefix(cmd, args[0]), true
+}
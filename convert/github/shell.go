@@ -0,0 +1,151 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"strconv"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// shells maps the github shells to the harness step shells.
+var shells = map[string]string{
+	"bash":       "bash",
+	"sh":         "sh",
+	"pwsh":       "pwsh",
+	"powershell": "powershell",
+	"python":     "python",
+}
+
+// cmdShell is the shell template github uses to run cmd
+// scripts.
+const cmdShell = `cmd /D /E:ON /V:OFF /S /C "CALL {0}"`
+
+// scriptDelimiter is the heredoc delimiter of the scripts
+// that are wrapped to run with a custom shell.
+const scriptDelimiter = "GITHUB_STEP_SCRIPT"
+
+// mergeDefaults returns the workflow defaults merged with
+// the job defaults. Job defaults take precedence.
+func mergeDefaults(workflow, job *github.Defaults) *github.Defaults {
+	if workflow == nil || workflow.Run == nil {
+		return job
+	}
+	if job == nil || job.Run == nil {
+		return workflow
+	}
+	run := *workflow.Run
+	if job.Run.Shell != "" {
+		run.Shell = job.Run.Shell
+	}
+	if job.Run.WorkingDir != "" {
+		run.WorkingDir = job.Run.WorkingDir
+	}
+	return &github.Defaults{Run: &run}
+}
+
+// withDefaults returns the run step with the shell and
+// working directory of the stage defaults, if the step
+// does not set them.
+func withDefaults(src *github.Step, ctx *context) *github.Step {
+	if src.Run == "" || ctx.stage == nil || ctx.stage.defaults == nil || ctx.stage.defaults.Run == nil {
+		return src
+	}
+	run := ctx.stage.defaults.Run
+	dst := *src
+	if dst.Shell == "" {
+		dst.Shell = run.Shell
+	}
+	if dst.WorkingDir == "" {
+		dst.WorkingDir = run.WorkingDir
+	}
+	return &dst
+}
+
+// isWindows returns true if the stage runs on windows.
+func isWindows(ctx *context) bool {
+	return ctx.stage != nil && ctx.stage.platform != nil &&
+		ctx.stage.platform.Os == harness.OSWindows.String()
+}
+
+// isPosixShell returns true if the step script runs in a
+// posix shell. The default shell is bash, or pwsh on
+// windows.
+func isPosixShell(src *github.Step, ctx *context) bool {
+	switch src.Shell {
+	case "":
+		return !isWindows(ctx)
+	case "bash", "sh":
+		return true
+	}
+	return false
+}
+
+// convertShell sets the step shell and working directory.
+// Scripts that run with cmd or a custom shell template are
+// written to a file that is passed to the shell.
+func convertShell(dst *harness.StepExec, src *github.Step, ctx *context) {
+	shell := src.Shell
+	switch {
+	case shell == "":
+	case shells[shell] != "":
+		dst.Shell = shells[shell]
+	case shell == "cmd":
+		wrapScript(dst, cmdShell, ".cmd", ctx)
+	case strings.Contains(shell, "{0}"):
+		wrapScript(dst, shell, "", ctx)
+	default:
+		ctx.report.Addf("step %q: shell %q is not supported, use a shell template with {0}", stepName(src), shell)
+	}
+
+	if src.WorkingDir == "" {
+		return
+	}
+	dir := convertExprs(src.WorkingDir, false, ctx)
+	if dst.Shell == "python" {
+		dst.Run = "import os\nos.chdir(" + strconv.Quote(dir) + ")\n" + dst.Run
+	} else {
+		dst.Run = "cd " + quoteDir(dir) + "\n" + dst.Run
+	}
+}
+
+// wrapScript writes the script to a temporary file, with
+// the extension on windows, and runs the shell template
+// with the file path in place of {0}.
+func wrapScript(dst *harness.StepExec, template, ext string, ctx *context) {
+	script := strings.TrimSuffix(dst.Run, "\n")
+	if isWindows(ctx) {
+		dst.Shell = "powershell"
+		dst.Run = "$script = [System.IO.Path]::ChangeExtension([System.IO.Path]::GetTempFileName(), \"" + ext + "\")\n" +
+			"@'\n" + script + "\n'@ | Set-Content -Path $script\n" +
+			strings.ReplaceAll(template, "{0}", "$script") + "\n"
+		return
+	}
+	dst.Shell = "sh"
+	dst.Run = "script=$(mktemp)\n" +
+		"cat > \"$script\" <<'" + scriptDelimiter + "'\n" + script + "\n" + scriptDelimiter + "\n" +
+		strings.ReplaceAll(template, "{0}", "\"$script\"") + "\n"
+}
+
+// quoteDir quotes the directory if it contains characters
+// that the shell interprets.
+func quoteDir(dir string) string {
+	if strings.ContainsAny(dir, " \t'\"$&;|()*?") {
+		return strconv.Quote(dir)
+	}
+	return dir
+}
@@ -0,0 +1,390 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	github "github.com/hunain-avyka/Go-drone/convert/github/yaml"
+	v0 "github.com/hunain-avyka/Go-drone/convert/harness/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/store"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// pullRequestActions maps the pull request activity types
+// to the harness pull request trigger actions.
+var pullRequestActions = map[string]string{
+	"closed":           "Close",
+	"edited":           "Edit",
+	"labeled":          "Label",
+	"opened":           "Open",
+	"ready_for_review": "ReadyForReview",
+	"reopened":         "Reopen",
+	"synchronize":      "Synchronize",
+	"unlabeled":        "Unlabel",
+}
+
+// defaultPullRequestTypes are the activity types that run
+// the workflow if the types are not specified.
+var defaultPullRequestTypes = []string{"opened", "synchronize", "reopened"}
+
+// convertInputs converts the workflow_dispatch and
+// workflow_call inputs to pipeline inputs.
+func convertInputs(src *github.Pipeline, ctx *context) {
+	if src.On == nil {
+		return
+	}
+	inputs := workflowCallInputs(src)
+	if src.On.WorkflowDispatch != nil {
+		if inputs == nil {
+			inputs = map[string]*github.Input{}
+		}
+		for key, input := range src.On.WorkflowDispatch.Inputs {
+			inputs[key] = input
+		}
+	}
+	for key, input := range inputs {
+		if ctx.inputs == nil {
+			ctx.inputs = map[string]*harness.Input{}
+		}
+		ctx.inputs[key] = convertInput(key, input, ctx)
+	}
+}
+
+// convertInput converts a workflow input to a pipeline
+// input.
+func convertInput(name string, src *github.Input, ctx *context) *harness.Input {
+	dst := &harness.Input{Type: "string"}
+	if src == nil {
+		return dst
+	}
+	dst.Description = src.Description
+	dst.Default = src.Default
+	dst.Required = src.Required
+	switch src.Type {
+	case "boolean", "number":
+		dst.Type = src.Type
+	case "choice":
+		if options, ok := src.Options.([]interface{}); ok {
+			for _, option := range options {
+				dst.Enum = append(dst.Enum, fmt.Sprint(option))
+			}
+		}
+	case "environment":
+		ctx.report.Addf("input %q: environment inputs are converted to string inputs", name)
+	}
+	return dst
+}
+
+// convertTriggers converts the workflow events to harness
+// triggers. Push and pull request events convert to github
+// webhook triggers, schedules convert to cron triggers, and
+// workflow_run events convert to custom webhook triggers
+// that chain the pipelines.
+func convertTriggers(src *github.On, ctx *context) []*v0.TriggerConfig {
+	if src == nil {
+		return nil
+	}
+	ids := store.New()
+	var triggers []*v0.TriggerConfig
+	add := func(name string, source *v0.TriggerSource) {
+		id := ids.Generate(name)
+		triggers = append(triggers, &v0.TriggerConfig{
+			Trigger: &v0.Trigger{
+				ID:      id,
+				Name:    id,
+				Enabled: true,
+				Source:  source,
+			},
+		})
+	}
+
+	if push := src.Push; push != nil {
+		paths := pathConditions(push.Paths, push.PathsIgnore)
+		hasBranches := len(push.Branches) != 0 || len(push.BranchesIgnore) != 0
+		hasTags := len(push.Tags) != 0 || len(push.TagsIgnore) != 0
+
+		// a push event with branch or tag filters only runs
+		// for the filtered refs. the branch and tag filters
+		// convert to separate triggers, since the trigger
+		// conditions must all match.
+		if hasBranches || !hasTags {
+			var conds []*v0.TriggerCondition
+			if hasBranches {
+				conds = append(conds, refCondition("targetBranch", push.Branches, push.BranchesIgnore, ""))
+			}
+			add("push", githubTrigger("Push", append(conds, paths...), nil))
+		}
+		if hasTags {
+			conds := []*v0.TriggerCondition{
+				refCondition("<+trigger.payload.ref>", push.Tags, push.TagsIgnore, "refs/tags/"),
+			}
+			add("push_tags", githubTrigger("Push", append(conds, paths...), nil))
+		}
+	}
+
+	if pr := src.PullRequest; pr != nil {
+		var conds []*v0.TriggerCondition
+		if len(pr.Branches) != 0 || len(pr.BranchesIgnore) != 0 {
+			conds = append(conds, refCondition("targetBranch", pr.Branches, pr.BranchesIgnore, ""))
+		}
+		conds = append(conds, pathConditions(pr.Paths, pr.PathsIgnore)...)
+		add("pull_request", githubTrigger("PullRequest", conds, pullRequestTriggerActions(pr.Types, ctx)))
+	}
+
+	if pr := src.PullRequestTarget; pr != nil {
+		ctx.report.Addf("pull_request_target: converted to a pull request trigger, which runs the pipeline from the pull request branch")
+		var conds []*v0.TriggerCondition
+		if len(pr.Branches) != 0 || len(pr.BranchesIgnore) != 0 {
+			conds = append(conds, refCondition("targetBranch", pr.Branches, pr.BranchesIgnore, ""))
+		}
+		add("pull_request_target", githubTrigger("PullRequest", conds, pullRequestTriggerActions(pr.Types, ctx)))
+	}
+
+	if src.Schedule != nil {
+		for _, item := range src.Schedule.Items {
+			if item == nil || item.Cron == "" {
+				continue
+			}
+			add("schedule", &v0.TriggerSource{
+				Type: "Scheduled",
+				Spec: &v0.ScheduledSource{
+					Type: "Cron",
+					Spec: &v0.CronSpec{
+						Type:       "UNIX",
+						Expression: item.Cron,
+					},
+				},
+			})
+		}
+	}
+
+	if run := src.WorkflowRun; run != nil {
+		add("workflow_run", convertWorkflowRun(run, ctx))
+	}
+
+	return triggers
+}
+
+// convertWorkflowRun converts the workflow_run event to a
+// custom webhook trigger. The upstream pipelines invoke
+// the webhook when they complete, with the pipeline name
+// and status in the payload.
+func convertWorkflowRun(src *github.WorkflowRun, ctx *context) *v0.TriggerSource {
+	spec := new(v0.WebhookSpec)
+	workflows := workflowPipelines(src.Workflows, ctx)
+	if len(workflows) != 0 {
+		spec.PayloadConditions = append(spec.PayloadConditions, &v0.TriggerCondition{
+			Key:      "<+trigger.payload.pipeline>",
+			Operator: "In",
+			Value:    strings.Join(workflows, ", "),
+		})
+	}
+	if len(src.Branches) != 0 || len(src.BranchesIgnore) != 0 {
+		spec.PayloadConditions = append(spec.PayloadConditions, refCondition("<+trigger.payload.branch>", src.Branches, src.BranchesIgnore, ""))
+	}
+	for _, t := range src.Types {
+		if t != "completed" {
+			ctx.report.Addf("workflow_run: activity type %q is not supported, the trigger runs when the upstream pipeline completes", t)
+		}
+	}
+	ctx.report.Addf("workflow_run: invoke the custom webhook trigger when the %s pipeline completes, with the pipeline and branch in the payload", strings.Join(workflows, ", "))
+	return &v0.TriggerSource{
+		Type: "Webhook",
+		Spec: &v0.WebhookSource{
+			Type: "Custom",
+			Spec: spec,
+		},
+	}
+}
+
+// workflowPipelines returns the pipeline identifiers of
+// the workflow names, if the workflows are converted with
+// the workflow directory. Otherwise the workflow names are
+// returned.
+func workflowPipelines(names []string, ctx *context) []string {
+	if ctx.workflows == nil {
+		return names
+	}
+	var out []string
+	for _, name := range names {
+		if id, ok := ctx.workflows[name]; ok {
+			out = append(out, id)
+		} else {
+			ctx.report.Addf("workflow_run: workflow %q is not defined in the workflow directory", name)
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// githubTrigger returns a github webhook trigger source.
+func githubTrigger(event string, conds []*v0.TriggerCondition, actions []string) *v0.TriggerSource {
+	return &v0.TriggerSource{
+		Type: "Webhook",
+		Spec: &v0.WebhookSource{
+			Type: "Github",
+			Spec: &v0.WebhookEvent{
+				Type: event,
+				Spec: &v0.WebhookSpec{
+					PayloadConditions: conds,
+					Actions:           actions,
+				},
+			},
+		},
+	}
+}
+
+// pullRequestTriggerActions converts the pull request
+// activity types to trigger actions.
+func pullRequestTriggerActions(types []string, ctx *context) []string {
+	if len(types) == 0 {
+		types = defaultPullRequestTypes
+	}
+	var actions []string
+	for _, t := range types {
+		if action, ok := pullRequestActions[t]; ok {
+			actions = append(actions, action)
+		} else {
+			ctx.report.Addf("pull_request: activity type %q is not supported", t)
+		}
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// refCondition returns the condition that matches the refs
+// filtered by the patterns. Lists of names convert to the
+// In and NotIn operators, and patterns convert to regular
+// expressions.
+func refCondition(key string, patterns, ignore []string, prefix string) *v0.TriggerCondition {
+	include, exclude := splitPatterns(patterns, ignore)
+	if prefix == "" && isLiteral(include) && isLiteral(exclude) {
+		switch {
+		case len(exclude) == 0:
+			return &v0.TriggerCondition{Key: key, Operator: "In", Value: strings.Join(include, ", ")}
+		case len(include) == 0:
+			return &v0.TriggerCondition{Key: key, Operator: "NotIn", Value: strings.Join(exclude, ", ")}
+		}
+	}
+	return &v0.TriggerCondition{
+		Key:      key,
+		Operator: "Regex",
+		Value:    patternRegex(include, exclude, prefix),
+	}
+}
+
+// pathConditions returns the changed files conditions. A
+// paths-ignore filter matches if a changed file is not
+// ignored.
+func pathConditions(paths, ignore []string) []*v0.TriggerCondition {
+	include, exclude := splitPatterns(paths, ignore)
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	return []*v0.TriggerCondition{{
+		Key:      "changedFiles",
+		Operator: "Regex",
+		Value:    patternRegex(include, exclude, ""),
+	}}
+}
+
+// splitPatterns returns the included and excluded patterns.
+// Patterns prefixed with ! are excluded.
+func splitPatterns(patterns, ignore []string) ([]string, []string) {
+	var include []string
+	exclude := append([]string(nil), ignore...)
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			exclude = append(exclude, strings.TrimPrefix(pattern, "!"))
+		} else {
+			include = append(include, pattern)
+		}
+	}
+	return include, exclude
+}
+
+// isLiteral returns true if the patterns are names without
+// special characters.
+func isLiteral(patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?+[]!") {
+			return false
+		}
+	}
+	return true
+}
+
+// patternRegex returns the regular expression that matches
+// the included patterns and none of the excluded patterns.
+func patternRegex(include, exclude []string, prefix string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	if len(exclude) != 0 {
+		fmt.Fprintf(&b, "(?!%s(?:%s)$)", regexp.QuoteMeta(prefix), globsRegex(exclude))
+	}
+	b.WriteString(regexp.QuoteMeta(prefix))
+	if len(include) == 0 {
+		b.WriteString(".*")
+	} else {
+		fmt.Fprintf(&b, "(?:%s)", globsRegex(include))
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// globsRegex returns the alternation of the glob patterns.
+func globsRegex(patterns []string) string {
+	parts := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		parts[i] = globRegex(pattern)
+	}
+	return strings.Join(parts, "|")
+}
+
+// globRegex converts a github filter pattern to a regular
+// expression. The * character matches any characters
+// except /, and ** matches any characters.
+// https://docs.github.com/en/actions/using-workflows/workflow-syntax-for-github-actions#filter-pattern-cheat-sheet
+func globRegex(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?', '+':
+			b.WriteByte(c)
+		case '[':
+			if j := strings.IndexByte(pattern[i:], ']'); j != -1 {
+				b.WriteString(pattern[i : i+j+1])
+				i += j
+			} else {
+				b.WriteString(`\[`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Action defines the action metadata file, action.yml.
+	Action struct {
+		Name        string                   `yaml:"name,omitempty"`
+		Description string                   `yaml:"description,omitempty"`
+		Inputs      map[string]*ActionInput  `yaml:"inputs,omitempty"`
+		Outputs     map[string]*ActionOutput `yaml:"outputs,omitempty"`
+		Runs        *ActionRuns              `yaml:"runs,omitempty"`
+	}
+
+	ActionInput struct {
+		Default     string `yaml:"default,omitempty"`
+		Description string `yaml:"description,omitempty"`
+		Required    bool   `yaml:"required,omitempty"`
+	}
+
+	ActionOutput struct {
+		Description string `yaml:"description,omitempty"`
+		Value       string `yaml:"value,omitempty"`
+	}
+
+	ActionRuns struct {
+		Using string `yaml:"using,omitempty"`
+
+		// javascript actions
+		Main string `yaml:"main,omitempty"`
+		Pre  string `yaml:"pre,omitempty"`
+		Post string `yaml:"post,omitempty"`
+
+		// composite actions
+		Steps []*Step `yaml:"steps,omitempty"`
+
+		// docker actions
+		Image          string            `yaml:"image,omitempty"`
+		Entrypoint     string            `yaml:"entrypoint,omitempty"`
+		PreEntrypoint  string            `yaml:"pre-entrypoint,omitempty"`
+		PostEntrypoint string            `yaml:"post-entrypoint,omitempty"`
+		Args           []string          `yaml:"args,omitempty"`
+		Env            map[string]string `yaml:"env,omitempty"`
+	}
+)
+
+// ParseAction parses the action metadata from io.Reader r.
+func ParseAction(r io.Reader) (*Action, error) {
+	out := new(Action)
+	dec := yaml.NewDecoder(r)
+	err := dec.Decode(out)
+	return out, err
+}
+
+// ParseActionFile parses the action metadata from path p.
+func ParseActionFile(p string) (*Action, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAction(f)
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseActionFile(t *testing.T) {
+	got, err := ParseActionFile("testdata/action/composite.yml")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := &Action{
+		Name:        "setup",
+		Description: "installs the toolchain",
+		Inputs: map[string]*ActionInput{
+			"version": {Description: "toolchain version", Default: "1.21"},
+		},
+		Runs: &ActionRuns{
+			Using: "composite",
+			Steps: []*Step{
+				{Run: "echo ${{ inputs.version }}", Shell: "bash"},
+			},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected parsing result")
+		t.Log(diff)
+	}
+}
+
+func TestParseActionFile_Error(t *testing.T) {
+	_, err := ParseActionFile("testdata/action/missing.yml")
+	if err == nil {
+		t.Errorf("Expect error when file does not exist")
+	}
+}
@@ -0,0 +1,104 @@
+package yaml
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Matrix struct {
+	Exclude []map[string]interface{} `yaml:"exclude,omitempty"`
+	Include []map[string]interface{} `yaml:"include,omitempty"`
+	Matrix  map[string][]string      `yaml:",inline"`
+
+	// Expression is the expression that evaluates to the
+	// matrix, such as ${{ fromJSON(needs.setup.outputs.matrix) }}
+	Expression string `yaml:"-"`
+
+	// Expressions maps the axes, include and exclude to the
+	// expressions that evaluate to their values.
+	Expressions map[string]string `yaml:"-"`
+}
+
+// UnmarshalYAML implements the unmarshal interface.
+func (v *Matrix) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var out1 string
+	var out2 map[string]interface{}
+
+	if err := unmarshal(&out1); err == nil {
+		v.Expression = out1
+		return nil
+	}
+	if err := unmarshal(&out2); err != nil {
+		return errors.New("failed to unmarshal matrix")
+	}
+	for key, value := range out2 {
+		if s, ok := value.(string); ok {
+			if v.Expressions == nil {
+				v.Expressions = map[string]string{}
+			}
+			v.Expressions[key] = s
+			continue
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("failed to unmarshal matrix %s", key)
+		}
+		switch key {
+		case "include", "exclude":
+			maps, err := toMaps(items)
+			if err != nil {
+				return err
+			}
+			if key == "include" {
+				v.Include = maps
+			} else {
+				v.Exclude = maps
+			}
+		default:
+			parts, err := toStrings(items)
+			if err != nil {
+				return err
+			}
+			if v.Matrix == nil {
+				v.Matrix = map[string][]string{}
+			}
+			v.Matrix[key] = parts
+		}
+	}
+	return nil
+}
+
+// MarshalYAML implements the marshal interface.
+func (v *Matrix) MarshalYAML() (interface{}, error) {
+	if v.Expression != "" {
+		return v.Expression, nil
+	}
+	out := map[string]interface{}{}
+	for key, value := range v.Matrix {
+		out[key] = value
+	}
+	for key, value := range v.Expressions {
+		out[key] = value
+	}
+	if v.Include != nil {
+		out["include"] = v.Include
+	}
+	if v.Exclude != nil {
+		out["exclude"] = v.Exclude
+	}
+	return out, nil
+}
+
+// helper function converts a slice of interfaces
+// to a slice of maps.
+func toMaps(s []interface{}) ([]map[string]interface{}, error) {
+	var r []map[string]interface{}
+	for _, v := range s {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot unmarshal %v of type %T into a map value", v, v)
+		}
+		r = append(r, m)
+	}
+	return r, nil
+}
@@ -111,6 +111,17 @@ func (v *On) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}{}
 	if err := unmarshal(&out3); err == nil {
 		*v = out3
+		// events without configuration, such as
+		// workflow_call with an empty value, are set
+		// with the default configuration.
+		var events map[string]interface{}
+		if err := unmarshal(&events); err == nil {
+			for event, value := range events {
+				if value == nil {
+					v.setEvent(event)
+				}
+			}
+		}
 		return nil
 	}
 
@@ -57,6 +57,19 @@ func TestOnConditions(t *testing.T) {
 			},
 		},
 		//
+		// test object with empty events
+		//
+		{
+			yaml: "pull_request:\nworkflow_call:\npush: { branches: [ main ] }",
+			want: On{
+				PullRequest:  &PullRequest{},
+				WorkflowCall: &WorkflowCall{},
+				Push: &Push{
+					Branches: []string{"main"},
+				},
+			},
+		},
+		//
 		// test individual keywords to ensure non-nil structs
 		// and default event types
 		//
@@ -59,7 +59,7 @@ type (
 		Needs         Stringorslice       `yaml:"needs,omitempty"`
 		Outputs       map[string]string   `yaml:"outputs,omitempty"`
 		Permissions   *Permissions        `yaml:"permissions,omitempty"`
-		RunsOn        string              `yaml:"runs-on,omitempty"`
+		RunsOn        *RunsOn             `yaml:"runs-on,omitempty"`
 		Secrets       *Secrets            `yaml:"secrets,omitempty"`
 		Services      map[string]*Service `yaml:"services,omitempty"`
 		Steps         []*Step             `yaml:"steps,omitempty"`
@@ -69,12 +69,6 @@ type (
 		With          map[string]string   `yaml:"with,omitempty"`
 	}
 
-	Matrix struct {
-		Exclude []map[string]interface{} `yaml:"exclude,omitempty"`
-		Include []map[string]interface{} `yaml:"include,omitempty"`
-		Matrix  map[string][]string      `yaml:",inline"`
-	}
-
 	PullRequest struct {
 		Branches        []string `yaml:"branches,omitempty"`
 		BranchesIgnore  []string `yaml:"branches-ignore,omitempty"`
@@ -111,7 +105,7 @@ type (
 		Env         map[string]string `yaml:"env,omitempty"`
 		Image       string            `yaml:"image,omitempty"`
 		Networks    []string          `yaml:"networks,omitempty"`
-		Options     []string          `yaml:"options,omitempty"`
+		Options     Stringorslice     `yaml:"options,omitempty"`
 		Ports       []string          `yaml:"ports,omitempty"`
 		Volumes     []string          `yaml:"volumes,omitempty"`
 		Credentials *Credentials      `yaml:"credentials,omitempty"`
@@ -120,17 +114,20 @@ type (
 	Step struct {
 		ContinueOnErr bool                   `yaml:"continue-on-error,omitempty"`
 		Env           map[string]string      `yaml:"env,omitempty"`
+		ID            string                 `yaml:"id,omitempty"`
 		If            string                 `yaml:"if,omitempty"`
 		Name          string                 `yaml:"name,omitempty"`
 		Run           string                 `yaml:"run,omitempty"`
+		Shell         string                 `yaml:"shell,omitempty"`
 		Timeout       int                    `yaml:"timeout-minutes,omitempty"`
 		With          map[string]interface{} `yaml:"with,omitempty"`
 		Uses          string                 `yaml:"uses,omitempty"`
+		WorkingDir    string                 `yaml:"working-directory,omitempty"`
 	}
 
 	Strategy struct {
 		Matrix      *Matrix `yaml:"matrix,omitempty"`
-		FailFast    bool    `yaml:"fail-fast,omitempty"`
+		FailFast    *bool   `yaml:"fail-fast,omitempty"`
 		MaxParallel int     `yaml:"max-parallel,omitempty"`
 	}
 
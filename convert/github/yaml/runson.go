@@ -0,0 +1,58 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import "errors"
+
+// RunsOn defines the runner of a job, which is a label, a
+// list of labels, or a runner group with optional labels.
+type RunsOn struct {
+	Group  string        `yaml:"group,omitempty"`
+	Labels Stringorslice `yaml:"labels,omitempty"`
+}
+
+// UnmarshalYAML implements the unmarshal interface.
+func (v *RunsOn) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var out1 Stringorslice
+	var out2 = struct {
+		Group  string        `yaml:"group,omitempty"`
+		Labels Stringorslice `yaml:"labels,omitempty"`
+	}{}
+	if err := unmarshal(&out1); err == nil {
+		v.Labels = out1
+		return nil
+	}
+	if err := unmarshal(&out2); err == nil {
+		v.Group = out2.Group
+		v.Labels = out2.Labels
+		return nil
+	}
+	return errors.New("failed to unmarshal runs-on")
+}
+
+// MarshalYAML implements the marshal interface.
+func (v *RunsOn) MarshalYAML() (interface{}, error) {
+	switch {
+	case v.Group != "":
+		return struct {
+			Group  string        `yaml:"group,omitempty"`
+			Labels Stringorslice `yaml:"labels,omitempty"`
+		}{v.Group, v.Labels}, nil
+	case len(v.Labels) == 1:
+		return v.Labels[0], nil
+	default:
+		return []string(v.Labels), nil
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRunsOn(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want RunsOn
+	}{
+		// string value
+		{
+			yaml: `ubuntu-latest`,
+			want: RunsOn{
+				Labels: Stringorslice{"ubuntu-latest"},
+			},
+		},
+		// list value
+		{
+			yaml: `[self-hosted, linux, ARM64]`,
+			want: RunsOn{
+				Labels: Stringorslice{"self-hosted", "linux", "ARM64"},
+			},
+		},
+		// group value
+		{
+			yaml: `
+group: ubuntu-runners
+labels: ubuntu-20.04-16core
+`,
+			want: RunsOn{
+				Group:  "ubuntu-runners",
+				Labels: Stringorslice{"ubuntu-20.04-16core"},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		got := new(RunsOn)
+		if err := yaml.Unmarshal([]byte(test.yaml), got); err != nil {
+			t.Log(test.yaml)
+			t.Error(err)
+			return
+		}
+		if diff := cmp.Diff(got, &test.want); diff != "" {
+			t.Log(test.yaml)
+			t.Errorf("Unexpected parsing results for test %v", i)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestRunsOn_Error(t *testing.T) {
+	err := yaml.Unmarshal([]byte("[[]]"), new(RunsOn))
+	if err == nil || err.Error() != "failed to unmarshal runs-on" {
+		t.Errorf("Expect error, got %s", err)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -45,6 +46,10 @@ type Converter struct {
 	kubeNamespace string
 	kubeConnector string
 	dockerhubConn string
+	root          string
+	projects      string
+	templates     string
+	fetcher       Fetcher
 	identifiers   *store.Identifiers
 
 	// config *gitlab.Pipeline
@@ -82,7 +87,22 @@ func New(options ...Option) *Converter {
 
 // Convert downgrades a v1 pipeline.
 func (d *Converter) Convert(r io.Reader) ([]byte, error) {
-	src, err := gitlab.Parse(r)
+	return d.convertReader(r, ".gitlab-ci.yml", d.root)
+}
+
+// convertReader resolves the includes of the pipeline
+// configuration, relative to the root, and converts the
+// pipeline.
+func (d *Converter) convertReader(r io.Reader, name, root string) ([]byte, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err = d.resolveIncludes(b, name, root)
+	if err != nil {
+		return nil, err
+	}
+	src, err := gitlab.ParseBytes(b)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +132,15 @@ func (d *Converter) ConvertFile(p string) ([]byte, error) {
 		return nil, err
 	}
 	defer f.Close()
-	return d.Convert(f)
+
+	// local includes are resolved relative to the
+	// directory of the file, unless the repository root
+	// is configured.
+	root := d.root
+	if root == "" {
+		root = filepath.Dir(p)
+	}
+	return d.convertReader(f, filepath.Clean(p), root)
 }
 
 // converts converts a GitLab pipeline to a Harness pipeline.
@@ -128,131 +156,24 @@ func (d *Converter) convert(ctx *context) ([]byte, error) {
 		Spec:    dst,
 	}
 
-	cacheFound := false
-
-	// TODO handle includes
-	// src.Include
-
 	if ctx.config.Workflow != nil {
 		// TODO pipeline.name removed from spec
 		// dst.Name = ctx.config.Workflow.Name
 	}
 
-	// create the harness stage.
-	dstStage := &harness.Stage{
-		Name: "test",
-		Type: "ci",
-		// When: convertCond(from.Trigger),
-		Spec: &harness.StageCI{
-			// Delegate: convertNode(from.Node),
-			Envs: convertVariables(ctx.config.Variables),
-			// Platform: convertPlatform(from.Platform),
-			// Runtime:  convertRuntime(from),
-			Steps: make([]*harness.Step, 0), // Initialize the Steps slice
-		},
+	jobs, err := expandJobs(ctx)
+	if err != nil {
+		return nil, err
 	}
-	dst.Stages = append(dst.Stages, dstStage)
-
 	var jobKeys []string
-	for jobKey := range ctx.config.Jobs {
+	for jobKey := range jobs {
 		jobKeys = append(jobKeys, jobKey)
 	}
 	sort.Strings(jobKeys)
 
-	stages := ctx.config.Stages
-	stagesLength := len(stages)
-	if stagesLength == 0 {
-		stages = []string{".pre", "build", "test", "deploy", ".post"} // stages don't have to be declared for valid yaml. Default to test
-	} else {
-		dstStage.Name = ctx.config.Stages[0]
-	}
-
-	for _, stageName := range stages {
-		stageSteps := make([]*harness.Step, 0)
-
-		// maintain stage name if set
-		if stagesLength != 0 {
-			dstStage.Name = stageName
-		}
-
-		// iterate through jobs and find jobs assigned to the stage. Skip other stages.
-		for _, jobName := range jobKeys {
-			job := ctx.config.Jobs[jobName] // maintaining order here
-			if job.Before != nil {
-				job.Stage = ".pre"
-			}
-			if job.After != nil {
-				job.Stage = ".post"
-			}
-			if job.Stage == "" {
-				job.Stage = "test" // default
-			}
-			if !cacheFound && job.Cache != nil {
-				dstStage.Spec.(*harness.StageCI).Cache = convertCache(job.Cache) // Update cache if it's defined in the job
-				cacheFound = true
-			}
-
-			if len(job.Extends) > 0 {
-				for _, extend := range job.Extends {
-					if templateJob, ok := ctx.config.TemplateJobs[extend]; ok {
-						// Perform deep merge of the template job into the current job.
-						mergedJob, err := mergeJobConfiguration(job, templateJob)
-						if err != nil {
-							return nil, err
-						}
-						job = mergedJob
-					}
-				}
-			}
-
-			if job == nil || job.Stage != stageName {
-				continue
-			}
-
-			if job.Parallel != nil {
-				if job.Parallel.Matrix != nil {
-					for i, matrix := range job.Parallel.Matrix {
-						steps := convertJobToStep(ctx, fmt.Sprintf("%s-%d", jobName, i), job, matrix)
-						stageSteps = append(stageSteps, steps...)
-					}
-				}
-			} else {
-				// Convert each job to a step
-				steps := convertJobToStep(ctx, jobName, job, nil)
-				for _, step := range steps {
-					// Prepend the pipeline-level before_script
-					if ctx.config.BeforeScript != nil {
-						prependScript := convertScriptToStep(ctx.config.BeforeScript, "", "", false)
-						step.Spec.(*harness.StepExec).Run = prependScript.Spec.(*harness.StepExec).Run + "\n" + step.Spec.(*harness.StepExec).Run
-					}
-
-					// Prepend the job-specific before_script
-					if job.Before != nil {
-						prependScript := convertScriptToStep(job.Before, "", "", false)
-						step.Spec.(*harness.StepExec).Run = prependScript.Spec.(*harness.StepExec).Run + "\n" + step.Spec.(*harness.StepExec).Run
-					}
-					stageSteps = append(stageSteps, step)
-				}
-
-				if job.Inherit != nil && job.Inherit.Variables != nil {
-					dstStage.Spec.(*harness.StageCI).Envs = convertInheritedVariables(job, dstStage.Spec.(*harness.StageCI).Envs)
-				}
-			}
-		}
-		// If there are multiple steps, wrap them with a parallel group to mirror gitlab behavior
-		if len(stageSteps) > 1 {
-			group := &harness.Step{
-				Type: "parallel",
-				Spec: &harness.StepParallel{
-					Steps: stageSteps,
-				},
-			}
-			dstStage.Spec.(*harness.StageCI).Steps = append(dstStage.Spec.(*harness.StageCI).Steps, group)
-		} else if len(stageSteps) == 1 {
-			// If there's a single step, append it to the stage directly
-			dstStage.Spec.(*harness.StageCI).Steps = append(dstStage.Spec.(*harness.StageCI).Steps, stageSteps[0])
-		}
-	}
+	// each gitlab stage converts to a harness stage.
+	dst.Stages = convertStages(ctx, jobKeys, jobs)
+	dst.Inputs = artifactInputs(dst.Stages)
 
 	// marshal the harness yaml
 	out, err := yaml.Marshal(config)
@@ -467,8 +388,10 @@ func convertInheritedVariables(job *gitlab.Job, stageEnvs map[string]string) map
 		return stageEnvs
 	}
 
+	// inherit.variables false does not inherit any of the
+	// variables.
 	if job.Inherit.Variables.All {
-		return stageEnvs
+		return map[string]string{}
 	}
 
 	// If inherit.variables is an array, only the variables in the array are inherited.
@@ -524,6 +447,12 @@ func mergeJobConfiguration(child *gitlab.Job, parent *gitlab.Job) (*gitlab.Job,
 		return nil, err
 	}
 
+	// An empty dependencies list is not copied by the merge,
+	// but it overrides the parent dependencies.
+	if child.Dependencies != nil {
+		mergedJob.Dependencies = child.Dependencies
+	}
+
 	return mergedJob, nil
 }
 
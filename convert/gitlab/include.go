@@ -0,0 +1,423 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	gitlab "github.com/hunain-avyka/Go-drone/convert/gitlab/yaml"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templates is a bundled copy of GitLab templates that do
+// not depend on the GitLab version. Only the Android, Bash,
+// Chef and Composer templates, and the
+// Workflows/Branch-Pipelines and
+// Workflows/MergeRequest-Pipelines templates are bundled.
+//
+// The Security, Jobs, Docker and most language templates
+// are not bundled on purpose. They are rewritten with most
+// GitLab releases and pin analyzer images and job names to
+// the release, so a bundled copy would silently convert a
+// pipeline that differs from the one GitLab runs. These are
+// resolved from the template directory, which should be a
+// copy of lib/gitlab/ci/templates at the version of the
+// GitLab instance.
+//
+//go:embed templates
+var templates embed.FS
+
+// defaultRef is the ref of a project include that does not
+// set the ref, which is the default branch of the project.
+const defaultRef = "HEAD"
+
+// Fetcher fetches the configuration files of remote
+// includes.
+type Fetcher interface {
+	// Fetch returns the contents of the file at the url.
+	Fetch(url string) ([]byte, error)
+}
+
+// includeSource is the file of an include. Local includes
+// in the file are resolved relative to the root of the
+// project that contains the file.
+type includeSource struct {
+	name string
+	root string
+}
+
+// resolveIncludes resolves the includes of the pipeline
+// configuration and merges the included files, using the
+// GitLab merge semantics. Hashes are deep merged, other
+// values are replaced, and the included files are merged in
+// order, before the configuration that includes them.
+// Local includes are resolved relative to the root. The
+// configuration is returned unchanged if it has no
+// includes.
+func (d *Converter) resolveIncludes(b []byte, name, root string) ([]byte, error) {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if _, ok := doc["include"]; !ok {
+		return b, nil
+	}
+	merged, err := d.resolveDocument(doc, &includeSource{name: name, root: root}, variables(doc), nil)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(merged)
+}
+
+// resolveDocument returns the document merged on top of
+// its included files. The path contains the files that are
+// being resolved, and is used to detect circular includes.
+func (d *Converter) resolveDocument(doc map[string]interface{}, src *includeSource, vars map[string]string, path []string) (map[string]interface{}, error) {
+	path = append(path, src.name)
+	includes, err := parseIncludes(doc["include"])
+	if err != nil {
+		return nil, fmt.Errorf("gitlab: %s: %s", src.name, err)
+	}
+	delete(doc, "include")
+
+	merged := map[string]interface{}{}
+	for _, include := range includes {
+		if !d.includeRules(include.Rules, src, vars) {
+			continue
+		}
+		files, err := d.includeFiles(include, src)
+		if err != nil {
+			return nil, fmt.Errorf("gitlab: %s: %s", src.name, err)
+		}
+		for _, file := range files {
+			for _, name := range path {
+				if name == file.name {
+					return nil, fmt.Errorf("gitlab: circular include %s", strings.Join(append(path, file.name), " -> "))
+				}
+			}
+			b, err := d.readInclude(file)
+			if err != nil {
+				return nil, fmt.Errorf("gitlab: %s: include %s: %s", src.name, file.name, err)
+			}
+			sub := map[string]interface{}{}
+			if err := yaml.Unmarshal(b, &sub); err != nil {
+				return nil, fmt.Errorf("gitlab: include %s: %s", file.name, err)
+			}
+			resolved, err := d.resolveDocument(sub, file, vars, path)
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeMaps(merged, resolved)
+		}
+	}
+	return mergeMaps(merged, doc), nil
+}
+
+// parseIncludes parses the include keyword, which is a
+// file, an include, or a list of files and includes.
+func parseIncludes(v interface{}) ([]*gitlab.Include, error) {
+	if v == nil {
+		return nil, nil
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+	var includes []*gitlab.Include
+	for _, item := range items {
+		b, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		include := new(gitlab.Include)
+		if err := yaml.Unmarshal(b, include); err != nil {
+			return nil, err
+		}
+		includes = append(includes, include)
+	}
+	return includes, nil
+}
+
+// includeFiles returns the files of the include. Local
+// includes may use wildcards.
+func (d *Converter) includeFiles(include *gitlab.Include, src *includeSource) ([]*includeSource, error) {
+	switch {
+	case include.Local != "":
+		if src.root == "" {
+			return nil, errors.New("local include: repository root is not configured")
+		}
+		pattern := filepath.Join(src.root, filepath.FromSlash(strings.TrimPrefix(include.Local, "/")))
+		if !strings.ContainsAny(include.Local, "*?[") {
+			return []*includeSource{{name: pattern, root: src.root}}, nil
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		var files []*includeSource
+		for _, match := range matches {
+			files = append(files, &includeSource{name: match, root: src.root})
+		}
+		return files, nil
+	case include.Project != "":
+		if d.projects == "" {
+			return nil, fmt.Errorf("project include %s: project directory is not configured", include.Project)
+		}
+		ref := include.Ref
+		if ref == "" {
+			ref = defaultRef
+		}
+		// the project is mirrored at group/project/ref in
+		// the project directory.
+		root := filepath.Join(d.projects, filepath.FromSlash(include.Project), ref)
+		var files []*includeSource
+		for _, file := range include.File {
+			files = append(files, &includeSource{
+				name: filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(file, "/"))),
+				root: root,
+			})
+		}
+		return files, nil
+	case include.Template != "":
+		return []*includeSource{{name: "template:" + include.Template}}, nil
+	case include.Remote != "":
+		return []*includeSource{{name: include.Remote, root: src.root}}, nil
+	}
+	return nil, errors.New("include has no file")
+}
+
+// readInclude reads the included file. Templates are read
+// from the template directory, if configured, or from the
+// bundled templates, and remote files are fetched with the
+// fetcher.
+func (d *Converter) readInclude(file *includeSource) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(file.name, "template:"):
+		name := strings.TrimPrefix(file.name, "template:")
+		if d.templates != "" {
+			b, err := os.ReadFile(filepath.Join(d.templates, filepath.FromSlash(name)))
+			if err == nil || !errors.Is(err, fs.ErrNotExist) {
+				return b, err
+			}
+		}
+		b, err := templates.ReadFile(path.Join("templates", name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("template %s is not available, the bundled templates are %s, set the template directory to a copy of the gitlab templates to include other templates",
+				name, strings.Join(bundledTemplates(), ", "))
+		}
+		return b, err
+	case strings.HasPrefix(file.name, "https://") || strings.HasPrefix(file.name, "http://"):
+		if d.fetcher == nil {
+			return nil, errors.New("remote includes require a fetcher")
+		}
+		return d.fetcher.Fetch(file.name)
+	}
+	return os.ReadFile(file.name)
+}
+
+// bundledTemplates returns the names of the bundled
+// templates.
+func bundledTemplates() []string {
+	var names []string
+	fs.WalkDir(templates, "templates", func(name string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			names = append(names, strings.TrimPrefix(name, "templates/"))
+		}
+		return nil
+	})
+	return names
+}
+
+// includeRules returns true if the file is included. The
+// file is included if there are no rules, or the first
+// matching rule is not when: never. The if conditions are
+// evaluated with the variables of the configuration, and
+// conditions that use other variables, such as predefined
+// variables, are assumed to match.
+func (d *Converter) includeRules(rules []*gitlab.Rule, src *includeSource, vars map[string]string) bool {
+	if len(rules) == 0 {
+		return true
+	}
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		if rule.If != "" && !evalRule(rule.If, vars) {
+			continue
+		}
+		if len(rule.Exists) != 0 && !exists(src.root, rule.Exists) {
+			continue
+		}
+		return rule.When != "never"
+	}
+	return false
+}
+
+// exists returns true if a file in the root matches one of
+// the patterns.
+func exists(root string, patterns []string) bool {
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(pattern, "/"))))
+		if len(matches) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// variables returns the global variables of the
+// configuration.
+func variables(doc map[string]interface{}) map[string]string {
+	vars := map[string]string{}
+	src, _ := doc["variables"].(map[string]interface{})
+	for k, v := range src {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			vars[k] = fmt.Sprint(v["value"])
+		default:
+			vars[k] = fmt.Sprint(v)
+		}
+	}
+	return vars
+}
+
+// ruleCompareRe matches a comparison of a variable in a
+// rules if condition.
+var ruleCompareRe = regexp.MustCompile(`^\$(\w+)\s*(==|!=|=~|!~)\s*(.+)$`)
+
+// evalRule evaluates the rules if condition. Conditions
+// are combined with && and || and grouped with parentheses,
+// and && takes precedence over ||.
+func evalRule(cond string, vars map[string]string) bool {
+	cond = strings.TrimSpace(cond)
+	if or := splitRule(cond, "||"); len(or) > 1 {
+		for _, s := range or {
+			if evalRule(s, vars) {
+				return true
+			}
+		}
+		return false
+	}
+	if and := splitRule(cond, "&&"); len(and) > 1 {
+		for _, s := range and {
+			if !evalRule(s, vars) {
+				return false
+			}
+		}
+		return true
+	}
+	// the condition does not contain operators outside of
+	// parentheses, so enclosing parentheses group it.
+	if strings.HasPrefix(cond, "(") && strings.HasSuffix(cond, ")") {
+		return evalRule(cond[1:len(cond)-1], vars)
+	}
+	return evalCompare(cond, vars)
+}
+
+// splitRule splits the condition at the operator, ignoring
+// operators in parentheses, strings and regular expressions.
+func splitRule(cond, op string) []string {
+	var parts []string
+	var depth, start int
+	var quote byte
+	for i := 0; i < len(cond); i++ {
+		c := cond[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '/' && strings.HasSuffix(strings.TrimSpace(cond[:i]), "~"):
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(cond[i:], op):
+			parts = append(parts, cond[start:i])
+			start = i + len(op)
+			i += len(op) - 1
+		}
+	}
+	return append(parts, cond[start:])
+}
+
+// evalCompare evaluates a variable comparison. It returns
+// true if the variable is not defined in the configuration,
+// since the value is not known until the pipeline runs.
+func evalCompare(s string, vars map[string]string) bool {
+	if m := ruleCompareRe.FindStringSubmatch(s); m != nil {
+		value, ok := vars[m[1]]
+		if !ok {
+			return true
+		}
+		operand := strings.TrimSpace(m[3])
+		switch m[2] {
+		case "==", "!=":
+			equal := value == strings.Trim(operand, `"'`)
+			if strings.HasPrefix(operand, "$") {
+				other, ok := vars[strings.TrimPrefix(operand, "$")]
+				if !ok {
+					return true
+				}
+				equal = value == other
+			}
+			return equal == (m[2] == "==")
+		default:
+			re, err := regexp.Compile(strings.TrimSuffix(strings.TrimPrefix(operand, "/"), "/"))
+			if err != nil {
+				return true
+			}
+			return re.MatchString(value) == (m[2] == "=~")
+		}
+	}
+	if strings.HasPrefix(s, "$") {
+		value, ok := vars[strings.TrimPrefix(s, "$")]
+		return !ok || value != ""
+	}
+	return true
+}
+
+// mergeMaps deep merges the src map into the dst map.
+// Values in src take precedence, and hashes are merged.
+func mergeMaps(dst, src map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range dst {
+		out[k] = v
+	}
+	for k, v := range src {
+		srcMap, ok1 := v.(map[string]interface{})
+		dstMap, ok2 := out[k].(map[string]interface{})
+		if ok1 && ok2 {
+			out[k] = mergeMaps(dstMap, srcMap)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,226 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+// stubFetcher returns the files of remote includes from
+// memory.
+type stubFetcher map[string]string
+
+func (f stubFetcher) Fetch(url string) ([]byte, error) {
+	s, ok := f[url]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return []byte(s), nil
+}
+
+// writeFiles writes the files to the directory.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolveIncludes(t *testing.T) {
+	root := t.TempDir()
+	projects := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"ci/build.yml":  "build:\n  script: make build\n  variables:\n    GOOS: linux\n    GOARCH: amd64\n",
+		"ci/deploy.yml": "deploy:\n  script: make deploy\n",
+	})
+	writeFiles(t, projects, map[string]string{
+		"group/shared/v1/lint.yml":   "include: /common.yml\nlint:\n  script: make lint\n",
+		"group/shared/v1/common.yml": "variables:\n  SHARED: v1\n",
+		"group/shared/HEAD/lint.yml": "lint:\n  script: make lint-head\n",
+	})
+
+	converter := New(
+		WithProjects(projects),
+		WithFetcher(stubFetcher{
+			"https://example.com/ci/test.yml": "test:\n  script: make test\n",
+		}),
+	)
+	src := `
+include:
+  - /ci/build.yml
+  - local: /ci/deploy.yml
+    rules:
+      - if: $DEPLOY == "true"
+        when: never
+      - when: always
+  - project: group/shared
+    ref: v1
+    file: /lint.yml
+  - https://example.com/ci/test.yml
+  - template: Workflows/Branch-Pipelines.gitlab-ci.yml
+
+variables:
+  DEPLOY: "true"
+
+build:
+  variables:
+    GOARCH: arm64
+`
+	b, err := converter.resolveIncludes([]byte(src), ".gitlab-ci.yml", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"variables": map[string]interface{}{
+			"DEPLOY": "true",
+			"SHARED": "v1",
+		},
+		"build": map[string]interface{}{
+			"script": "make build",
+			"variables": map[string]interface{}{
+				"GOOS":   "linux",
+				"GOARCH": "arm64",
+			},
+		},
+		"lint": map[string]interface{}{
+			"script": "make lint",
+		},
+		"test": map[string]interface{}{
+			"script": "make test",
+		},
+		"workflow": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"if": "$CI_COMMIT_TAG"},
+				map[string]interface{}{"if": "$CI_COMMIT_BRANCH"},
+			},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected include result")
+		t.Log(diff)
+	}
+}
+
+func TestResolveIncludes_DefaultRef(t *testing.T) {
+	projects := t.TempDir()
+	writeFiles(t, projects, map[string]string{
+		"group/shared/HEAD/lint.yml": "lint:\n  script: make lint\n",
+	})
+
+	converter := New(WithProjects(projects))
+	src := "include:\n  project: group/shared\n  file: lint.yml\n"
+	b, err := converter.resolveIncludes([]byte(src), ".gitlab-ci.yml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "lint:\n    script: make lint\n"; got != want {
+		t.Errorf("Want include result %q, got %q", want, got)
+	}
+}
+
+func TestResolveIncludes_Circular(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.yml": "include: /b.yml\n",
+		"b.yml": "include: /a.yml\n",
+	})
+
+	src := "include: /a.yml\n"
+	_, err := New().resolveIncludes([]byte(src), ".gitlab-ci.yml", root)
+	if err == nil {
+		t.Fatal("Want circular include error")
+	}
+	if got, want := err.Error(), "gitlab: circular include"; !strings.HasPrefix(got, want) {
+		t.Errorf("Want error prefix %q, got %q", want, got)
+	}
+}
+
+func TestResolveIncludes_Errors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{
+			src: "include: https://example.com/ci.yml\n",
+			err: "remote includes require a fetcher",
+		},
+		{
+			src: "include:\n  project: group/shared\n  file: lint.yml\n",
+			err: "project directory is not configured",
+		},
+		{
+			src: "include:\n  template: Unknown.gitlab-ci.yml\n",
+			err: "template Unknown.gitlab-ci.yml is not available, the bundled templates are Android.gitlab-ci.yml, Bash.gitlab-ci.yml",
+		},
+	}
+	for _, test := range tests {
+		_, err := New().resolveIncludes([]byte(test.src), ".gitlab-ci.yml", "")
+		if err == nil {
+			t.Errorf("Want error for include %q", test.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Want error %q, got %q", test.err, err)
+		}
+	}
+}
+
+func TestEvalRule(t *testing.T) {
+	vars := map[string]string{
+		"DEPLOY": "true",
+		"ENV":    "production",
+		"EMPTY":  "",
+	}
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`$DEPLOY == "true"`, true},
+		{`$DEPLOY != "true"`, false},
+		{`$ENV =~ /^prod/`, true},
+		{`$ENV !~ /^prod/`, false},
+		{`$DEPLOY`, true},
+		{`$EMPTY`, false},
+		{`$DEPLOY == "false" || $ENV == "production"`, true},
+		{`$DEPLOY == "true" && $ENV == "staging"`, false},
+		{`$CI_COMMIT_BRANCH == "main"`, true},
+		{`($DEPLOY == "false" || $ENV == "production") && $EMPTY`, false},
+		{`$DEPLOY == "false" || ($ENV == "production" && $DEPLOY)`, true},
+		{`(($DEPLOY == "true"))`, true},
+		{`$ENV =~ /^(prod|staging)/ && $DEPLOY == "true"`, true},
+		{`$ENV == "a || b"`, false},
+	}
+	for _, test := range tests {
+		if got := evalRule(test.cond, vars); got != test.want {
+			t.Errorf("Want rule %q to be %v", test.cond, test.want)
+		}
+	}
+}
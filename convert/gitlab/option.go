@@ -33,3 +33,39 @@ func WithKubernetes(namespace, connector string) Option {
 		d.kubeConnector = connector
 	}
 }
+
+// WithRoot returns an option to set the repository root,
+// which is used to resolve local includes.
+func WithRoot(root string) Option {
+	return func(d *Converter) {
+		d.root = root
+	}
+}
+
+// WithProjects returns an option to set the directory used
+// to resolve project includes. The file of the project
+// group/project at ref is loaded from group/project/ref/file,
+// and the default branch is loaded from group/project/HEAD.
+func WithProjects(dir string) Option {
+	return func(d *Converter) {
+		d.projects = dir
+	}
+}
+
+// WithTemplates returns an option to set the directory used
+// to resolve template includes. Templates that are not in
+// the directory are loaded from the bundled templates, which
+// only contain a few common templates.
+func WithTemplates(dir string) Option {
+	return func(d *Converter) {
+		d.templates = dir
+	}
+}
+
+// WithFetcher returns an option to set the fetcher used to
+// resolve remote includes.
+func WithFetcher(fetcher Fetcher) Option {
+	return func(d *Converter) {
+		d.fetcher = fetcher
+	}
+}
@@ -0,0 +1,484 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	gitlab "github.com/hunain-avyka/Go-drone/convert/gitlab/yaml"
+	"github.com/hunain-avyka/Go-drone/internal/slug"
+	harness "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// defaultStages are the stages of a pipeline that does not
+// declare the stages.
+var defaultStages = []string{"build", "test", "deploy"}
+
+// stageNames returns the pipeline stages in order. The .pre
+// stage always runs first and the .post stage always runs
+// last, whether or not they are declared.
+func stageNames(stages []string) []string {
+	if len(stages) == 0 {
+		stages = defaultStages
+	}
+	names := []string{".pre"}
+	for _, name := range stages {
+		if name != ".pre" && name != ".post" {
+			names = append(names, name)
+		}
+	}
+	return append(names, ".post")
+}
+
+// expandJobs returns the jobs merged with the templates
+// they extend. Jobs without a stage run in the test stage.
+func expandJobs(ctx *context) (map[string]*gitlab.Job, error) {
+	jobs := map[string]*gitlab.Job{}
+	for name, job := range ctx.config.Jobs {
+		if job == nil {
+			continue
+		}
+		for _, extend := range job.Extends {
+			if templateJob, ok := ctx.config.TemplateJobs[extend]; ok {
+				// Perform deep merge of the template job into the current job.
+				mergedJob, err := mergeJobConfiguration(job, templateJob)
+				if err != nil {
+					return nil, err
+				}
+				job = mergedJob
+			}
+		}
+		if job.Stage == "" {
+			dst := *job
+			dst.Stage = "test" // default
+			job = &dst
+		}
+		jobs[name] = job
+	}
+	return jobs, nil
+}
+
+// convertStages converts each GitLab stage to a Harness
+// stage. Stages do not share a workspace, so the artifacts
+// of a job are saved at the end of its stage if the jobs
+// of a later stage restore them.
+func convertStages(ctx *context, jobNames []string, jobs map[string]*gitlab.Job) []*harness.Stage {
+	var stages []*harness.Stage
+	var artifacts []string
+	saved := map[*harness.Stage][]string{}
+	restored := map[string]bool{}
+	for _, name := range stageNames(ctx.config.Stages) {
+		stage, producers := convertStage(ctx, name, jobNames, jobs, artifacts, restored)
+		if stage == nil {
+			continue
+		}
+		stages = append(stages, stage)
+		saved[stage] = producers
+		artifacts = append(artifacts, producers...)
+	}
+	for _, stage := range stages {
+		spec := stage.Spec.(*harness.StageCI)
+		for _, name := range saved[stage] {
+			if restored[name] {
+				spec.Steps = append(spec.Steps, convertSaveArtifacts(name, jobs[name].Artifacts))
+			}
+		}
+	}
+	return stages
+}
+
+// convertStage converts the jobs of the GitLab stage to a
+// Harness stage, or returns nil if the stage has no jobs.
+// The jobs of a stage run in parallel. The artifacts of the
+// jobs in earlier stages are restored, and recorded in the
+// restored set. It returns the jobs of the stage that have
+// artifacts.
+func convertStage(ctx *context, name string, jobNames []string, jobs map[string]*gitlab.Job, artifacts []string, restored map[string]bool) (*harness.Stage, []string) {
+	spec := &harness.StageCI{
+		Envs: convertVariables(ctx.config.Variables),
+	}
+
+	var stageSteps, services, restores []*harness.Step
+	var producers []string
+	for _, jobName := range jobNames {
+		job := jobs[jobName]
+		if job == nil || job.Stage != name {
+			continue
+		}
+		if spec.Cache == nil && job.Cache != nil {
+			spec.Cache = convertCache(job.Cache)
+		}
+		services = appendSteps(services, convertServices(jobServices(job, ctx)))
+		restores = appendSteps(restores, convertRestores(job, artifacts, restored))
+
+		steps := convertJobSteps(ctx, jobName, job)
+		// the stage cache is the cache of the first job, so
+		// other caches are restored and saved by the job.
+		if job.Cache != nil && !reflect.DeepEqual(convertCache(job.Cache), spec.Cache) {
+			steps = convertJobCache(jobName, job.Cache, steps)
+		}
+		stageSteps = append(stageSteps, steps...)
+
+		if job.Artifacts != nil && len(job.Artifacts.Paths) != 0 {
+			producers = append(producers, jobName)
+		}
+	}
+	if len(stageSteps) == 0 {
+		return nil, nil
+	}
+
+	spec.Steps = append(services, restores...)
+	// If there are multiple steps, wrap them with a parallel group to mirror gitlab behavior
+	if len(stageSteps) > 1 {
+		spec.Steps = append(spec.Steps, &harness.Step{
+			Type: "parallel",
+			Spec: &harness.StepParallel{
+				Steps: stageSteps,
+			},
+		})
+	} else {
+		spec.Steps = append(spec.Steps, stageSteps[0])
+	}
+
+	return &harness.Stage{
+		Name: name,
+		Type: "ci",
+		Spec: spec,
+	}, producers
+}
+
+// convertJobSteps converts the job to steps. A parallel job
+// converts to a step for each matrix, or to a step with a
+// matrix of node indexes. The before_script is prepended to
+// the script, and the pipeline variables the job does not
+// inherit are unset.
+func convertJobSteps(ctx *context, jobName string, job *gitlab.Job) []*harness.Step {
+	var steps []*harness.Step
+	switch {
+	case job.Parallel != nil && job.Parallel.Matrix != nil:
+		for i, matrix := range job.Parallel.Matrix {
+			steps = append(steps, convertJobToStep(ctx, fmt.Sprintf("%s-%d", jobName, i), job, matrix)...)
+		}
+	case job.Parallel != nil && job.Parallel.Count > 0:
+		steps = convertJobToStep(ctx, jobName, job, nodeMatrix(job.Parallel.Count))
+		for _, step := range steps {
+			step.Spec.(*harness.StepExec).Envs["CI_NODE_TOTAL"] = strconv.Itoa(job.Parallel.Count)
+		}
+	default:
+		steps = convertJobToStep(ctx, jobName, job, nil)
+	}
+
+	unset := uninheritedVariables(ctx, job)
+	for _, step := range steps {
+		// Prepend the pipeline-level before_script
+		if ctx.config.BeforeScript != nil {
+			prependScript := convertScriptToStep(ctx.config.BeforeScript, "", "", false)
+			step.Spec.(*harness.StepExec).Run = prependScript.Spec.(*harness.StepExec).Run + "\n" + step.Spec.(*harness.StepExec).Run
+		}
+
+		// Prepend the job-specific before_script
+		if job.Before != nil {
+			prependScript := convertScriptToStep(job.Before, "", "", false)
+			step.Spec.(*harness.StepExec).Run = prependScript.Spec.(*harness.StepExec).Run + "\n" + step.Spec.(*harness.StepExec).Run
+		}
+
+		if len(unset) != 0 {
+			step.Spec.(*harness.StepExec).Run = "unset " + strings.Join(unset, " ") + "\n" + step.Spec.(*harness.StepExec).Run
+		}
+	}
+	return steps
+}
+
+// nodeMatrix returns the matrix of a job that runs count
+// times in parallel. Each job has a CI_NODE_INDEX variable
+// from 1 to count.
+func nodeMatrix(count int) map[string][]string {
+	var index []string
+	for i := 1; i <= count; i++ {
+		index = append(index, strconv.Itoa(i))
+	}
+	return map[string][]string{"CI_NODE_INDEX": index}
+}
+
+// uninheritedVariables returns the names of the pipeline
+// variables the job does not inherit, which are set as
+// stage variables, unless the job defines them.
+func uninheritedVariables(ctx *context, job *gitlab.Job) []string {
+	if job.Inherit == nil || job.Inherit.Variables == nil {
+		return nil
+	}
+	globals := convertVariables(ctx.config.Variables)
+	inherited := convertInheritedVariables(job, globals)
+	defined := convertVariables(job.Variables)
+
+	var names []string
+	for name := range globals {
+		_, ok1 := inherited[name]
+		_, ok2 := defined[name]
+		if !ok1 && !ok2 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// convertJobCache returns the job steps in a group that
+// restores the job cache before and saves it after the
+// steps, according to the cache policy.
+func convertJobCache(jobName string, cache *gitlab.Cache, steps []*harness.Step) []*harness.Step {
+	key := "default"
+	if cache.Key != nil && cache.Key.Value != "" {
+		key = cache.Key.Value
+	} else if cache.Key != nil && cache.Key.Prefix != "" {
+		key = cache.Key.Prefix + "-default"
+	}
+
+	var group []*harness.Step
+	if cache.Policy != "push" {
+		group = append(group, &harness.Step{
+			Name: "restore " + jobName + " cache",
+			Type: "plugin",
+			Spec: &harness.StepPlugin{
+				Image: "plugins/s3-cache",
+				With: map[string]interface{}{
+					"root":    artifactBucket,
+					"path":    key,
+					"restore": true,
+				},
+			},
+		})
+	}
+	group = append(group, steps...)
+	if cache.Policy != "pull" {
+		group = append(group, &harness.Step{
+			Name: "save " + jobName + " cache",
+			Type: "plugin",
+			Spec: &harness.StepPlugin{
+				Image: "plugins/s3-cache",
+				With: map[string]interface{}{
+					"root":    artifactBucket,
+					"path":    key,
+					"mount":   []string(cache.Paths),
+					"rebuild": true,
+				},
+			},
+		})
+	}
+	return []*harness.Step{{
+		Name: jobName,
+		Type: "group",
+		Spec: &harness.StepGroup{
+			Steps: group,
+		},
+	}}
+}
+
+// jobServices returns the services of the job, or the
+// default services if the job inherits them.
+func jobServices(job *gitlab.Job, ctx *context) []*gitlab.Image {
+	if len(job.Services) != 0 {
+		return job.Services
+	}
+	if ctx.config.Default != nil && len(ctx.config.Default.Services) != 0 && inheritsDefault(job, "services") {
+		return ctx.config.Default.Services
+	}
+	return ctx.config.Services
+}
+
+// inheritsDefault returns true if the job inherits the
+// default keyword.
+func inheritsDefault(job *gitlab.Job, key string) bool {
+	if job.Inherit == nil || job.Inherit.Default == nil || job.Inherit.Default.All {
+		return true
+	}
+	for _, k := range job.Inherit.Default.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// convertServices converts the services to background
+// steps. The service is named after the alias, or the
+// image name.
+func convertServices(services []*gitlab.Image) []*harness.Step {
+	var steps []*harness.Step
+	for _, service := range services {
+		if service == nil || service.Name == "" {
+			continue
+		}
+		name := service.Alias
+		if name == "" {
+			name = serviceName(service.Name)
+		}
+		spec := &harness.StepBackground{
+			Image: service.Name,
+			Args:  service.Command,
+		}
+		if len(service.Entrypoint) > 0 {
+			spec.Entrypoint = service.Entrypoint[0]
+			spec.Args = append(append([]string{}, service.Entrypoint[1:]...), service.Command...)
+		}
+		steps = append(steps, &harness.Step{
+			Name: name,
+			Type: "background",
+			Spec: spec,
+		})
+	}
+	return steps
+}
+
+// serviceName returns the service name of the image, which
+// is the image name without the registry and tag.
+func serviceName(image string) string {
+	name := image
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		name = name[i+1:]
+	}
+	if i := strings.IndexAny(name, ":@"); i != -1 {
+		name = name[:i]
+	}
+	return name
+}
+
+// artifactBucket is the pipeline input of the s3 bucket
+// that stores the job artifacts and caches, which do not
+// have a harness equivalent.
+const artifactBucket = "<+inputs.artifact_bucket>"
+
+// artifactInputs returns the pipeline inputs required by
+// the stages, which is the artifact bucket if the stages
+// save or restore artifacts or caches.
+func artifactInputs(stages []*harness.Stage) map[string]*harness.Input {
+	for _, stage := range stages {
+		if usesArtifactBucket(stage.Spec.(*harness.StageCI).Steps) {
+			return map[string]*harness.Input{
+				"artifact_bucket": {
+					Type:        "string",
+					Description: "the s3 bucket that stores the job artifacts and caches",
+					Required:    true,
+				},
+			}
+		}
+	}
+	return nil
+}
+
+// usesArtifactBucket returns true if any of the steps uses
+// the artifact bucket.
+func usesArtifactBucket(steps []*harness.Step) bool {
+	for _, step := range steps {
+		switch spec := step.Spec.(type) {
+		case *harness.StepPlugin:
+			if spec.With["root"] == artifactBucket {
+				return true
+			}
+		case *harness.StepGroup:
+			if usesArtifactBucket(spec.Steps) {
+				return true
+			}
+		case *harness.StepParallel:
+			if usesArtifactBucket(spec.Steps) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// artifactKey returns the cache key used to share the job
+// artifacts between the stages of the pipeline execution.
+func artifactKey(jobName string) string {
+	return "<+pipeline.executionId>/" + slug.Create(jobName)
+}
+
+// convertSaveArtifacts returns a plugin step that saves the
+// job artifacts, so they can be restored in later stages.
+func convertSaveArtifacts(jobName string, artifacts *gitlab.Artifacts) *harness.Step {
+	return &harness.Step{
+		Name: "save " + jobName + " artifacts",
+		Type: "plugin",
+		Spec: &harness.StepPlugin{
+			Image: "plugins/s3-cache",
+			With: map[string]interface{}{
+				"root":    artifactBucket,
+				"path":    artifactKey(jobName),
+				"mount":   []string(artifacts.Paths),
+				"rebuild": true,
+			},
+		},
+	}
+}
+
+// convertRestores returns plugin steps that restore the
+// artifacts of the jobs in earlier stages the job depends
+// on. Jobs depend on all earlier jobs, unless dependencies
+// are listed. An empty list restores no artifacts.
+func convertRestores(job *gitlab.Job, artifacts []string, restored map[string]bool) []*harness.Step {
+	var steps []*harness.Step
+	for _, name := range artifacts {
+		if job.Dependencies != nil && !contains(*job.Dependencies, name) {
+			continue
+		}
+		restored[name] = true
+		steps = append(steps, &harness.Step{
+			Name: "restore " + name + " artifacts",
+			Type: "plugin",
+			Spec: &harness.StepPlugin{
+				Image: "plugins/s3-cache",
+				With: map[string]interface{}{
+					"root":    artifactBucket,
+					"path":    artifactKey(name),
+					"restore": true,
+				},
+			},
+		})
+	}
+	return steps
+}
+
+// appendSteps appends the steps that are not already in
+// the list, by name.
+func appendSteps(dst, src []*harness.Step) []*harness.Step {
+	for _, step := range src {
+		found := false
+		for _, existing := range dst {
+			if existing.Name == step.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, step)
+		}
+	}
+	return dst
+}
+
+// contains returns true if the list contains the string.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -16,6 +16,7 @@ package yaml
 
 import (
 	"errors"
+	"strings"
 )
 
 // Include includes external yaml files.
@@ -27,6 +28,7 @@ type Include struct {
 	Remote   string        `yaml:"remote,omitempty"`
 	Template string        `yaml:"template,omitempty"`
 	File     Stringorslice `yaml:"file,omitempty"`
+	Rules    []*Rule       `yaml:"rules,omitempty"`
 }
 
 // UnmarshalYAML implements the unmarshal interface.
@@ -39,10 +41,17 @@ func (v *Include) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		Remote   string        `yaml:"remote,omitempty"`
 		Template string        `yaml:"template,omitempty"`
 		File     Stringorslice `yaml:"file,omitempty"`
+		Rules    []*Rule       `yaml:"rules,omitempty"`
 	}{}
 
 	if err := unmarshal(&out1); err == nil {
-		v.Local = out1
+		// a string include is a remote include if it is
+		// a url, and a local include otherwise.
+		if strings.HasPrefix(out1, "https://") || strings.HasPrefix(out1, "http://") {
+			v.Remote = out1
+		} else {
+			v.Local = out1
+		}
 		return nil
 	}
 
@@ -53,6 +62,7 @@ func (v *Include) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		v.Remote = out2.Remote
 		v.Template = out2.Template
 		v.File = out2.File
+		v.Rules = out2.Rules
 		return nil
 	}
 
@@ -32,6 +32,19 @@ func TestInclude(t *testing.T) {
 				Local: ".gitlab-ci-production.yml",
 			},
 		},
+		{
+			yaml: `"https://gitlab.com/example-project/-/raw/main/.gitlab-ci.yml"`,
+			want: Include{
+				Remote: "https://gitlab.com/example-project/-/raw/main/.gitlab-ci.yml",
+			},
+		},
+		{
+			yaml: `{ "local": "/ci/deploy.yml", "rules": [ { "if": '$DEPLOY == "true"' } ] }`,
+			want: Include{
+				Local: "/ci/deploy.yml",
+				Rules: []*Rule{{If: `$DEPLOY == "true"`}},
+			},
+		},
 		{
 			yaml: `{ "project": "my-group/my-project", "file": "/templates/.gitlab-ci-template.yml" }`,
 			want: Include{
@@ -26,7 +26,7 @@ type Job struct {
 	Cache             *Cache                   `yaml:"cache,omitempty"`
 	Coverage          string                   `yaml:"coverage,omitempty"`
 	DASTConfiguration *DASTConfiguration       `yaml:"dast_configuration,omitempty"`
-	Dependencies      Stringorslice            `yaml:"dependencies,omitempty"`
+	Dependencies      *Stringorslice           `yaml:"dependencies,omitempty"` // nil if not set, empty if no artifacts are restored
 	Environment       *Environment             `yaml:"environment,omitempty"`
 	Except            *Conditions              `yaml:"except,omitempty"`
 	Extends           Stringorslice            `yaml:"extends,omitempty"`
@@ -66,7 +66,7 @@ func (v *Job) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		Cache             *Cache                   `yaml:"cache,omitempty"`
 		Coverage          string                   `yaml:"coverage,omitempty"`
 		DASTConfiguration *DASTConfiguration       `yaml:"dast_configuration,omitempty"`
-		Dependencies      Stringorslice            `yaml:"dependencies,omitempty"`
+		Dependencies      *Stringorslice           `yaml:"dependencies,omitempty"`
 		Environment       *Environment             `yaml:"environment,omitempty"`
 		Except            *Conditions              `yaml:"except,omitempty"`
 		Extends           Stringorslice            `yaml:"extends,omitempty"`
@@ -62,6 +62,31 @@ func TestJob(t *testing.T) {
 	}
 }
 
+func TestJob_Dependencies(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want *Stringorslice
+	}{
+		{yaml: `{ script: make }`, want: nil},
+		{yaml: `{ script: make, dependencies: [] }`, want: &Stringorslice{}},
+		{yaml: `{ script: make, dependencies: [ build ] }`, want: &Stringorslice{"build"}},
+	}
+	for _, test := range tests {
+		got := new(Job)
+		if err := yaml.Unmarshal([]byte(test.yaml), got); err != nil {
+			t.Error(err)
+			return
+		}
+		if (got.Dependencies == nil) != (test.want == nil) {
+			t.Errorf("Want dependencies %v for %s, got %v", test.want, test.yaml, got.Dependencies)
+			continue
+		}
+		if test.want != nil && len(*got.Dependencies) != len(*test.want) {
+			t.Errorf("Want dependencies %v for %s, got %v", *test.want, test.yaml, *got.Dependencies)
+		}
+	}
+}
+
 func TestJob_Error(t *testing.T) {
 	err := yaml.Unmarshal([]byte("123"), new(Job))
 	if err == nil || err.Error() != "failed to unmarshal job" {
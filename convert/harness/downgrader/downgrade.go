@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/hunain-avyka/Go-drone/convert/harness"
+	"github.com/hunain-avyka/Go-drone/internal/report"
 	"github.com/hunain-avyka/Go-drone/internal/slug"
 	"github.com/hunain-avyka/Go-drone/internal/store"
 
@@ -122,13 +123,34 @@ func New(options ...Option) *Downgrader {
 	return d
 }
 
-// Downgrade downgrades a v1 pipeline.
+// Downgrade downgrades a v1 pipeline. Trigger documents,
+// which are already in the v0 format, are appended to the
+// downgraded pipeline.
 func (d *Downgrader) Downgrade(b []byte) ([]byte, error) {
+	b, triggers := splitTriggers(b)
 	src, err := downgraderYaml.ParseBytes(b)
 	if err != nil {
 		return nil, err
 	}
-	return d.DowngradeFrom(src)
+	out, err := d.downgrade(src)
+	if err != nil || len(triggers) == 0 {
+		return out, err
+	}
+	pipelineId := d.pipelineId
+	if len(src) != 0 {
+		pipelineId = d.pipelineIdentifier(src[0])
+	}
+	var buf bytes.Buffer
+	buf.Write(out)
+	for _, trigger := range triggers {
+		trigger, err := d.convertTrigger(trigger, pipelineId)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n---\n")
+		buf.Write(trigger)
+	}
+	return buf.Bytes(), nil
 }
 
 // DowngradeString downgrades a v1 pipeline.
@@ -154,16 +176,18 @@ func (d *Downgrader) DowngradeFrom(src []*v1.Config) ([]byte, error) {
 func (d *Downgrader) downgrade(src []*v1.Config) ([]byte, error) {
 	var buf bytes.Buffer
 	for i, p := range src {
+		pipeline, ok := p.Spec.(*v1.Pipeline)
+		if !ok || pipeline == nil {
+			return nil, fmt.Errorf("downgrader: document %d is not a pipeline", i+1)
+		}
 		config := new(v0.Config)
+		r := report.New()
 
-		config.Pipeline.ID = d.pipelineId
+		config.Pipeline.ID = d.pipelineIdentifier(p)
 		config.Pipeline.Name = d.pipelineName
 		if config.Pipeline.Name == harness.DefaultName && p.Name != "" {
 			config.Pipeline.Name = p.Name
 		}
-		if config.Pipeline.ID == harness.DefaultName && p.Name != "" {
-			config.Pipeline.ID = slug.Create(p.Name)
-		}
 
 		config.Pipeline.Org = d.pipelineOrg
 		config.Pipeline.Project = d.pipelineProj
@@ -178,30 +202,13 @@ func (d *Downgrader) downgrade(src []*v1.Config) ([]byte, error) {
 			Conn:  d.codebaseConn,
 			Build: "<+input>",
 		}
-		// FIXME: this is subject to a nil pointer
-		if p.Spec.(*v1.Pipeline).Options != nil {
-			config.Pipeline.Variables = convertVariables(p.Spec.(*v1.Pipeline).Options.Envs)
+		if pipeline.Options != nil {
+			config.Pipeline.Variables = convertVariables(pipeline.Options.Envs)
 		}
 
 		// convert stages
-		// FIXME: this is subject to a nil pointer
-		for _, stage := range p.Spec.(*v1.Pipeline).Stages {
-			// skip nil stages. this is un-necessary, we have
-			// this logic in place just to be safe.
-			if stage == nil {
-				continue
-			}
-
-			// skip stages that are not CI stages, for now
-			if _, ok := stage.Spec.(*v1.StageCI); !ok {
-				continue
-			}
+		config.Pipeline.Stages = d.convertStages(pipeline.Stages, false, r)
 
-			// convert the stage and add to the list
-			config.Pipeline.Stages = append(config.Pipeline.Stages, &v0.Stages{
-				Stage: d.convertStage(stage),
-			})
-		}
 		out, err := yaml.Marshal(config)
 		if err != nil {
 			return nil, err
@@ -209,11 +216,80 @@ func (d *Downgrader) downgrade(src []*v1.Config) ([]byte, error) {
 		if i > 0 {
 			buf.WriteString("\n---\n")
 		}
+		buf.Write(r.Comment())
 		buf.Write(out)
 	}
 	return buf.Bytes(), nil
 }
 
+// pipelineIdentifier returns the identifier of the
+// downgraded pipeline.
+func (d *Downgrader) pipelineIdentifier(p *v1.Config) string {
+	if d.pipelineId == harness.DefaultName && p.Name != "" {
+		return slug.Create(p.Name)
+	}
+	return d.pipelineId
+}
+
+// splitTriggers splits the trigger documents from the
+// pipeline documents.
+func splitTriggers(b []byte) ([]byte, [][]byte) {
+	var pipelines, triggers [][]byte
+	for _, doc := range bytes.Split(b, []byte("\n---\n")) {
+		if isTrigger(doc) {
+			triggers = append(triggers, doc)
+		} else {
+			pipelines = append(pipelines, doc)
+		}
+	}
+	return bytes.Join(pipelines, []byte("\n---\n")), triggers
+}
+
+// isTrigger returns true if the yaml document is a trigger,
+// ignoring leading comments.
+func isTrigger(doc []byte) bool {
+	for _, line := range strings.Split(string(doc), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return strings.HasPrefix(line, "trigger:")
+	}
+	return false
+}
+
+// convertTrigger sets the trigger pipeline identifiers and
+// the repository of github webhook triggers.
+func (d *Downgrader) convertTrigger(b []byte, pipelineId string) ([]byte, error) {
+	config := new(v0.TriggerConfig)
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	if config.Trigger == nil {
+		return b, nil
+	}
+	config.Trigger.Org = d.pipelineOrg
+	config.Trigger.Project = d.pipelineProj
+	config.Trigger.Pipeline = pipelineId
+
+	// the webhook source is unmarshaled to a map, since
+	// the spec type depends on the source type.
+	if source := config.Trigger.Source; source != nil && source.Type == "Webhook" {
+		webhook, _ := source.Spec.(map[string]interface{})
+		event, _ := webhook["spec"].(map[string]interface{})
+		spec, _ := event["spec"].(map[string]interface{})
+		if webhook["type"] == "Github" && spec != nil {
+			if spec["connectorRef"] == nil && d.codebaseConn != "" {
+				spec["connectorRef"] = d.codebaseConn
+			}
+			if spec["repoName"] == nil && d.codebaseName != "" {
+				spec["repoName"] = d.codebaseName
+			}
+		}
+	}
+	return yaml.Marshal(config)
+}
+
 // helper function converts a drone pipeline stage to a
 // harness stage.
 //
@@ -21,7 +21,11 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/hunain-avyka/Go-drone/internal/report"
+
 	"github.com/google/go-cmp/cmp"
+	v0 "github.com/hunain-avyka/Go-drone/convert/harness/yaml"
+	v1 "github.com/hunain-avyka/go-spec/dist/go"
 	"gopkg.in/yaml.v3"
 )
 
@@ -130,3 +134,146 @@ func normalizeSlice(s []interface{}) []interface{} {
 	})
 	return s
 }
+
+func TestConvertTrigger(t *testing.T) {
+	in := []byte("# conversion notes\nkind: pipeline\nversion: 1\n\n---\ntrigger:\n  identifier: push\n  name: push\n  enabled: true\n  source:\n    type: Webhook\n    spec:\n      type: Github\n      spec:\n        type: Push\n        spec:\n          payloadConditions:\n          - key: targetBranch\n            operator: In\n            value: main\n")
+	pipelines, triggers := splitTriggers(in)
+	if got, want := string(pipelines), "# conversion notes\nkind: pipeline\nversion: 1\n"; got != want {
+		t.Errorf("Want pipeline document %q, got %q", want, got)
+	}
+	if len(triggers) != 1 {
+		t.Fatalf("Want 1 trigger document, got %d", len(triggers))
+	}
+
+	d := New(WithCodebase("hello-world", "github"), WithName("hello"))
+	out, err := d.convertTrigger(triggers[0], "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{}
+	if err := yaml.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"trigger": map[string]interface{}{
+			"identifier":         "push",
+			"name":               "push",
+			"enabled":            true,
+			"orgIdentifier":      "default",
+			"projectIdentifier":  "default",
+			"pipelineIdentifier": "hello",
+			"source": map[string]interface{}{
+				"type": "Webhook",
+				"spec": map[string]interface{}{
+					"type": "Github",
+					"spec": map[string]interface{}{
+						"type": "Push",
+						"spec": map[string]interface{}{
+							"connectorRef": "github",
+							"repoName":     "hello-world",
+							"payloadConditions": []interface{}{
+								map[string]interface{}{"key": "targetBranch", "operator": "In", "value": "main"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected trigger: %s", diff)
+	}
+}
+
+func TestConvertStages(t *testing.T) {
+	// the stages are decoded as yaml, so the specs that
+	// are not ci stage specs are generic values.
+	in := []byte(`
+- name: setup
+  type: ci
+  spec: {}
+- type: parallel
+  spec:
+    stages:
+    - name: lint
+      type: ci
+      spec: {}
+    - name: test
+      type: ci
+      spec: {}
+- name: approve deploy
+  type: approval
+  spec:
+    steps:
+    - name: approve
+      type: approval
+      spec:
+        message: deploy to production
+        approvers:
+          user_groups:
+          - admins
+          minimum_count: 1
+- name: deploy
+  type: template
+  spec:
+    uses: deploy
+`)
+	var stages []*v1.Stage
+	if err := yaml.Unmarshal(in, &stages); err != nil {
+		t.Fatal(err)
+	}
+	stages[0].Spec = &v1.StageCI{}
+
+	r := report.New()
+	out := New().convertStages(stages, false, r)
+	if got, want := len(out), 4; got != want {
+		t.Fatalf("Want %d stages, got %d", want, got)
+	}
+	if got, want := out[0].Stage.Name, "setup"; got != want {
+		t.Errorf("Want stage %q, got %q", want, got)
+	}
+	if got, want := len(out[1].Parallel), 2; got != want {
+		t.Fatalf("Want %d parallel stages, got %d", want, got)
+	}
+	if got, want := out[1].Parallel[1].Stage.Name, "test"; got != want {
+		t.Errorf("Want parallel stage %q, got %q", want, got)
+	}
+	if got, want := out[2].Stage.Type, v0.StageTypeApproval; got != want {
+		t.Errorf("Want stage type %q, got %q", want, got)
+	}
+	approval := out[2].Stage.Spec.(*v0.StageApproval).Execution.Steps[0].Step
+	if got, want := approval.Type, v0.StepTypeHarnessApproval; got != want {
+		t.Errorf("Want step type %q, got %q", want, got)
+	}
+	if diff := cmp.Diff(approval.Spec.(*v0.StepHarnessApproval).Approvers, &v0.Approvers{UserGroups: []string{"admins"}, MinimumCount: 1}); diff != "" {
+		t.Errorf("Unexpected approvers: %s", diff)
+	}
+	if diff := cmp.Diff(out[3].Stage.Template, &v0.Template{TemplateRef: "deploy"}); diff != "" {
+		t.Errorf("Unexpected template: %s", diff)
+	}
+	if got := r.Notes(); len(got) != 0 {
+		t.Errorf("Want no notes, got %v", got)
+	}
+}
+
+func TestConvertStages_Unsupported(t *testing.T) {
+	stages := []*v1.Stage{
+		{Name: "build", Type: "ci", Spec: &v1.StageCI{}},
+		{Name: "flags", Type: "flag"},
+	}
+	r := report.New()
+	out := New().convertStages(stages, false, r)
+	if got, want := len(out), 1; got != want {
+		t.Errorf("Want %d stages, got %d", want, got)
+	}
+	if diff := cmp.Diff(r.Notes(), []string{`stage "flags": flag stages are not supported`}); diff != "" {
+		t.Errorf("Unexpected notes: %s", diff)
+	}
+}
+
+func TestDowngrade_NotPipeline(t *testing.T) {
+	src := []*v1.Config{{Kind: "template", Spec: &v1.StageCI{}}}
+	if _, err := New().DowngradeFrom(src); err == nil {
+		t.Errorf("Want error for a document that is not a pipeline")
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package downgrader
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hunain-avyka/Go-drone/internal/report"
+	"github.com/hunain-avyka/Go-drone/internal/slug"
+
+	v0 "github.com/hunain-avyka/Go-drone/convert/harness/yaml"
+	v1 "github.com/hunain-avyka/go-spec/dist/go"
+)
+
+// approvalTimeout is the timeout of the approval steps.
+const approvalTimeout = "24h"
+
+type (
+	// stageParallelV1 defines the spec of a v1 parallel
+	// stage.
+	stageParallelV1 struct {
+		Stages []*v1.Stage `json:"stages,omitempty"`
+	}
+
+	// stageStepsV1 defines the spec of a v1 approval or
+	// custom stage, which only contains steps.
+	stageStepsV1 struct {
+		Steps []*v1.Step `json:"steps,omitempty"`
+	}
+
+	// stageTemplateV1 defines the spec of a v1 stage that
+	// uses a stage template.
+	stageTemplateV1 struct {
+		Uses string `json:"uses,omitempty"`
+	}
+
+	// stepApprovalV1 defines a v1 approval step.
+	stepApprovalV1 struct {
+		Message   string `json:"message,omitempty"`
+		Approvers *struct {
+			UserGroups   []string `json:"user_groups,omitempty"`
+			MinimumCount int      `json:"minimum_count,omitempty"`
+		} `json:"approvers,omitempty"`
+	}
+
+	// stepQueueV1 defines a v1 queue step.
+	stepQueueV1 struct {
+		Key   string `json:"key,omitempty"`
+		Scope string `json:"scope,omitempty"`
+	}
+)
+
+// convertStages converts the stages of the pipeline. The
+// stages of a parallel stage are converted to a parallel
+// group, and nested parallel stages are merged into the
+// parent group, since v0 does not support nested groups.
+// Stages that cannot be downgraded are recorded in the
+// report.
+func (d *Downgrader) convertStages(stages []*v1.Stage, parallel bool, r *report.Report) []*v0.Stages {
+	var out []*v0.Stages
+	for _, stage := range stages {
+		// skip nil stages. this is un-necessary, we have
+		// this logic in place just to be safe.
+		if stage == nil {
+			continue
+		}
+		switch stage.Type {
+		case "", "ci":
+			spec := new(v1.StageCI)
+			if err := decodeSpec(stage.Spec, spec); err != nil {
+				r.Addf("stage %q: %s", stage.Name, err)
+				continue
+			}
+			ci := *stage
+			ci.Spec = spec
+			out = append(out, &v0.Stages{Stage: d.convertStage(&ci)})
+		case "parallel":
+			spec := new(stageParallelV1)
+			if err := decodeSpec(stage.Spec, spec); err != nil {
+				r.Addf("stage %q: %s", stage.Name, err)
+				continue
+			}
+			group := d.convertStages(spec.Stages, true, r)
+			switch {
+			case parallel:
+				out = append(out, group...)
+			case len(group) == 1:
+				out = append(out, group[0])
+			case len(group) > 1:
+				out = append(out, &v0.Stages{Parallel: group})
+			}
+		default:
+			if v := d.convertStageV1(stage, r); v != nil {
+				out = append(out, &v0.Stages{Stage: v})
+			}
+		}
+	}
+	return out
+}
+
+// convertStageV1 converts the approval, custom and template
+// stages, or returns nil if the stage type is not
+// supported.
+func (d *Downgrader) convertStageV1(src *v1.Stage, r *report.Report) *v0.Stage {
+	stage := &v0.Stage{
+		ID: d.identifiers.Generate(
+			slug.Create(src.Name),
+			slug.Create(src.Type),
+		),
+		Name: convertName(src.Name),
+		When: convertStageWhen(src.When, ""),
+	}
+	switch src.Type {
+	case "approval":
+		steps := d.convertStepsV1(src, r)
+		if len(steps) == 0 {
+			return nil
+		}
+		stage.Type = v0.StageTypeApproval
+		stage.Spec = &v0.StageApproval{
+			Execution: &v0.Execution{Steps: steps},
+		}
+	case "custom":
+		steps := d.convertStepsV1(src, r)
+		if len(steps) == 0 {
+			return nil
+		}
+		stage.Type = v0.StageTypeCustom
+		stage.Spec = &v0.StageCustom{
+			Execution: &v0.Execution{Steps: steps},
+		}
+	case "template":
+		spec := new(stageTemplateV1)
+		if err := decodeSpec(src.Spec, spec); err != nil || spec.Uses == "" {
+			r.Addf("stage %q: the stage template is not defined", src.Name)
+			return nil
+		}
+		// the version label is omitted, so the stage uses
+		// the stable version of the template.
+		stage.Template = &v0.Template{
+			TemplateRef: spec.Uses,
+		}
+	default:
+		r.Addf("stage %q: %s stages are not supported", src.Name, src.Type)
+		return nil
+	}
+	return stage
+}
+
+// convertStepsV1 converts the approval and queue steps of
+// the stage. Other steps are recorded in the report.
+func (d *Downgrader) convertStepsV1(src *v1.Stage, r *report.Report) []*v0.Steps {
+	spec := new(stageStepsV1)
+	if err := decodeSpec(src.Spec, spec); err != nil {
+		r.Addf("stage %q: %s", src.Name, err)
+		return nil
+	}
+	var steps []*v0.Steps
+	for _, step := range spec.Steps {
+		if step == nil {
+			continue
+		}
+		id := d.identifiers.Generate(
+			slug.Create(step.Name),
+			slug.Create(step.Type),
+		)
+		switch step.Type {
+		case "approval":
+			from := new(stepApprovalV1)
+			if err := decodeSpec(step.Spec, from); err != nil {
+				r.Addf("stage %q: step %q: %s", src.Name, step.Name, err)
+				continue
+			}
+			approval := &v0.StepHarnessApproval{
+				ApprovalMessage:                 from.Message,
+				IncludePipelineExecutionHistory: "true",
+			}
+			if from.Approvers != nil {
+				approval.Approvers = &v0.Approvers{
+					UserGroups:   from.Approvers.UserGroups,
+					MinimumCount: from.Approvers.MinimumCount,
+				}
+			}
+			steps = append(steps, &v0.Steps{
+				Step: &v0.Step{
+					ID:      id,
+					Name:    convertName(step.Name),
+					Type:    v0.StepTypeHarnessApproval,
+					Timeout: convertTimeout(approvalTimeout),
+					Spec:    approval,
+				},
+			})
+		case "queue":
+			from := new(stepQueueV1)
+			if err := decodeSpec(step.Spec, from); err != nil {
+				r.Addf("stage %q: step %q: %s", src.Name, step.Name, err)
+				continue
+			}
+			steps = append(steps, &v0.Steps{
+				Step: &v0.Step{
+					ID:   id,
+					Name: convertName(step.Name),
+					Type: v0.StepTypeQueue,
+					Spec: &v0.StepQueue{
+						Key:   from.Key,
+						Scope: strings.Title(from.Scope),
+					},
+				},
+			})
+		default:
+			r.Addf("stage %q: step %q: %s steps are not supported", src.Name, step.Name, step.Type)
+		}
+	}
+	return steps
+}
+
+// decodeSpec decodes the parsed spec of a stage or step
+// into the spec type. The spec is returned unchanged if it
+// already has the spec type.
+func decodeSpec(src, dst interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case *v1.StageCI:
+		if dst, ok := dst.(*v1.StageCI); ok {
+			*dst = *src
+			return nil
+		}
+	}
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		return fmt.Errorf("invalid spec: %s", err)
+	}
+	return nil
+}
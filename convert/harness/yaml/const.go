@@ -29,6 +29,7 @@ const (
 	StageTypeNone        StageType = "None"
 	StageTypeApproval              = "Approval"
 	StageTypeCI                    = "CI"
+	StageTypeCustom                = "Custom"
 	StageTypeDeployment            = "Deployment"
 	StageTypeFeatureFlag           = "FeatureFlag"
 )
@@ -60,6 +61,7 @@ const (
 	StepTypeGCSUpload                  = "GCSUpload"
 	StepTypeHarnessApproval            = "HarnessApproval"
 	StepTypePlugin                     = "Plugin"
+	StepTypeQueue                      = "Queue"
 	StepTypeRestoreCacheGCS            = "RestoreCacheGCS"
 	StepTypeRestoreCacheS3             = "RestoreCacheS3"
 	StepTypeRun                        = "Run"
@@ -30,11 +30,23 @@ type (
 		Vars        []*Variable `json:"variables,omitempty"    yaml:"variables,omitempty"`
 		When        *StageWhen  `json:"when,omitempty"         yaml:"when,omitempty"`
 		Strategy    *Strategy   `json:"strategy,omitempty"     yaml:"strategy,omitempty"`
+		Template    *Template   `json:"template,omitempty"     yaml:"template,omitempty"`
 	}
 
 	// StageApproval defines an approval stage.
 	StageApproval struct {
-		// TODO
+		Execution *Execution `json:"execution,omitempty" yaml:"execution,omitempty"`
+	}
+
+	// StageCustom defines a custom stage.
+	StageCustom struct {
+		Execution *Execution `json:"execution,omitempty" yaml:"execution,omitempty"`
+	}
+
+	// Template defines a reference to a stage template.
+	Template struct {
+		TemplateRef  string `json:"templateRef,omitempty"  yaml:"templateRef,omitempty"`
+		VersionLabel string `json:"versionLabel,omitempty" yaml:"versionLabel,omitempty"`
 	}
 
 	// StageCI defines a continuous integration stage.
@@ -98,8 +110,12 @@ func (s *Stage) UnmarshalJSON(data []byte) error {
 	}
 
 	switch s.Type {
+	case StageTypeApproval:
+		s.Spec = new(StageApproval)
 	case StageTypeCI:
 		s.Spec = new(StageCI)
+	case StageTypeCustom:
+		s.Spec = new(StageCustom)
 	case StageTypeFeatureFlag:
 		s.Spec = new(StageFeatureFlag)
 	default:
@@ -83,6 +83,11 @@ type (
 		IncludePipelineExecutionHistory string           `json:"includePipelineExecutionHistory,omitempty" yaml:"includePipelineExecutionHistory,omitempty"`
 	}
 
+	StepQueue struct {
+		Key   string `json:"key,omitempty"   yaml:"key,omitempty"`
+		Scope string `json:"scope,omitempty" yaml:"scope,omitempty"`
+	}
+
 	StepRestoreCacheGCS struct {
 		// TODO
 	}
@@ -0,0 +1,87 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml
+
+type (
+	// TriggerConfig defines trigger resource configuration.
+	TriggerConfig struct {
+		Trigger *Trigger `json:"trigger" yaml:"trigger"`
+	}
+
+	// Trigger defines a pipeline trigger.
+	Trigger struct {
+		ID        string         `json:"identifier,omitempty"         yaml:"identifier,omitempty"`
+		Name      string         `json:"name,omitempty"               yaml:"name,omitempty"`
+		Desc      string         `json:"description,omitempty"        yaml:"description,omitempty"`
+		Enabled   bool           `json:"enabled"                      yaml:"enabled"`
+		Org       string         `json:"orgIdentifier,omitempty"      yaml:"orgIdentifier,omitempty"`
+		Project   string         `json:"projectIdentifier,omitempty"  yaml:"projectIdentifier,omitempty"`
+		Pipeline  string         `json:"pipelineIdentifier,omitempty" yaml:"pipelineIdentifier,omitempty"`
+		Source    *TriggerSource `json:"source,omitempty"             yaml:"source,omitempty"`
+		InputYaml string         `json:"inputYaml,omitempty"          yaml:"inputYaml,omitempty"`
+	}
+
+	// TriggerSource defines the trigger source. The source
+	// type is Webhook or Scheduled.
+	TriggerSource struct {
+		Type string      `json:"type,omitempty" yaml:"type,omitempty"`
+		Spec interface{} `json:"spec,omitempty" yaml:"spec,omitempty"`
+	}
+
+	// WebhookSource defines a webhook trigger source. The
+	// webhook type is Github or Custom.
+	WebhookSource struct {
+		Type string      `json:"type,omitempty" yaml:"type,omitempty"`
+		Spec interface{} `json:"spec,omitempty" yaml:"spec,omitempty"`
+	}
+
+	// WebhookEvent defines the event of a git provider
+	// webhook, such as Push or PullRequest.
+	WebhookEvent struct {
+		Type string       `json:"type,omitempty" yaml:"type,omitempty"`
+		Spec *WebhookSpec `json:"spec,omitempty" yaml:"spec,omitempty"`
+	}
+
+	// WebhookSpec defines the webhook trigger conditions.
+	WebhookSpec struct {
+		Conn              string              `json:"connectorRef,omitempty"                yaml:"connectorRef,omitempty"`
+		Repo              string              `json:"repoName,omitempty"                    yaml:"repoName,omitempty"`
+		AutoAbort         bool                `json:"autoAbortPreviousExecutions,omitempty" yaml:"autoAbortPreviousExecutions,omitempty"`
+		PayloadConditions []*TriggerCondition `json:"payloadConditions,omitempty"           yaml:"payloadConditions,omitempty"`
+		HeaderConditions  []*TriggerCondition `json:"headerConditions,omitempty"            yaml:"headerConditions,omitempty"`
+		JexlCondition     string              `json:"jexlCondition,omitempty"               yaml:"jexlCondition,omitempty"`
+		Actions           []string            `json:"actions,omitempty"                     yaml:"actions,omitempty"`
+	}
+
+	// TriggerCondition defines a webhook payload or header
+	// condition.
+	TriggerCondition struct {
+		Key      string `json:"key,omitempty"      yaml:"key,omitempty"`
+		Operator string `json:"operator,omitempty" yaml:"operator,omitempty"`
+		Value    string `json:"value,omitempty"    yaml:"value,omitempty"`
+	}
+
+	// ScheduledSource defines a scheduled trigger source.
+	ScheduledSource struct {
+		Type string    `json:"type,omitempty" yaml:"type,omitempty"`
+		Spec *CronSpec `json:"spec,omitempty" yaml:"spec,omitempty"`
+	}
+
+	// CronSpec defines a cron schedule.
+	CronSpec struct {
+		Type       string `json:"type,omitempty"       yaml:"type,omitempty"`
+		Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
+	}
+)
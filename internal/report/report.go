@@ -0,0 +1,69 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package report collects notes about pipeline configuration
+// that could not be converted, or that requires additional
+// setup in Harness after conversion.
+package report
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Report stores conversion notes.
+type Report struct {
+	notes []string
+	index map[string]struct{}
+}
+
+// New returns a new conversion report.
+func New() *Report {
+	return &Report{
+		index: map[string]struct{}{},
+	}
+}
+
+// Addf formats and adds a note to the report. Duplicate
+// notes are ignored.
+func (r *Report) Addf(format string, args ...interface{}) {
+	note := fmt.Sprintf(format, args...)
+	if _, ok := r.index[note]; ok {
+		return
+	}
+	r.index[note] = struct{}{}
+	r.notes = append(r.notes, note)
+}
+
+// Notes returns the notes in the order they were added.
+func (r *Report) Notes() []string {
+	return r.notes
+}
+
+// Comment returns the notes formatted as a yaml comment
+// block that can be prepended to the converted yaml. If
+// the report is empty a nil slice is returned.
+func (r *Report) Comment() []byte {
+	if len(r.notes) == 0 {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString("# conversion notes:\n")
+	for _, note := range r.notes {
+		buf.WriteString("# - ")
+		buf.WriteString(note)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 Harness, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import "testing"
+
+func TestReport(t *testing.T) {
+	r := New()
+	if got := r.Comment(); got != nil {
+		t.Errorf("Want nil comment for empty report, got %q", got)
+	}
+
+	r.Addf("stage %q: cron %v", "default", []string{"nightly"})
+	r.Addf("stage %q: cron %v", "default", []string{"nightly"})
+	r.Addf("step %q: devices", "test")
+
+	if got, want := len(r.Notes()), 2; got != want {
+		t.Errorf("Want %d notes, got %d", want, got)
+	}
+
+	want := "# conversion notes:\n" +
+		"# - stage \"default\": cron [nightly]\n" +
+		"# - step \"test\": devices\n"
+	if got := string(r.Comment()); got != want {
+		t.Errorf("Want comment %q, got %q", want, got)
+	}
+}